@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	. "github.com/fsvxavier/default-vertical-slice/config"
+	gmigrate "github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx/migrate"
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+const usage = `usage: migrate <command> [flags]
+
+commands:
+  up        apply the pending migrations, up to -target when set
+  down      roll back the migrations above -target, only the latest when unset
+  baseline  record the migrations up to -target as applied without running them
+  status    list the migrations and whether they are applied
+
+flags:
+`
+
+// Run runs the migrate command with args, the command line after "migrate". The
+// database and the migrations directory are read from the configuration.
+func Run(args []string) {
+	ctx := context.Background()
+
+	if err := run(ctx, args, os.Stdout); err != nil {
+		logger.Fatal(ctx, "Error to migrate - "+err.Error())
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	target := fs.Int64("target", 0, "version to migrate up or down to, or to baseline")
+	dryRun := fs.Bool("dry-run", false, "print the migrations that would run without changing the database")
+	fs.Usage = func() {
+		fmt.Fprint(out, usage)
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.Database.Connection.Url.Value())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	migrator, err := newMigrator(conn, cfg)
+	if err != nil {
+		return err
+	}
+	migrator.SetDryRun(*dryRun)
+
+	var steps []gmigrate.Step
+	switch command {
+	case "up":
+		steps, err = migrator.Up(ctx, *target)
+	case "down":
+		if !isSet(fs, "target") {
+			if *target, err = previousVersion(ctx, migrator); err != nil {
+				return err
+			}
+		}
+		steps, err = migrator.Down(ctx, *target)
+	case "baseline":
+		steps, err = migrator.Baseline(ctx, *target)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "%-8s %d_%s\n", state, st.Version, st.Name)
+		}
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	for _, step := range steps {
+		fmt.Fprintf(out, "%-5s %d_%s\n", step.Direction, step.Version, step.Name)
+		if *dryRun && step.SQL != "" {
+			fmt.Fprintf(out, "%s\n\n", step.SQL)
+		}
+	}
+	if len(steps) == 0 {
+		fmt.Fprintln(out, "nothing to migrate")
+	}
+
+	return err
+}
+
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// previousVersion returns the version preceding the latest applied migration, so rolling
+// back to it undoes only that migration.
+func previousVersion(ctx context.Context, migrator *gmigrate.Migrator) (int64, error) {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(statuses) - 1; i > 0; i-- {
+		if statuses[i].Applied {
+			return statuses[i-1].Version, nil
+		}
+	}
+	return 0, nil
+}
+
+// Startup applies the pending migrations with a connection of pool, as enabled by
+// DB_MIGRATE_ON_STARTUP.
+func Startup(ctx context.Context, cfg *Config, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	migrator, err := newMigrator(conn, cfg)
+	if err != nil {
+		return err
+	}
+
+	steps, err := migrator.Up(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(ctx, "Migrations applied on startup: "+strconv.Itoa(len(steps)))
+	return nil
+}
+
+func newMigrator(conn gmigrate.Conn, cfg *Config) (*gmigrate.Migrator, error) {
+	migrator, err := gmigrate.NewDirMigrator(conn, cfg.Database.Migrations.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.SetTable(cfg.Database.Migrations.Table), nil
+}
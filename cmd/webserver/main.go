@@ -2,109 +2,102 @@ package webserver
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
+	"github.com/fsvxavier/default-vertical-slice/cmd/migrate"
 	"github.com/fsvxavier/default-vertical-slice/cmd/webserver/routering"
 	. "github.com/fsvxavier/default-vertical-slice/config"
+	domainerrors "github.com/fsvxavier/default-vertical-slice/internal/features/commons/errors"
 	"github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx"
+	"github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx/outbox"
 	"github.com/fsvxavier/default-vertical-slice/pkg/database/redis"
+	"github.com/fsvxavier/default-vertical-slice/pkg/health"
+	"github.com/fsvxavier/default-vertical-slice/pkg/httpclient"
 	"github.com/fsvxavier/default-vertical-slice/pkg/httpserver/fiber"
+	"github.com/fsvxavier/default-vertical-slice/pkg/httpserver/fiber/middleware"
+	"github.com/fsvxavier/default-vertical-slice/pkg/lifecycle"
 	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
 	"github.com/fsvxavier/default-vertical-slice/pkg/tracing/datadog"
 )
 
 const (
-	AppName                      = "munin-exchange-rate-api"
-	HTTP                         = "HTTP"
-	TRUE                         = true
-	FALSE                        = false
-	DEFAULT_MAX_CONS             = "20"
-	DEFAULT_MIN_CONS             = "1"
-	DEFAULT_CONN_LIFE_TIME       = "3600"
-	DEFAULT_CONN_IDLE_TIME       = "120"
-	DEFAULT_RDB_MAX_ACTIVE_CONNS = "1000"
-	DEFAULT_RDB_DATABASE         = "0"
-	DEFAULT_RDB_MAX_IDLE_CONNS   = "300"
-	DEFAULT_RDB_CLIENT_NAME      = "munin-exchange-rate-api"
+	AppName = "munin-exchange-rate-api"
+	HTTP    = "HTTP"
+	TRUE    = true
+	FALSE   = false
 )
 
-func initDatabase(ctx context.Context, cfg *Config) (*pgxpool.Pool, error) {
+func initDatabase(ctx context.Context, cfg *Config) (*gpgx.PgConnection, error) {
 	span, ctxs := tracer.StartSpanFromContext(ctx, "main.initDatabase")
 	defer span.Finish()
 
-	// Define max connections
-	defaultMaxConns := DEFAULT_MAX_CONS
-	if os.Getenv("DB_MAX_CONNS") != "" {
-		defaultMaxConns = os.Getenv("DB_MAX_CONNS")
-	}
-	maxConns, err := strconv.ParseInt(defaultMaxConns, 10, 64)
-	if err != nil {
-		logger.Error(ctx, err.Error())
-	}
-
-	// Define min connections
-	defaultMinConns := DEFAULT_MIN_CONS
-	if os.Getenv("DB_MIN_CONNS") != "" {
-		defaultMinConns = os.Getenv("DB_MIN_CONNS")
-	}
-	minConns, err := strconv.ParseInt(defaultMinConns, 10, 64)
-	if err != nil {
-		logger.Error(ctx, err.Error())
-	}
-
-	// Define life time connections
-	defaultLifeConns := DEFAULT_CONN_LIFE_TIME
-	if os.Getenv("DB_LIFE_TIME_CONNS") != "" {
-		defaultLifeConns = os.Getenv("DB_LIFE_TIME_CONNS")
-	}
-	lifeTimeConns, err := time.ParseDuration(defaultLifeConns + "s")
-	if err != nil {
-		logger.Error(ctx, err.Error())
-	}
+	multiTenantRep := strings.ToUpper(cfg.Application.Drivers) == HTTP
 
-	// Define idle life time connections
-	defaultIdleConns := DEFAULT_CONN_IDLE_TIME
-	if os.Getenv("DB_IDLE_TIME_CONNS") != "" {
-		defaultIdleConns = os.Getenv("DB_IDLE_TIME_CONNS")
+	replicas := make([]string, 0, len(cfg.Database.Replica.Urls))
+	for _, url := range cfg.Database.Replica.Urls {
+		replicas = append(replicas, url.Value())
 	}
-	idleTimeConns, err := time.ParseDuration(defaultIdleConns + "s")
-	if err != nil {
-		logger.Error(ctx, err.Error())
-	}
-
-	multiTenantRep := strings.ToUpper(cfg.Application.Drivers) == HTTP
 
 	pool := gpgx.NewPgConnection().
-		SetMaxConns(int32(maxConns)).
-		SetMinConns(int32(minConns)).
-		SetMaxConnLifetime(lifeTimeConns).
-		SetMaxConnIdleTime(idleTimeConns).
+		SetMaxConns(cfg.Database.MaxConns).
+		SetMinConns(cfg.Database.MinConns).
+		SetMaxConnLifetime(cfg.Database.LifeTimeConns).
+		SetMaxConnIdleTime(cfg.Database.IdleTimeConns).
 		SetDatadogEnable(cfg.Datadog.Enabled).
 		SetQueryTracerEnabled(cfg.Database.QueryTracer).
 		SetMultiTenantEnabled(cfg.Database.MultiTenant).
-		SetMultiTenantRepEnabled(multiTenantRep)
+		SetMultiTenantRepEnabled(multiTenantRep).
+		SetReplicas(replicas...).
+		SetReplicaStrategy(cfg.Database.Replica.Strategy).
+		SetReplicaMaxLag(cfg.Database.Replica.MaxLag).
+		SetRetryPolicy(gpgx.NewRetryPolicy().
+			SetMaxAttempts(cfg.Database.Retry.MaxAttempts).
+			SetBackoff(cfg.Database.Retry.Backoff, cfg.Database.Retry.MaxBackoff).
+			SetMetrics(gpgx.NewRetryMetrics(prometheus.DefaultRegisterer))).
+		SetQueryMetrics(gpgx.NewQueryMetrics(prometheus.DefaultRegisterer)).
+		SetSlowQueryThreshold(cfg.Database.SlowQuery.Threshold).
+		SetExplainSlowQueries(cfg.Database.SlowQuery.Explain && cfg.Application.Env == "dev")
+	gpgx.RegisterPoolMetrics(prometheus.DefaultRegisterer, pool)
+
+	if cfg.Database.MultiTenant {
+		registry := gpgx.StaticTenantRegistry{}
+		for _, entry := range cfg.Database.Tenancy.Urls {
+			tenantID, url, ok := strings.Cut(entry.Value(), "=")
+			if !ok {
+				logger.Fatal(ctxs, "Invalid DB_TENANT_URLS entry, expected tenant=url")
+			}
+			registry[tenantID] = url
+		}
+
+		pool.SetTenancyStrategy(cfg.Database.Tenancy.Strategy).
+			SetTenantSchemaResolver(gpgx.SchemaPrefixResolver(cfg.Database.Tenancy.SchemaPrefix)).
+			SetTenantRegistry(registry).
+			SetTenantPoolLimit(cfg.Database.Tenancy.PoolLimit)
+	}
 
-	err = pool.NewPool(ctxs, cfg.Database.Connection.Url)
+	err := pool.NewPool(ctxs, cfg.Database.Connection.Url.Value())
 	if err != nil {
 		logger.Fatal(ctxs, "Error to create a new pool database - "+err.Error())
 	}
 
 	if cfg.Database.Ping {
-		err = pool.Pool().Ping(ctxs)
+		err = pool.Ping(ctxs)
 		if err != nil {
 			logger.Fatal(ctxs, "Error to ping database - "+err.Error())
 		}
 	}
 
-	return pool.Pool(), nil
+	return pool, nil
 }
 
 func initLogger(ctx context.Context, outout io.Writer, cfg *Config) (loging *logger.Logger) {
@@ -118,99 +111,354 @@ func initRedis(ctx context.Context, cfg *Config) (rdb redis.Redigo, err error) {
 	span, ctxs := tracer.StartSpanFromContext(ctx, "main.initRedis")
 	defer span.Finish()
 
-	// Define max active connections
-	defaultMaxActiveConns := DEFAULT_RDB_MAX_ACTIVE_CONNS
-	if os.Getenv("RDB_MAX_ACTIVE_CONNS") != "" {
-		defaultMaxActiveConns = os.Getenv("RDB_MAX_ACTIVE_CONNS")
+	opt := &redis.RedigoPoolOptions{
+		Addresses:        cfg.Redis.Addresses,
+		MaxIdle:          cfg.Redis.MaxIdleConns,
+		MaxActive:        cfg.Redis.MaxActiveConns,
+		MaxConnLifetime:  time.Second * 3600,
+		Database:         cfg.Redis.Database,
+		ClientName:       cfg.Redis.ClientName,
+		Password:         cfg.Redis.Password.Value(),
+		UsageTLS:         cfg.Redis.UsageTLS,
+		TraceServiceName: cfg.Redis.TraceServiceName,
 	}
-	maxActive, err := strconv.ParseInt(defaultMaxActiveConns, 10, 64)
+
+	rdb, err = redis.NewRedigo(ctxs, opt)
 	if err != nil {
-		logger.Fatal(ctxs, "Error to ParseInt maxActive - "+err.Error())
-		return redis.Redigo{}, err
+		return rdb, err
 	}
 
-	// Define max active connections
-	defaultDatabase := DEFAULT_RDB_DATABASE
-	if os.Getenv("RDB_DATABASE") != "" {
-		defaultDatabase = os.Getenv("RDB_DATABASE")
+	return rdb, nil
+}
+
+// initHealth registers the checks of the dependencies owned by the webserver and of the
+// remote APIs declared in HEALTH_HTTP_CHECKS, and the warm-up checks of the startup probe.
+func initHealth(ctx context.Context, cfg *Config, db *gpgx.PgConnection, rdb *redis.Redigo, ready func() bool) (*health.Registry, *health.Startup) {
+	checks := []health.Check{
+		{
+			Name:        "postgres",
+			Checker:     health.CheckerFunc(db.Ping),
+			Criticality: health.CRITICAL,
+			Timeout:     cfg.Health.Timeout,
+			Metadata:    map[string]string{"type": "database"},
+		},
+		{
+			Name:        "redis",
+			Checker:     health.CheckerFunc(rdb.Ping),
+			Criticality: health.CRITICAL,
+			Timeout:     cfg.Health.Timeout,
+			Metadata:    map[string]string{"type": "cache"},
+		},
 	}
-	rdbDatabase, err := strconv.ParseInt(defaultDatabase, 10, 64)
-	if err != nil {
-		logger.Fatal(ctxs, "Error to ParseInt rdbDatabase - "+err.Error())
-		return redis.Redigo{}, err
+
+	if len(cfg.Database.Replica.Urls) > 0 {
+		checks = append(checks, health.Check{
+			Name:        "postgres_replicas",
+			Checker:     health.CheckerFunc(db.CheckReplicas),
+			Criticality: health.DEGRADED,
+			Timeout:     cfg.Health.Timeout,
+			Metadata:    map[string]string{"type": "database"},
+		})
 	}
 
-	// Define max active connections
-	defaultMaxIdleConns := DEFAULT_RDB_MAX_IDLE_CONNS
-	if os.Getenv("RDB_MAX_IDLE_CONNS") != "" {
-		defaultMaxIdleConns = os.Getenv("RDB_MAX_IDLE_CONNS")
+	for _, entry := range cfg.Health.HttpChecks {
+		name, url, ok := strings.Cut(entry, "=")
+		if !ok {
+			logger.Fatal(ctx, "Invalid HEALTH_HTTP_CHECKS entry, expected name=url - "+entry)
+		}
+		checks = append(checks, health.Check{
+			Name:        name,
+			Checker:     health.HTTPChecker(nil, url, nil),
+			Criticality: health.DEGRADED,
+			Timeout:     cfg.Health.Timeout,
+			Metadata:    map[string]string{"type": "http", "url": url},
+		})
 	}
-	maxIdleConns, err := strconv.ParseInt(defaultMaxIdleConns, 10, 64)
-	if err != nil {
-		logger.Fatal(ctxs, "Error to ParseInt maxIdleConns - "+err.Error())
-		return redis.Redigo{}, err
+
+	for _, check := range checks {
+		if err := health.Register(check); err != nil {
+			logger.Fatal(ctx, "Error to register health check - "+err.Error())
+		}
 	}
 
-	opt := &redis.RedigoPoolOptions{
-		Addresses:        strings.Split(cfg.Redis.Addresses, ","),
-		MaxIdle:          int(maxIdleConns),
-		MaxActive:        int(maxActive),
-		MaxConnLifetime:  time.Second * 3600,
-		Database:         int(rdbDatabase),
-		ClientName:       cfg.Redis.ClientName,
-		Password:         cfg.Redis.Password,
-		UsageTLS:         cfg.Redis.UsageTLS,
-		TraceServiceName: cfg.Redis.TraceServiceName,
+	startup := health.NewStartup(health.NewRegistry())
+	warmUp := []health.Check{
+		{
+			Name: "lifecycle",
+			Checker: health.CheckerFunc(func(ctx context.Context) error {
+				if !ready() {
+					return errors.New("hooks still starting")
+				}
+				return nil
+			}),
+		},
+		{
+			Name: "postgres_min_conns",
+			Checker: health.CheckerFunc(func(ctx context.Context) error {
+				stat := db.Stat()
+				if stat == nil {
+					return errors.New("database not connected")
+				}
+				if total := stat.TotalConns(); total < cfg.Database.MinConns {
+					return fmt.Errorf("%d of %d minimum connections open", total, cfg.Database.MinConns)
+				}
+				return nil
+			}),
+			Metadata: map[string]string{"type": "database"},
+		},
 	}
 
-	rdb, err = redis.NewRedigo(ctxs, opt)
-	if err != nil {
-		return rdb, err
+	for _, check := range warmUp {
+		if err := startup.Registry().Register(check); err != nil {
+			logger.Fatal(ctx, "Error to register startup check - "+err.Error())
+		}
 	}
 
-	return rdb, nil
+	registry := health.DefaultRegistry.
+		SetCacheTTL(cfg.Health.CacheTTL).
+		SetMetrics(health.NewMetrics(prometheus.DefaultRegisterer))
+
+	return registry, startup
+}
+
+// initRateLimiter builds the rate limiter of the webserver, nil when HTTP_RATE_LIMIT_ENABLE
+// is not set.
+func initRateLimiter(ctx context.Context, cfg *Config) *middleware.RateLimiter {
+	if !cfg.Http.RateLimit {
+		return nil
+	}
+
+	storage := middleware.NewRateLimiterStorage(ctx, cfg.Redis.Addresses, cfg.Redis.Username, cfg.Redis.Password.Value())
+	return middleware.NewRateLimiter(middleware.NewRateLimiterConfig(storage, cfg.Http.RateLimitRPM, time.Duration(cfg.Http.RateLimitLock)*time.Minute))
+}
+
+// initWatcher subscribes the settings that can be changed without a restart.
+func initWatcher(cfg *Config, rateLimiter *middleware.RateLimiter) *Watcher {
+	watcher := NewWatcher(cfg, os.Args[1:]...).SetPollInterval(cfg.Application.ConfigPoll)
+
+	OnChange(watcher, func(c *Config) string { return c.Log.Level }, func(_, level string) {
+		if err := logger.SetLevel(level); err != nil {
+			logger.ErrorOutCtx("Error to apply LOG_LEVEL - " + err.Error())
+		}
+	})
+
+	type rateLimit struct{ rpm, lock int }
+	OnChange(watcher, func(c *Config) rateLimit {
+		return rateLimit{c.Http.RateLimitRPM, c.Http.RateLimitLock}
+	}, func(_, rl rateLimit) {
+		if rateLimiter != nil {
+			rateLimiter.Update(rl.rpm, time.Duration(rl.lock)*time.Minute)
+		}
+	})
+
+	OnChange(watcher, func(c *Config) bool { return c.Http.ClientTrace }, func(_, enabled bool) {
+		httpclient.SetTraceEnabled(enabled)
+	})
+
+	OnChange(watcher, func(c *Config) bool { return c.Database.QueryTracer }, func(_, enabled bool) {
+		gpgx.Pg().SetQueryTracerEnabled(enabled)
+	})
+
+	return watcher
 }
 
 func Run() {
 	ctxs := context.TODO()
 
-	cfg := NewConfig()
+	cfg, err := NewConfig(os.Args[1:]...)
+	if err != nil {
+		logger.Fatal(ctxs, "Error to load config - "+err.Error())
+	}
+	httpclient.SetTraceEnabled(cfg.Http.ClientTrace)
+
+	if cfg.Application.ErrorsFile != "" {
+		if err := domainerrors.LoadErrorsFile(cfg.Application.ErrorsFile); err != nil {
+			logger.Fatal(ctxs, "Error to load errors catalog - "+err.Error())
+		}
+	}
+
+	lc := lifecycle.NewManager().
+		SetShutdownTimeout(cfg.Http.ShutdownTimeout).
+		SetDrainDelay(cfg.Http.ShutdownDelay)
 
 	if cfg.Datadog.Enabled {
 		datadog.StartTracing()
-		defer datadog.StopTracing()
 
 		// Start a root span.
 		var span ddtrace.Span
 		span, ctxs = tracer.StartSpanFromContext(context.Background(), "main")
-		defer span.Finish()
 
 		if cfg.Datadog.Profile {
 			err := datadog.StartProfiling()
 			if err != nil {
 				logger.Error(ctxs, err.Error())
 			}
-			defer datadog.StopProfiling()
 		}
+
+		lc.Append(lifecycle.Hook{
+			Name: "tracing",
+			OnStop: func(ctx context.Context) error {
+				span.Finish()
+				// StopTracing also stops the profiler.
+				datadog.StopTracing()
+				return nil
+			},
+		})
 	}
 
-	dbPool, err := initDatabase(ctxs, cfg)
+	loging := initLogger(ctxs, os.Stdout, cfg)
+	lc.Append(lifecycle.Hook{
+		Name: "logger",
+		OnStop: func(ctx context.Context) error {
+			loging.Sync()
+			return nil
+		},
+	})
+
+	db, err := initDatabase(ctxs, cfg)
 	if err != nil {
 		logger.Panic(ctxs, "Error to connect Database - "+err.Error())
 	}
-	defer dbPool.Close()
+
+	if cfg.Database.Migrations.OnStartup {
+		// Migrations change the schema of every tenant.
+		if err := migrate.Startup(tenant.System(ctxs), cfg, db.Pool()); err != nil {
+			logger.Fatal(ctxs, "Error to apply migrations - "+err.Error())
+		}
+	}
+	lc.Append(lifecycle.Hook{
+		Name: "database",
+		OnStop: func(ctx context.Context) error {
+			db.Close()
+			return nil
+		},
+	})
+
+	if len(cfg.Database.Replica.Urls) > 0 {
+		replicaCtx, stopReplicas := context.WithCancel(ctxs)
+		lc.Append(lifecycle.Hook{
+			Name: "database_replicas",
+			OnStart: func(ctx context.Context) error {
+				go db.WatchReplicas(replicaCtx, cfg.Database.Replica.CheckInterval)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				stopReplicas()
+				return nil
+			},
+		})
+	}
 
 	rdb, err := initRedis(ctxs, cfg)
 	if err != nil {
 		logger.Panic(ctxs, "Error to connect Redis - "+err.Error())
 	}
-	defer rdb.Pool.Close()
+	lc.Append(lifecycle.Hook{
+		Name: "redis",
+		OnStop: func(ctx context.Context) error {
+			if rdb.Cluster != nil {
+				return rdb.Cluster.Close()
+			}
+			return rdb.Pool.Close()
+		},
+	})
+
+	if cfg.Database.Outbox.Enabled {
+		relay := outbox.NewRelay(db, outbox.NewRedisPublisher(&rdb).SetPrefix(cfg.Database.Outbox.StreamPrefix)).
+			SetTable(cfg.Database.Outbox.Table).
+			SetBatchSize(cfg.Database.Outbox.BatchSize).
+			SetMaxAttempts(cfg.Database.Outbox.MaxAttempts).
+			SetPollInterval(cfg.Database.Outbox.PollInterval).
+			SetRetention(cfg.Database.Outbox.Retention, outbox.DEFAULT_CLEANUP_INTERVAL).
+			SetMetrics(outbox.NewMetrics(prometheus.DefaultRegisterer))
+
+		// The relay publishes the events of every tenant.
+		relayCtx, stopRelay := context.WithCancel(tenant.System(ctxs))
+		relayDone := make(chan struct{})
+		lc.Append(lifecycle.Hook{
+			Name: "outbox_relay",
+			OnStart: func(ctx context.Context) error {
+				go func() {
+					defer close(relayDone)
+					relay.Run(relayCtx)
+				}()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				stopRelay()
+				select {
+				case <-relayDone:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			},
+		})
+	}
+
+	rateLimiter := initRateLimiter(ctxs, cfg)
+
+	watcher := initWatcher(cfg, rateLimiter)
+	watchCtx, stopWatch := context.WithCancel(ctxs)
+	lc.Append(lifecycle.Hook{
+		Name: "config",
+		OnStart: func(ctx context.Context) error {
+			go watcher.Watch(watchCtx)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopWatch()
+			return nil
+		},
+	})
 
 	httpServer := fiber.FiberEngine{}
 
-	httpServer.NewWebserver(cfg.Http.Port)
-	router := routering.NewRoutes(httpServer.GetApp(), dbPool, &rdb)
+	httpServer.NewWebserver(fiber.WebserverOptions{
+		RateLimiter:     rateLimiter,
+		Port:            cfg.Http.Port,
+		AppName:         cfg.Application.Name,
+		DisableStartMsg: cfg.Http.DisableStartMsg,
+		Prefork:         cfg.Http.Prefork,
+		Pprof:           cfg.Application.Pprof,
+		Prometheus:      cfg.Http.Prometheus,
+	})
+	registry, startup := initHealth(ctxs, cfg, db, &rdb, lc.Ready)
+
+	if cfg.Health.RefreshInterval > 0 {
+		refreshCtx, stopRefresh := context.WithCancel(ctxs)
+		lc.Append(lifecycle.Hook{
+			Name: "health",
+			OnStart: func(ctx context.Context) error {
+				go registry.Watch(refreshCtx, cfg.Health.RefreshInterval)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				stopRefresh()
+				return nil
+			},
+		})
+	}
+
+	router := routering.NewRoutes(httpServer.GetApp(), db, &rdb, lc.Ready, lc.Stopping, watcher, registry, startup)
 	router.SetupRoutes()
 	httpServer.Router(router.App)
-	httpServer.Run()
+
+	lc.Append(lifecycle.Hook{
+		Name: "http",
+		OnStart: func(ctx context.Context) error {
+			go func() {
+				if err := httpServer.Run(); err != nil {
+					lc.Fail(err)
+				}
+			}()
+			return nil
+		},
+		OnStop: httpServer.Shutdown,
+	})
+
+	err = lc.Run(ctxs)
+	if err != nil {
+		logger.Error(ctxs, "Error to shutdown gracefully - "+err.Error())
+	}
 }
@@ -2,24 +2,38 @@ package routering
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/fsvxavier/default-vertical-slice/config"
+	adminHandlers "github.com/fsvxavier/default-vertical-slice/internal/features/admin/adapters/controllers/http"
 	handlers "github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/adapters/controllers/http"
+	"github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx"
 	"github.com/fsvxavier/default-vertical-slice/pkg/database/redis"
+	"github.com/fsvxavier/default-vertical-slice/pkg/health"
+	"github.com/fsvxavier/default-vertical-slice/pkg/httpserver/fiber/middleware"
 	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
 )
 
 type Routes struct {
-	App   *fiber.App
-	Db    *pgxpool.Pool
-	Redis *redis.Redigo
+	App      *fiber.App
+	Db       *gpgx.PgConnection
+	Redis    *redis.Redigo
+	Ready    func() bool
+	Stopping func() bool
+	Watcher  *config.Watcher
+	Health   *health.Registry
+	Startup  *health.Startup
 }
 
-func NewRoutes(app *fiber.App, db *pgxpool.Pool, rdb *redis.Redigo) Routes {
+func NewRoutes(app *fiber.App, db *gpgx.PgConnection, rdb *redis.Redigo, ready, stopping func() bool, watcher *config.Watcher, registry *health.Registry, startup *health.Startup) Routes {
 	return Routes{
-		App:   app,
-		Db:    db,
-		Redis: rdb,
+		App:      app,
+		Db:       db,
+		Redis:    rdb,
+		Ready:    ready,
+		Stopping: stopping,
+		Watcher:  watcher,
+		Health:   registry,
+		Startup:  startup,
 	}
 }
 
@@ -28,21 +42,42 @@ func (r Routes) SetupRoutes() {
 
 	// Health Routes
 	r.healthRoutes(router)
+
+	// Admin Routes
+	r.adminRoutes(router)
+}
+
+func (r Routes) adminRoutes(router fiber.Router) {
+	admin := router.Group("/admin", middleware.AdminAuth(func() string {
+		return r.Watcher.Current().Application.AdminToken.Value()
+	}))
+
+	cfgHandlers := adminHandlers.NewConfigController(r.Watcher.Current)
+
+	admin.Get("/config", cfgHandlers.GetConfig)
 }
 
 func (r Routes) healthRoutes(router fiber.Router) {
-	health := router.Group("/")
+	health := router.Group("/health")
 
-	hcHandlers := handlers.NewHealthCheckController(r.Db, r.Redis)
+	hcHandlers := handlers.NewHealthCheckController(r.Health, r.Startup, r.Ready, r.Stopping)
 
-	health.Get("/health", func(ctx *fiber.Ctx) error {
+	health.Get("/live", hcHandlers.GetLiveness)
+	health.Get("/ready", hcHandlers.GetReadiness)
+	health.Get("/startup", hcHandlers.GetStartup)
+	health.Get("/details", hcHandlers.GetDetails)
+
+	// Kept for the probes still configured with the X-Kubernetes-Probe header.
+	health.Get("/", func(ctx *fiber.Ctx) error {
 		logger.Debug(ctx.UserContext(), ctx.Get("X-Kubernetes-Probe"))
 
 		switch ctx.Get("X-Kubernetes-Probe") {
-		case "ready":
-			return hcHandlers.GetHealthcheck(ctx)
 		case "live":
-			return hcHandlers.GetHealthcheck(ctx)
+			return hcHandlers.GetLiveness(ctx)
+		case "ready":
+			return hcHandlers.GetReadiness(ctx)
+		case "startup":
+			return hcHandlers.GetStartup(ctx)
 		default:
 			return hcHandlers.GetHealthcheck(ctx)
 		}
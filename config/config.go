@@ -1,9 +1,8 @@
 package config
 
 import (
-	"os"
-
-	cstt "github.com/fsvxavier/default-vertical-slice/internal/features/commons/constants"
+	"fmt"
+	"time"
 )
 
 type Config struct {
@@ -14,28 +13,44 @@ type Config struct {
 	Log         `json:"log,omitempty"`
 	Http        `json:"http,omitempty"`
 	Redis       `json:"redis,omitempty"`
+	Health      `json:"health,omitempty"`
+
+	origins Origins
+	file    string
 }
 
 type Application struct {
-	Env            string `env:"ENV"             json:"env,omitempty"`
-	Name           string `env:"APP_NAME"        json:"app_name,omitempty"`
-	Path           string `env:"HOME"            json:"path,omitempty"`
-	AppVersion     string `env:"APP_VERSION"     json:"app_version,omitempty"`
-	Drivers        string `env:"EVENT_DRIVERS"   json:"drivers,omitempty"`
-	Port           string `env:"PORT"            json:"port,omitempty"`
-	GitCredentials string `env:"GIT_CREDENTIALS" json:"git_credentials,omitempty"`
-	Pprof          bool   `env:"PPROF_ENABLED"   json:"pprof,omitempty"`
+	Env            string        `env:"ENV"             envDefault:"dev" json:"env,omitempty"`
+	Name           string        `env:"APP_NAME"        json:"app_name,omitempty"`
+	Path           string        `env:"HOME"            json:"path,omitempty"`
+	AppVersion     string        `env:"APP_VERSION"     json:"app_version,omitempty"`
+	Drivers        string        `env:"EVENT_DRIVERS"   json:"drivers,omitempty"`
+	Port           string        `env:"PORT"            json:"port,omitempty"`
+	GitCredentials Secret        `env:"GIT_CREDENTIALS" json:"git_credentials,omitempty"`
+	AdminToken     Secret        `env:"ADMIN_TOKEN"     json:"admin_token,omitempty"`
+	ConfigDir      string        `env:"CONFIG_DIR"      envDefault:"config" json:"config_dir,omitempty"`
+	ConfigFile     string        `env:"CONFIG_FILE"     json:"config_file,omitempty"`
+	ConfigPoll     time.Duration `env:"CONFIG_POLL_INTERVAL" json:"config_poll_interval,omitempty"`
+	ErrorsFile     string        `env:"ERRORS_CATALOG_FILE" json:"errors_catalog_file,omitempty"`
+	Pprof          bool          `env:"PPROF_ENABLED"   json:"pprof,omitempty"`
 }
 
 type Http struct {
-	Port            string `env:"HTTP_PORT"              json:"http_port,omitempty"`
-	Host            string `env:"HTTP_HOST"              json:"http_host,omitempty"`
-	Network         string `env:"HTTP_NETWORK"           json:"http_network,omitempty"`
-	Concurrency     string `env:"HTTP_CONCURRENCY"       json:"http_concurrency,omitempty"`
-	Metrics         bool   `env:"HTTP_METRICS_ENABLED"   envDefault:"false"                json:"http_metrics_enabled,omitempty"`
-	Prefork         bool   `env:"HTTP_PREFORK"           envDefault:"false"                json:"http_prefork,omitempty"`
-	Rmu             bool   `env:"HTTP_RMU"               envDefault:"true"                 json:"http_rmu,omitempty"`
-	DisableStartMsg bool   `env:"HTTP_DISABLE_START_MSG" envDefault:"true"                 json:"http_disable_start_msg,omitempty"`
+	Port            string        `env:"HTTP_PORT"              json:"http_port,omitempty"`
+	Host            string        `env:"HTTP_HOST"              json:"http_host,omitempty"`
+	Network         string        `env:"HTTP_NETWORK"           json:"http_network,omitempty"`
+	Concurrency     string        `env:"HTTP_CONCURRENCY"       json:"http_concurrency,omitempty"`
+	ShutdownTimeout time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT"  envDefault:"30s"                  json:"http_shutdown_timeout,omitempty"`
+	ShutdownDelay   time.Duration `env:"HTTP_SHUTDOWN_DELAY"    envDefault:"0s"                   json:"http_shutdown_delay,omitempty"`
+	RateLimitRPM    int           `env:"RATE_LIMIT_REQUESTS_PER_MINUTE"      envDefault:"100" json:"rate_limit_requests_per_minute,omitempty"`
+	RateLimitLock   int           `env:"RATE_LIMIT_LOCK_DURATION_IN_MINUTES" envDefault:"1"   json:"rate_limit_lock_duration_in_minutes,omitempty"`
+	Metrics         bool          `env:"HTTP_METRICS_ENABLED"   envDefault:"false"                json:"http_metrics_enabled,omitempty"`
+	Prefork         bool          `env:"HTTP_PREFORK"           envDefault:"false"                json:"http_prefork,omitempty"`
+	Rmu             bool          `env:"HTTP_RMU"               envDefault:"true"                 json:"http_rmu,omitempty"`
+	DisableStartMsg bool          `env:"HTTP_DISABLE_START_MSG" envDefault:"true"                 json:"http_disable_start_msg,omitempty"`
+	RateLimit       bool          `env:"HTTP_RATE_LIMIT_ENABLE" json:"http_rate_limit_enable,omitempty"`
+	Prometheus      bool          `env:"PROMETHEUS_ENABLED"     json:"prometheus_enabled,omitempty"`
+	ClientTrace     bool          `env:"REQ_TRACE_ENABLE"       json:"req_trace_enable,omitempty"`
 }
 
 type Datadog struct {
@@ -58,165 +73,185 @@ type Log struct {
 }
 
 type Database struct {
-	Connection  Connection `json:"connection"`
-	Driver      string     `env:"DB_DIVER"               json:"db_driver,omitempty"`
-	Type        string     `env:"DB_TYPE"                json:"db_type,omitempty"`
-	MaxConns    string     `env:"DB_MAX_CONNS"           json:"db_max_conns,omitempty"`
-	QueryTracer bool       `env:"DB_QUERY_TRACER"        json:"db_query_tracer,omitempty"`
-	MultiTenant bool       `env:"DB_MULTI_TENANT_ENABLE" json:"db_multi_tenant,omitempty"`
-	Ping        bool       `env:"DB_EXECUTE_PING"        json:"db_execute_ping,omitempty"`
+	Connection    Connection    `json:"connection"`
+	Driver        string        `env:"DB_DIVER"               json:"db_driver,omitempty"`
+	Type          string        `env:"DB_TYPE"                json:"db_type,omitempty"`
+	LifeTimeConns time.Duration `env:"DB_LIFE_TIME_CONNS"     envDefault:"3600s" json:"db_life_time_conns,omitempty"`
+	IdleTimeConns time.Duration `env:"DB_IDLE_TIME_CONNS"     envDefault:"120s"  json:"db_idle_time_conns,omitempty"`
+	MaxConns      int32         `env:"DB_MAX_CONNS"           envDefault:"20"    json:"db_max_conns,omitempty"`
+	MinConns      int32         `env:"DB_MIN_CONNS"           envDefault:"1"     json:"db_min_conns,omitempty"`
+	QueryTracer   bool          `env:"DB_QUERY_TRACER"        json:"db_query_tracer,omitempty"`
+	MultiTenant   bool          `env:"DB_MULTI_TENANT_ENABLE" json:"db_multi_tenant,omitempty"`
+	Ping          bool          `env:"DB_EXECUTE_PING"        json:"db_execute_ping,omitempty"`
+	Replica       Replica       `json:"replica"`
+	Retry         Retry         `json:"retry"`
+	Migrations    Migrations    `json:"migrations"`
+	Outbox        Outbox        `json:"outbox"`
+	Tenancy       Tenancy       `json:"tenancy"`
+	SlowQuery     SlowQuery     `json:"slow_query"`
+}
+
+// Tenancy configures how the tenants are isolated once DB_MULTI_TENANT_ENABLE is set:
+// rls, schema or pool.
+type Tenancy struct {
+	Strategy     string `env:"DB_TENANCY_STRATEGY"     envDefault:"rls"     json:"db_tenancy_strategy,omitempty"`
+	SchemaPrefix string `env:"DB_TENANT_SCHEMA_PREFIX" envDefault:"tenant_" json:"db_tenant_schema_prefix,omitempty"`
+	// Urls lists the database of every tenant of the pool strategy as tenant=url.
+	Urls      []Secret `env:"DB_TENANT_URLS"       json:"db_tenant_urls,omitempty"`
+	PoolLimit int      `env:"DB_TENANT_POOL_LIMIT" envDefault:"20" json:"db_tenant_pool_limit,omitempty"`
+}
+
+// Outbox configures the relay publishing the outbox events to Redis streams.
+type Outbox struct {
+	Table        string        `env:"DB_OUTBOX_TABLE"         envDefault:"outbox"  json:"db_outbox_table,omitempty"`
+	StreamPrefix string        `env:"DB_OUTBOX_STREAM_PREFIX" envDefault:"events:" json:"db_outbox_stream_prefix,omitempty"`
+	BatchSize    int           `env:"DB_OUTBOX_BATCH_SIZE"    envDefault:"100"     json:"db_outbox_batch_size,omitempty"`
+	MaxAttempts  int           `env:"DB_OUTBOX_MAX_ATTEMPTS"  envDefault:"10"      json:"db_outbox_max_attempts,omitempty"`
+	PollInterval time.Duration `env:"DB_OUTBOX_POLL_INTERVAL" envDefault:"1s"      json:"db_outbox_poll_interval,omitempty"`
+	Retention    time.Duration `env:"DB_OUTBOX_RETENTION"     envDefault:"168h"    json:"db_outbox_retention,omitempty"`
+	Enabled      bool          `env:"DB_OUTBOX_ENABLED"       json:"db_outbox_enabled,omitempty"`
+}
+
+type Migrations struct {
+	Dir   string `env:"DB_MIGRATIONS_DIR"   envDefault:"migrations"             json:"db_migrations_dir,omitempty"`
+	Table string `env:"DB_MIGRATIONS_TABLE" envDefault:"gpgx_schema_migrations" json:"db_migrations_table,omitempty"`
+	// OnStartup applies the pending migrations before the webserver serves requests.
+	OnStartup bool `env:"DB_MIGRATE_ON_STARTUP" json:"db_migrate_on_startup,omitempty"`
+}
+
+// SlowQuery configures the log of the statements lasting Threshold or more, zero
+// disabling it. Explain adds their plan, only honored in the dev environment.
+type SlowQuery struct {
+	Threshold time.Duration `env:"DB_SLOW_QUERY_THRESHOLD" envDefault:"500ms" json:"db_slow_query_threshold,omitempty"`
+	Explain   bool          `env:"DB_SLOW_QUERY_EXPLAIN"   json:"db_slow_query_explain,omitempty"`
+}
+
+// Retry configures how statements failing with transient errors are run again.
+type Retry struct {
+	MaxAttempts int           `env:"DB_RETRY_MAX_ATTEMPTS" envDefault:"3"    json:"db_retry_max_attempts,omitempty"`
+	Backoff     time.Duration `env:"DB_RETRY_BACKOFF"      envDefault:"50ms" json:"db_retry_backoff,omitempty"`
+	MaxBackoff  time.Duration `env:"DB_RETRY_MAX_BACKOFF"  envDefault:"2s"   json:"db_retry_max_backoff,omitempty"`
+}
+
+// Replica configures the read replicas, disabled while Urls is empty.
+type Replica struct {
+	Urls          []Secret      `env:"DB_REPLICA_URLS"           json:"db_replica_urls,omitempty"`
+	Strategy      string        `env:"DB_REPLICA_STRATEGY"       envDefault:"round_robin" json:"db_replica_strategy,omitempty"`
+	MaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG"        envDefault:"10s"         json:"db_replica_max_lag,omitempty"`
+	CheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" envDefault:"5s"          json:"db_replica_check_interval,omitempty"`
 }
 
 type Redis struct {
-	MaxIdleConns     string `env:"RDB_MAX_IDLE_CONNS"   json:"rdb_max_idle_conns,omitempty"`
-	ClientName       string `env:"RDB_CLIENT_NAME"      json:"rdb_client_name,omitempty"`
-	Username         string `env:"RDB_USERNAME"         json:"rdb_username,omitempty"`
-	Password         string `env:"RDB_PASSWORD"         json:"rdb_password,omitempty"`
-	MaxRetries       string `env:"RDB_MAX_RETRIES"      json:"rdb_max_retries,omitempty"`
-	MinIdleConns     string `env:"RDB_MIN_IDLE_CONNS"   json:"rdb_min_idle_conns,omitempty"`
-	Addresses        string `env:"RDB_ADDRESSES"        json:"rdb_addresses,omitempty"`
-	MaxActiveConns   string `env:"RDB_MAX_ACTIVE_CONNS" json:"rdb_max_active_conns,omitempty"`
-	PoolSize         string `env:"RDB_POOL_SIZE"        json:"rdb_pool_size,omitempty"`
-	DatabaseDefault  string `env:"RDB_DATABASE_DEFAULT" json:"rdb_database_default,omitempty"`
-	TraceServiceName string `env:"RDB_DD_SERVICE_DB"    json:"rdb_dd_service_db,omitempty"`
-	Ping             bool   `env:"RDB_EXECUTE_PING"     json:"rdb_execute_ping,omitempty"`
-	UsageTLS         bool   `env:"RDB_USAGE_TLS"        json:"rdb_usage_tls,omitempty"`
+	ClientName       string   `env:"RDB_CLIENT_NAME"      envDefault:"munin-exchange-rate-api" json:"rdb_client_name,omitempty"`
+	Username         string   `env:"RDB_USERNAME"         json:"rdb_username,omitempty"`
+	Password         Secret   `env:"RDB_PASSWORD"         json:"rdb_password,omitempty"`
+	TraceServiceName string   `env:"RDB_DD_SERVICE_DB"    json:"rdb_dd_service_db,omitempty"`
+	Addresses        []string `env:"RDB_ADDRESSES,required" json:"rdb_addresses,omitempty"`
+	MaxIdleConns     int      `env:"RDB_MAX_IDLE_CONNS"   envDefault:"300"                     json:"rdb_max_idle_conns,omitempty"`
+	MaxRetries       int      `env:"RDB_MAX_RETRIES"      json:"rdb_max_retries,omitempty"`
+	MinIdleConns     int      `env:"RDB_MIN_IDLE_CONNS"   json:"rdb_min_idle_conns,omitempty"`
+	MaxActiveConns   int      `env:"RDB_MAX_ACTIVE_CONNS" envDefault:"1000"                    json:"rdb_max_active_conns,omitempty"`
+	PoolSize         int      `env:"RDB_POOL_SIZE"        json:"rdb_pool_size,omitempty"`
+	Database         int      `env:"RDB_DATABASE"         envDefault:"0"                       json:"rdb_database,omitempty"`
+	DatabaseDefault  int      `env:"RDB_DATABASE_DEFAULT" json:"rdb_database_default,omitempty"`
+	Ping             bool     `env:"RDB_EXECUTE_PING"     json:"rdb_execute_ping,omitempty"`
+	UsageTLS         bool     `env:"RDB_USAGE_TLS"        json:"rdb_usage_tls,omitempty"`
 }
 
 type Connection struct {
-	Url      string `env:"DB_URL"      json:"db_url,omitempty"`
+	Url      Secret `env:"DB_URL"      json:"db_url,omitempty"`
 	Host     string `env:"DB_HOST"     json:"db_host,omitempty"`
 	Port     string `env:"DB_PORT"     json:"db_port,omitempty"`
 	Username string `env:"DB_USERNAME" json:"db_username,omitempty"`
-	Password string `env:"DB_PASSWORD" json:"db_password,omitempty"`
+	Password Secret `env:"DB_PASSWORD" json:"db_password,omitempty"`
 	DbName   string `env:"DB_NAME"     json:"db_name,omitempty"`
 	Schema   string `env:"DB_SCHEMA"   json:"db_schema,omitempty"`
 }
 
+type Health struct {
+	Timeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s" json:"health_check_timeout,omitempty"`
+	// CacheTTL is how long a check result is served to the probes before checking again.
+	CacheTTL time.Duration `env:"HEALTH_CACHE_TTL" envDefault:"5s" json:"health_cache_ttl,omitempty"`
+	// RefreshInterval enables refreshing the checks in background, disabled when zero.
+	RefreshInterval time.Duration `env:"HEALTH_REFRESH_INTERVAL" json:"health_refresh_interval,omitempty"`
+	// HttpChecks declares remote dependencies as name=url entries, checked as degraded.
+	HttpChecks []string `env:"HEALTH_HTTP_CHECKS" json:"health_http_checks,omitempty"`
+}
+
 type Aws struct {
 	Profile string `env:"AWS_PROFILE" json:"aws_profile"`
 	Region  string `env:"AWS_REGION"  json:"aws_region"`
 }
 
-func NewConfig() *Config {
-	application := cfgApplication()
-	log := cfgLog()
-	database := cfgDatabase()
-	http := cfgHttp()
-	aws := cfgAws()
-	datadog := cfgDatadog()
-	redis := cfgRedis()
-
-	return &Config{
-		Application: *application,
-		Log:         *log,
-		Database:    *database,
-		Http:        *http,
-		Aws:         *aws,
-		Datadog:     *datadog,
-		Redis:       *redis,
-	}
-}
+// NewConfig loads the configuration merging, from the lowest to the highest precedence,
+// the struct tag defaults, the <CONFIG_DIR>/<ENV>.yaml|.yml|.json file (or CONFIG_FILE),
+// the environment variables and the command line flags in args. Every missing or
+// malformed variable is reported in the returned error.
+func NewConfig(args ...string) (*Config, error) {
+	cfg := &Config{}
 
-func cfgApplication() *Application {
-	return &Application{
-		Env:            os.Getenv("ENV"),
-		Name:           os.Getenv("APP_NAME"),
-		Path:           os.Getenv("HOME"),
-		AppVersion:     os.Getenv("APP_VERSION"),
-		Drivers:        os.Getenv("EVENT_DRIVERS"),
-		Port:           os.Getenv("PORT"),
-		GitCredentials: os.Getenv("GIT_CREDENTIALS"),
-		Pprof:          os.Getenv("PPROF_ENABLED") == cstt.STR_TRUE,
+	flags, err := NewFlagSource(cfg, args)
+	if err != nil {
+		return nil, err
 	}
-}
+	env := NewEnvSource()
 
-func cfgLog() *Log {
-	return &Log{
-		Level:   os.Getenv("LOG_LEVEL"),
-		Enabled: os.Getenv("DD_APM_ENABLED") == cstt.STR_TRUE,
+	// The file is chosen before it is read, so only the environment and the flags can select it.
+	boot := &Application{}
+	if _, err := LoadFrom(boot, env, flags); err != nil {
+		return nil, err
 	}
-}
 
-func cfgDatabase() *Database {
-	cfgDatabase := Database{
-		Driver:      os.Getenv("DB_DIVER"),
-		Type:        os.Getenv("DB_TYPE"),
-		MaxConns:    os.Getenv("DB_MAX_CONNS"),
-		QueryTracer: os.Getenv("DB_QUERY_TRACER") == cstt.STR_TRUE,
-		MultiTenant: os.Getenv("DB_MULTI_TENANT_ENABLE") == cstt.STR_TRUE,
-		Ping:        os.Getenv("DB_EXECUTE_PING") == cstt.STR_TRUE,
-	}
+	sources := make([]Source, 0, 3)
 
-	// Database config from separate parameters
-	dbh := os.Getenv("DB_HOST")
-	if len(dbh) > 0 {
-		cfgDatabase.Connection = Connection{
-			Host:     os.Getenv("DB_HOST"),
-			Port:     os.Getenv("DB_PORT"),
-			Username: os.Getenv("DB_USERNAME"),
-			Password: os.Getenv("DB_PASSWORD"),
-			DbName:   os.Getenv("DB_NAME"),
-			Schema:   os.Getenv("DB_SCHEMA"),
+	path := boot.ConfigFile
+	if path == "" {
+		path = FindEnvFile(boot.ConfigDir, boot.Env)
+	}
+	if path != "" {
+		file, err := NewFileSource(path)
+		if err != nil {
+			return nil, err
 		}
-
-		str := "postgres://${DB_USERNAME}:${DB_PASSWORD}@${DB_HOST}:${DB_PORT}/${DB_NAME}?sslmode=disable&search_path=${DB_SCHEMA}"
-		cfgDatabase.Connection.Url = os.ExpandEnv(str)
+		sources = append(sources, file)
+		cfg.file = path
 	}
 
-	return &cfgDatabase
-}
+	sources = append(sources, env, flags)
 
-func cfgHttp() *Http {
-	return &Http{
-		Port:            os.Getenv("HTTP_PORT"),
-		Host:            os.Getenv("HTTP_HOST"),
-		Network:         os.Getenv("HTTP_NETWORK"),
-		Concurrency:     os.Getenv("HTTP_CONCURRENCY"),
-		Metrics:         os.Getenv("HTTP_METRICS_ENABLED") == cstt.STR_TRUE,
-		Prefork:         os.Getenv("HTTP_PREFORK") == cstt.STR_TRUE,
-		Rmu:             os.Getenv("HTTP_RMU") == cstt.STR_TRUE,
-		DisableStartMsg: os.Getenv("HTTP_DISABLE_START_MSG") == cstt.STR_TRUE,
+	cfg.origins, err = LoadFrom(cfg, sources...)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func cfgAws() *Aws {
-	return &Aws{
-		Region:  os.Getenv("AWS_REGION"),
-		Profile: os.Getenv("AWS_PROFILE"),
+	if cfg.Database.Connection.compose() {
+		cfg.origins["DB_URL"] = OriginComposed
 	}
+
+	return cfg, nil
 }
 
-func cfgDatadog() *Datadog {
-	return &Datadog{
-		Service:       os.Getenv("DD_SERVICE"),
-		ServiceDb:     os.Getenv("DD_SERVICE_DB"),
-		Env:           os.Getenv("DD_ENV"),
-		Version:       os.Getenv("DD_VERSION"),
-		AgentHost:     os.Getenv("DD_AGENT_HOST"),
-		AgentPort:     os.Getenv("DD_TRACE_AGENT_PORT"),
-		Enabled:       os.Getenv("DATADOG_ENABLED") == cstt.STR_TRUE,
-		Profile:       os.Getenv("DATADOG_PROFILE") == cstt.STR_TRUE,
-		ApmEnable:     os.Getenv("DD_APM_ENABLED") == cstt.STR_TRUE,
-		LogsInjection: os.Getenv("DD_LOGS_INJECTION") == cstt.STR_TRUE,
-		TraceEnable:   os.Getenv("DD_TRACE_ENABLED") == cstt.STR_TRUE,
-	}
+// Origins reports which source supplied each variable: "default", "file:<path>", "env",
+// "flag" or "composed". Variables left unset are absent.
+func (c *Config) Origins() Origins {
+	return c.origins
 }
 
-func cfgRedis() *Redis {
-	return &Redis{
-		Addresses:        os.Getenv("RDB_ADDRESSES"),
-		ClientName:       os.Getenv("RDB_CLIENT_NAME"),
-		Username:         os.Getenv("RDB_USERNAME"),
-		Password:         os.Getenv("RDB_PASSWORD"),
-		MaxRetries:       os.Getenv("RDB_MAX_RETRIES"),
-		MinIdleConns:     os.Getenv("RDB_MIN_IDLE_CONNS"),
-		MaxIdleConns:     os.Getenv("RDB_MAX_IDLE_CONNS"),
-		MaxActiveConns:   os.Getenv("RDB_MAX_ACTIVE_CONNS"),
-		DatabaseDefault:  os.Getenv("RDB_DATABASE_DEFAULT"),
-		PoolSize:         os.Getenv("RDB_POOL_SIZE"),
-		Ping:             os.Getenv("RDB_EXECUTE_PING") == cstt.STR_TRUE,
-		UsageTLS:         os.Getenv("RDB_USAGE_TLS") == cstt.STR_TRUE,
-		TraceServiceName: os.Getenv("RDB_DD_SERVICE_DB"),
+// File returns the configuration file that was loaded, if any.
+func (c *Config) File() string {
+	return c.file
+}
+
+// compose builds the connection url when the database is configured from separate parameters.
+func (c *Connection) compose() bool {
+	if c.Host == "" {
+		return false
 	}
+
+	c.Url = Secret(fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s",
+		c.Username, c.Password.Value(), c.Host, c.Port, c.DbName, c.Schema,
+	))
+
+	return true
 }
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tagEnv          = "env"
+	tagEnvDefault   = "envDefault"
+	tagEnvSeparator = "envSeparator"
+
+	optRequired = "required"
+
+	defaultSeparator = ","
+)
+
+var (
+	ErrMissing     = errors.New("required variable is not set")
+	ErrUnsupported = errors.New("unsupported field type")
+
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FieldError describes a single variable that could not be loaded into its field.
+type FieldError struct {
+	Err   error
+	Key   string
+	Field string
+	Value string
+}
+
+func (fe *FieldError) Error() string {
+	if errors.Is(fe.Err, ErrMissing) {
+		return fmt.Sprintf("%s (%s): %s", fe.Key, fe.Field, fe.Err.Error())
+	}
+	return fmt.Sprintf("%s (%s): invalid value %q: %s", fe.Key, fe.Field, fe.Value, fe.Err.Error())
+}
+
+func (fe *FieldError) Unwrap() error {
+	return fe.Err
+}
+
+// LoadError aggregates every FieldError found while loading a struct.
+type LoadError struct {
+	Fields []*FieldError
+}
+
+func (le *LoadError) Error() string {
+	msgs := make([]string, 0, len(le.Fields))
+	for _, fe := range le.Fields {
+		msgs = append(msgs, fe.Error())
+	}
+	return "config: " + strings.Join(msgs, "; ")
+}
+
+func (le *LoadError) Unwrap() []error {
+	errs := make([]error, 0, len(le.Fields))
+	for _, fe := range le.Fields {
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+// Origins maps each variable key to the name of the source that supplied its value.
+type Origins map[string]string
+
+const OriginDefault = "default"
+
+// Load fills dst, a pointer to a struct, from the environment honoring the `env`,
+// `envDefault` and `envSeparator` struct tags. Nested and embedded structs without an
+// `env` tag are loaded recursively. An `env:"NAME,required"` field without value nor
+// default is reported as missing. All problems are returned together in a *LoadError.
+func Load(dst any) error {
+	_, err := LoadFrom(dst, NewEnvSource())
+	return err
+}
+
+// LoadFrom is like Load but reads the variables from sources, ordered from the lowest
+// to the highest precedence, on top of the `envDefault` values. The returned Origins
+// tells which source supplied each loaded variable.
+func LoadFrom(dst any, sources ...Source) (Origins, error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: destination must be a non nil pointer to struct, got %T", dst)
+	}
+
+	origins := make(Origins)
+	var errs []*FieldError
+
+	walk(rv.Elem(), "", func(fd field) {
+		value, origin := resolve(fd, sources)
+		if origin == "" {
+			if fd.required {
+				errs = append(errs, &FieldError{Key: fd.key, Field: fd.name, Err: ErrMissing})
+			}
+			return
+		}
+
+		origins[fd.key] = origin
+
+		if err := setValue(fd.value, value, fd.separator); err != nil {
+			errs = append(errs, &FieldError{Key: fd.key, Field: fd.name, Value: value, Err: err})
+		}
+	})
+
+	if len(errs) > 0 {
+		return origins, &LoadError{Fields: errs}
+	}
+
+	return origins, nil
+}
+
+// resolve returns the value of the field from the source with the highest precedence,
+// falling back to its default. Empty values are considered unset.
+func resolve(fd field, sources []Source) (value, origin string) {
+	for i := len(sources) - 1; i >= 0; i-- {
+		if v, ok := sources[i].Lookup(fd.key); ok && v != "" {
+			return v, sources[i].Name()
+		}
+	}
+
+	if fd.hasDefault && fd.defaultValue != "" {
+		return fd.defaultValue, OriginDefault
+	}
+
+	return "", ""
+}
+
+// field is a struct field bound to a variable through the `env` tag.
+type field struct {
+	value        reflect.Value
+	key          string
+	name         string
+	defaultValue string
+	separator    string
+	hasDefault   bool
+	required     bool
+}
+
+// walk calls fn for every field tagged with `env`, recursing into nested structs.
+func walk(rv reflect.Value, prefix string, fn func(fd field)) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := sf.Name
+		if prefix != "" {
+			name = prefix + "." + sf.Name
+		}
+
+		tag, hasTag := sf.Tag.Lookup(tagEnv)
+		if !hasTag || tag == "" {
+			if fv.Kind() == reflect.Struct && !isLeaf(fv) {
+				walk(fv, name, fn)
+			}
+			continue
+		}
+
+		key, opts := parseTag(tag)
+		defaultValue, hasDefault := sf.Tag.Lookup(tagEnvDefault)
+
+		sep := defaultSeparator
+		if s, ok := sf.Tag.Lookup(tagEnvSeparator); ok && s != "" {
+			sep = s
+		}
+
+		fn(field{
+			value:        fv,
+			key:          key,
+			name:         name,
+			defaultValue: defaultValue,
+			hasDefault:   hasDefault,
+			separator:    sep,
+			required:     opts[optRequired],
+		})
+	}
+}
+
+func parseTag(tag string) (key string, opts map[string]bool) {
+	parts := strings.Split(tag, ",")
+	opts = make(map[string]bool, len(parts)-1)
+	for _, opt := range parts[1:] {
+		opts[strings.TrimSpace(opt)] = true
+	}
+	return strings.TrimSpace(parts[0]), opts
+}
+
+// isLeaf reports whether a struct value must be decoded as a single value instead of recursed.
+func isLeaf(fv reflect.Value) bool {
+	return fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType)
+}
+
+func setValue(fv reflect.Value, raw, sep string) error {
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	if fv.Type() == durationType {
+		d, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(raw), 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(raw), fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		items := strings.Split(raw, sep)
+		slice := reflect.MakeSlice(fv.Type(), 0, len(items))
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if err := setValue(elem, item, sep); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		fv.Set(slice)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupported, fv.Type())
+	}
+
+	return nil
+}
+
+// parseDuration accepts Go durations ("90s", "1m30s") and, for compatibility with the
+// variables already deployed, a bare number of seconds ("3600").
+func parseDuration(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(raw)
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFromTypedFields(t *testing.T) {
+	type nested struct {
+		Host string `env:"NESTED_HOST" envDefault:"localhost"`
+	}
+	type target struct {
+		Nested   nested
+		Name     string        `env:"NAME"`
+		Hosts    []string      `env:"HOSTS"`
+		Ports    []int         `env:"PORTS"    envSeparator:";"`
+		Timeout  time.Duration `env:"TIMEOUT"`
+		Lifetime time.Duration `env:"LIFETIME"`
+		Conns    int32         `env:"CONNS"    envDefault:"20"`
+		Ratio    float64       `env:"RATIO"`
+		Enabled  bool          `env:"ENABLED"  envDefault:"true"`
+	}
+
+	var cfg target
+	_, err := LoadFrom(&cfg, NewMapSource("test", map[string]string{
+		"NAME":     "api",
+		"HOSTS":    "a:6379, b:6379",
+		"PORTS":    "1;2;3",
+		"TIMEOUT":  "1m30s",
+		"LIFETIME": "3600",
+		"RATIO":    "0.5",
+		"ENABLED":  "",
+	}))
+	require.NoError(t, err)
+
+	require.Equal(t, "api", cfg.Name)
+	require.Equal(t, []string{"a:6379", "b:6379"}, cfg.Hosts)
+	require.Equal(t, []int{1, 2, 3}, cfg.Ports)
+	require.Equal(t, 90*time.Second, cfg.Timeout)
+	require.Equal(t, time.Hour, cfg.Lifetime)
+	require.Equal(t, int32(20), cfg.Conns)
+	require.Equal(t, 0.5, cfg.Ratio)
+	require.True(t, cfg.Enabled)
+	require.Equal(t, "localhost", cfg.Nested.Host)
+}
+
+func TestLoadFromAggregatesErrors(t *testing.T) {
+	type target struct {
+		Addresses []string      `env:"ADDRESSES,required"`
+		Conns     int           `env:"CONNS"`
+		Timeout   time.Duration `env:"TIMEOUT"`
+		Enabled   bool          `env:"ENABLED"`
+	}
+
+	var cfg target
+	_, err := LoadFrom(&cfg, NewMapSource("test", map[string]string{
+		"CONNS":   "twenty",
+		"TIMEOUT": "soon",
+		"ENABLED": "yes please",
+	}))
+
+	var loadErr *LoadError
+	require.True(t, errors.As(err, &loadErr))
+	require.Len(t, loadErr.Fields, 4)
+	require.ErrorIs(t, err, ErrMissing)
+	require.Equal(t, "ADDRESSES", loadErr.Fields[0].Key)
+	require.Contains(t, err.Error(), `CONNS (Conns): invalid value "twenty"`)
+}
+
+func TestNewConfigHonorsTags(t *testing.T) {
+	t.Setenv("RDB_ADDRESSES", "localhost:6379")
+	t.Setenv("DD_ENABLED", "false")
+	t.Setenv("DB_MAX_CONNS", "")
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USERNAME", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "app")
+	t.Setenv("DB_SCHEMA", "public")
+
+	cfg, err := NewConfig()
+	require.NoError(t, err)
+
+	require.False(t, cfg.Datadog.Enabled)
+	require.Equal(t, int32(20), cfg.Database.MaxConns)
+	require.Equal(t, []string{"localhost:6379"}, cfg.Redis.Addresses)
+	require.Equal(t, "postgres://user:pass@db:5432/app?sslmode=disable&search_path=public", cfg.Database.Connection.Url.Value())
+}
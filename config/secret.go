@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const secretMask = "******"
+
+// Secret is a string that never shows its value when formatted, marshaled to JSON or
+// logged through zap. Use Value to read it.
+type Secret string
+
+// Value returns the secret in clear text.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return secretMask
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Variable describes the effective value of a configuration variable.
+type Variable struct {
+	Key    string `json:"key"`
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Source string `json:"source,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// Describe lists every variable of cfg, sorted by key, with the source that supplied it.
+// Values of Secret fields are masked.
+func Describe(cfg *Config) []Variable {
+	origins := cfg.Origins()
+	seen := make(map[string]bool)
+	vars := make([]Variable, 0)
+
+	walk(reflect.ValueOf(cfg).Elem(), "", func(fd field) {
+		if seen[fd.key] {
+			return
+		}
+		seen[fd.key] = true
+
+		secret := isSecret(fd.value.Type())
+		value := formatValue(fd.value)
+		if secret && value != "" {
+			value = secretMask
+		}
+
+		vars = append(vars, Variable{
+			Key:    fd.key,
+			Field:  fd.name,
+			Value:  value,
+			Source: origins[fd.key],
+			Secret: secret,
+		})
+	})
+
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+
+	return vars
+}
+
+func isSecret(rt reflect.Type) bool {
+	return rt == secretType || (rt.Kind() == reflect.Slice && rt.Elem() == secretType)
+}
+
+// formatValue renders a field in clear text, the way it would be written in a variable.
+func formatValue(fv reflect.Value) string {
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String()
+	case reflect.Slice:
+		items := make([]string, 0, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			items = append(items, formatValue(fv.Index(i)))
+		}
+		return strings.Join(items, defaultSeparator)
+	default:
+		return fmt.Sprint(fv.Interface())
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSecretIsMasked(t *testing.T) {
+	conn := Connection{Username: "user", Password: "s3cr3t", Url: "postgres://user:s3cr3t@db/app"}
+
+	data, err := json.Marshal(conn)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "s3cr3t")
+	require.Contains(t, string(data), `"db_password":"******"`)
+
+	for _, format := range []string{"%v", "%+v", "%s", "%#v"} {
+		require.NotContains(t, fmt.Sprintf(format, conn), "s3cr3t", format)
+	}
+
+	var buf bytes.Buffer
+	log := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel))
+	log.Info("config", zap.Any("connection", conn), zap.Any("password", conn.Password), zap.Stringer("url", conn.Url))
+	require.NotContains(t, buf.String(), "s3cr3t")
+
+	require.Equal(t, "s3cr3t", conn.Password.Value())
+	require.Equal(t, "", Secret("").String())
+}
+
+func TestDescribeReportsSourcesAndMasksSecrets(t *testing.T) {
+	t.Setenv("RDB_ADDRESSES", "localhost:6379")
+	t.Setenv("RDB_PASSWORD", "redis-pass")
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USERNAME", "user")
+	t.Setenv("DB_PASSWORD", "db-pass")
+	t.Setenv("DB_NAME", "app")
+	t.Setenv("DB_SCHEMA", "public")
+	t.Setenv("DB_REPLICA_URLS", "postgres://user:replica-pass@r1/app,postgres://user:replica-pass@r2/app")
+
+	cfg, err := NewConfig("--db-max-conns", "40")
+	require.NoError(t, err)
+
+	vars := make(map[string]Variable)
+	for _, v := range Describe(cfg) {
+		require.NotContains(t, v.Value, "pass", v.Key)
+		vars[v.Key] = v
+	}
+
+	require.Equal(t, Variable{Key: "DB_PASSWORD", Field: "Database.Connection.Password", Value: secretMask, Source: OriginEnv, Secret: true}, vars["DB_PASSWORD"])
+	require.Equal(t, secretMask, vars["RDB_PASSWORD"].Value)
+	require.True(t, vars["DB_REPLICA_URLS"].Secret)
+	require.Len(t, cfg.Database.Replica.Urls, 2)
+	require.Equal(t, OriginComposed, vars["DB_URL"].Source)
+	require.True(t, vars["DB_URL"].Secret)
+	require.Equal(t, Variable{Key: "DB_MAX_CONNS", Field: "Database.MaxConns", Value: "40", Source: OriginFlag}, vars["DB_MAX_CONNS"])
+	require.Equal(t, OriginDefault, vars["DB_MIN_CONNS"].Source)
+	require.Equal(t, "", vars["GIT_CREDENTIALS"].Value)
+}
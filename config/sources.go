@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OriginEnv      = "env"
+	OriginFlag     = "flag"
+	OriginComposed = "composed"
+)
+
+// Source supplies raw variable values to LoadFrom.
+type Source interface {
+	// Name identifies the source in the Origins report.
+	Name() string
+	// Lookup returns the raw value of key and whether the source defines it.
+	Lookup(key string) (string, bool)
+}
+
+// MapSource is a Source backed by a map of variable keys to values.
+type MapSource struct {
+	Values map[string]string
+	Label  string
+}
+
+func NewMapSource(label string, values map[string]string) *MapSource {
+	return &MapSource{Label: label, Values: values}
+}
+
+func (ms *MapSource) Name() string {
+	return ms.Label
+}
+
+func (ms *MapSource) Lookup(key string) (string, bool) {
+	v, ok := ms.Values[key]
+	return v, ok
+}
+
+type envSource struct{}
+
+// NewEnvSource returns a Source reading the process environment.
+func NewEnvSource() Source {
+	return envSource{}
+}
+
+func (envSource) Name() string {
+	return OriginEnv
+}
+
+func (envSource) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+// NewFileSource reads a YAML or JSON file. Keys are the variable names, case insensitive,
+// and nested objects are flattened joining their keys with "_", so both
+//
+//	DB_MAX_CONNS: 40
+//
+// and
+//
+//	db:
+//	  max_conns: 40
+//
+// define DB_MAX_CONNS. Lists are joined with ",".
+func NewFileSource(path string) (*MapSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	// JSON is a subset of YAML, so a single decoder handles both formats.
+	if err := yaml.Unmarshal(data, &raw); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", raw, values)
+
+	return NewMapSource("file:"+path, values), nil
+}
+
+func flatten(prefix string, node map[string]any, values map[string]string) {
+	for k, v := range node {
+		key := strings.ToUpper(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, values)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, defaultSeparator)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// FindEnvFile returns the first <dir>/<env>.yaml, .yml or .json file that exists, or an
+// empty string when there is none.
+func FindEnvFile(dir, env string) string {
+	if env == "" {
+		return ""
+	}
+
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		path := filepath.Join(dir, env+ext)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// NewFlagSource registers one flag per variable declared in dst, named after the
+// variable in lower kebab case (DB_MAX_CONNS becomes --db-max-conns), and parses args.
+// Only the flags present in args are defined by the returned source.
+func NewFlagSource(dst any, args []string) (*MapSource, error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: destination must be a non nil pointer to struct, got %T", dst)
+	}
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	keys := make(map[string]string)
+	walk(rv.Elem(), "", func(fd field) {
+		name := FlagName(fd.key)
+		if fs.Lookup(name) != nil {
+			return
+		}
+		keys[name] = fd.key
+		fs.String(name, fd.defaultValue, fmt.Sprintf("overrides %s (%s)", fd.key, fd.name))
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	values := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		values[keys[f.Name]] = f.Value.String()
+	})
+
+	return NewMapSource(OriginFlag, values), nil
+}
+
+// FlagName returns the command line flag bound to a variable key.
+func FlagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFromPrecedence(t *testing.T) {
+	type target struct {
+		A string `env:"A" envDefault:"default"`
+		B string `env:"B" envDefault:"default"`
+		C string `env:"C" envDefault:"default"`
+		D string `env:"D" envDefault:"default"`
+	}
+
+	var cfg target
+	origins, err := LoadFrom(&cfg,
+		NewMapSource("file:dev.yaml", map[string]string{"B": "file", "C": "file", "D": "file"}),
+		NewMapSource(OriginEnv, map[string]string{"C": "env", "D": "env"}),
+		NewMapSource(OriginFlag, map[string]string{"D": "flag"}),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, target{A: "default", B: "file", C: "env", D: "flag"}, cfg)
+	require.Equal(t, Origins{"A": OriginDefault, "B": "file:dev.yaml", "C": OriginEnv, "D": OriginFlag}, origins)
+}
+
+func TestNewFileSourceFlattensYAMLAndJSON(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "hml.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("db:\n  max_conns: 40\nRDB_ADDRESSES:\n  - a:6379\n  - b:6379\n"), 0o600))
+
+	jsonPath := filepath.Join(dir, "prd.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"db_max_conns": 80, "dd_enabled": false}`), 0o600))
+
+	src, err := NewFileSource(yamlPath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"DB_MAX_CONNS": "40", "RDB_ADDRESSES": "a:6379,b:6379"}, src.Values)
+
+	src, err = NewFileSource(jsonPath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"DB_MAX_CONNS": "80", "DD_ENABLED": "false"}, src.Values)
+
+	require.Equal(t, yamlPath, FindEnvFile(dir, "hml"))
+	require.Equal(t, "", FindEnvFile(dir, "dev"))
+}
+
+func TestNewConfigLayersFileEnvAndFlags(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hml.yaml"), []byte(
+		"DB_MAX_CONNS: 40\nDB_MIN_CONNS: 5\nRDB_ADDRESSES: file:6379\nLOG_LEVEL: warn\n",
+	), 0o600))
+
+	t.Setenv("ENV", "hml")
+	t.Setenv("CONFIG_DIR", dir)
+	t.Setenv("DB_MIN_CONNS", "10")
+	t.Setenv("LOG_LEVEL", "")
+
+	cfg, err := NewConfig("--db-min-conns=15", "--log-level", "debug")
+	require.NoError(t, err)
+
+	require.Equal(t, int32(40), cfg.Database.MaxConns)
+	require.Equal(t, int32(15), cfg.Database.MinConns)
+	require.Equal(t, "debug", cfg.Log.Level)
+	require.Equal(t, []string{"file:6379"}, cfg.Redis.Addresses)
+
+	origins := cfg.Origins()
+	file := "file:" + filepath.Join(dir, "hml.yaml")
+	require.Equal(t, file, origins["DB_MAX_CONNS"])
+	require.Equal(t, OriginFlag, origins["DB_MIN_CONNS"])
+	require.Equal(t, OriginEnv, origins["ENV"])
+	require.Equal(t, OriginDefault, origins["RDB_MAX_IDLE_CONNS"])
+}
+
+func TestNewConfigRejectsUnknownFlags(t *testing.T) {
+	t.Setenv("RDB_ADDRESSES", "localhost:6379")
+
+	_, err := NewConfig("--not-a-config-flag=1")
+	require.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+// ChangeEvent is published to the subscribers after a reload changed at least one variable.
+type ChangeEvent struct {
+	Old *Config
+	New *Config
+	// Keys lists the variables whose values changed, sorted.
+	Keys []string
+}
+
+// Changed reports whether the variable key changed.
+func (ce ChangeEvent) Changed(key string) bool {
+	i := sort.SearchStrings(ce.Keys, key)
+	return i < len(ce.Keys) && ce.Keys[i] == key
+}
+
+// Watcher reloads the configuration on SIGHUP or when the configuration file changes and
+// notifies the subscribers. Settings that can not be applied at runtime keep being read
+// from the configuration loaded at startup.
+type Watcher struct {
+	modTime      time.Time
+	current      atomic.Pointer[Config]
+	args         []string
+	subscribers  []func(ChangeEvent)
+	pollInterval time.Duration
+	mtx          sync.Mutex
+}
+
+// NewWatcher watches cfg, reloading it with the same command line args given to NewConfig.
+func NewWatcher(cfg *Config, args ...string) *Watcher {
+	w := &Watcher{args: args, modTime: fileModTime(cfg.File())}
+	w.current.Store(cfg)
+	return w
+}
+
+// SetPollInterval enables checking the configuration file modification time every interval.
+func (w *Watcher) SetPollInterval(interval time.Duration) *Watcher {
+	w.pollInterval = interval
+	return w
+}
+
+// Current returns the last configuration loaded successfully.
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// Subscribe registers fn to be called, in registration order, after every reload that changed something.
+func (w *Watcher) Subscribe(fn func(ChangeEvent)) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// OnChange subscribes fn to the changes of the value returned by get.
+//
+//	config.OnChange(w, func(c *config.Config) string { return c.Log.Level }, func(_, level string) {
+//		logger.SetLevel(level)
+//	})
+func OnChange[T comparable](w *Watcher, get func(*Config) T, fn func(old, new T)) {
+	w.Subscribe(func(ev ChangeEvent) {
+		oldValue, newValue := get(ev.Old), get(ev.New)
+		if oldValue != newValue {
+			fn(oldValue, newValue)
+		}
+	})
+}
+
+// Reload loads the configuration again and notifies the subscribers when it changed.
+// On error the current configuration is kept.
+func (w *Watcher) Reload() (ChangeEvent, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.modTime = fileModTime(w.Current().File())
+
+	cfg, err := NewConfig(w.args...)
+	if err != nil {
+		return ChangeEvent{}, err
+	}
+
+	old := w.current.Swap(cfg)
+	ev := ChangeEvent{Old: old, New: cfg, Keys: diff(old, cfg)}
+
+	if len(ev.Keys) > 0 {
+		for _, fn := range w.subscribers {
+			fn(ev)
+		}
+	}
+
+	return ev, nil
+}
+
+// Watch blocks reloading the configuration on SIGHUP and, when a poll interval is set,
+// whenever the configuration file is modified, until ctx is done.
+func (w *Watcher) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if w.pollInterval > 0 {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info(ctx, "config: SIGHUP received, reloading")
+		case <-tick:
+			if !w.fileChanged() {
+				continue
+			}
+			logger.Info(ctx, "config: file changed, reloading")
+		}
+
+		ev, err := w.Reload()
+		if err != nil {
+			logger.Error(ctx, "config: reload failed, keeping current configuration - "+err.Error())
+			continue
+		}
+		if len(ev.Keys) > 0 {
+			logger.Info(ctx, fmt.Sprintf("config: reloaded, changed %v", ev.Keys))
+		}
+	}
+}
+
+func (w *Watcher) fileChanged() bool {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	return !fileModTime(w.Current().File()).Equal(w.modTime)
+}
+
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// diff returns the sorted keys of the variables whose values differ between a and b.
+func diff(a, b *Config) []string {
+	va, vb := values(a), values(b)
+
+	var keys []string
+	for key, value := range vb {
+		if va[key] != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range va {
+		if _, ok := vb[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func values(cfg *Config) map[string]string {
+	vals := make(map[string]string)
+	if cfg == nil {
+		return vals
+	}
+
+	walk(reflect.ValueOf(cfg).Elem(), "", func(fd field) {
+		vals[fd.key] = formatValue(fd.value)
+	})
+
+	return vals
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeEnvFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestWatcherReloadNotifiesTypedSubscribers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dev.yaml")
+	writeEnvFile(t, path, "RDB_ADDRESSES: localhost:6379\nLOG_LEVEL: info\n", time.Now())
+
+	t.Setenv("CONFIG_DIR", dir)
+
+	cfg, err := NewConfig()
+	require.NoError(t, err)
+
+	w := NewWatcher(cfg)
+
+	var levels []string
+	OnChange(w, func(c *Config) string { return c.Log.Level }, func(old, new string) {
+		levels = append(levels, old+"->"+new)
+	})
+	tracerCalls := 0
+	OnChange(w, func(c *Config) bool { return c.Database.QueryTracer }, func(_, _ bool) {
+		tracerCalls++
+	})
+
+	writeEnvFile(t, path, "RDB_ADDRESSES: localhost:6379\nLOG_LEVEL: debug\n", time.Now())
+
+	ev, err := w.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []string{"LOG_LEVEL"}, ev.Keys)
+	require.True(t, ev.Changed("LOG_LEVEL"))
+	require.Equal(t, []string{"info->debug"}, levels)
+	require.Zero(t, tracerCalls)
+	require.Equal(t, "debug", w.Current().Log.Level)
+
+	writeEnvFile(t, path, "LOG_LEVEL: warn\n", time.Now())
+
+	_, err = w.Reload()
+	require.Error(t, err, "RDB_ADDRESSES is required")
+	require.Equal(t, "debug", w.Current().Log.Level)
+	require.Len(t, levels, 1)
+}
+
+func TestWatcherPollsConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dev.yaml")
+	start := time.Now().Add(-time.Hour)
+	writeEnvFile(t, path, "RDB_ADDRESSES: localhost:6379\nDB_QUERY_TRACER: false\n", start)
+
+	t.Setenv("CONFIG_DIR", dir)
+
+	cfg, err := NewConfig()
+	require.NoError(t, err)
+
+	changed := make(chan bool, 1)
+	w := NewWatcher(cfg).SetPollInterval(5 * time.Millisecond)
+	OnChange(w, func(c *Config) bool { return c.Database.QueryTracer }, func(_, enabled bool) {
+		changed <- enabled
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+
+	writeEnvFile(t, path, "RDB_ADDRESSES: localhost:6379\nDB_QUERY_TRACER: true\n", start.Add(time.Minute))
+
+	select {
+	case enabled := <-changed:
+		require.True(t, enabled)
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher did not reload the modified file")
+	}
+}
@@ -31,6 +31,7 @@ require (
 	go.opentelemetry.io/otel/trace v1.20.0
 	go.uber.org/zap v1.26.0
 	gopkg.in/DataDog/dd-trace-go.v1 v1.60.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -130,6 +131,5 @@ require (
 	golang.org/x/tools v0.17.0 // indirect
 	golang.org/x/xerrors v0.0.0-20231012003039-104605ab7028 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	inet.af/netaddr v0.0.0-20230525184311-b8eac61e914a // indirect
 )
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/fsvxavier/default-vertical-slice/config"
+)
+
+type configController struct {
+	Current func() *config.Config
+}
+
+func NewConfigController(current func() *config.Config) *configController {
+	return &configController{
+		Current: current,
+	}
+}
+
+// @Summary Effective configuration
+// @Description Effective configuration with secrets redacted and the source of every variable
+// @Success 200
+// @Router /admin/config [get].
+func (cc *configController) GetConfig(ctx *fiber.Ctx) error {
+	cfg := cc.Current()
+
+	return ctx.JSON(fiber.Map{
+		"file":      cfg.File(),
+		"config":    cfg,
+		"variables": config.Describe(cfg),
+	})
+}
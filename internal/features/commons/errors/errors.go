@@ -6,8 +6,9 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"regexp"
+	"sync/atomic"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	json "github.com/json-iterator/go"
 
 	"github.com/fsvxavier/default-vertical-slice/internal/utils/helpers"
@@ -53,6 +54,20 @@ type (
 		Metadata      map[string]any `json:"metadata,omitempty"`
 		Description   string         `json:"description"`
 	}
+
+	// Errors reported by the database, classified by their SQLSTATE.
+	DatabaseError struct {
+		InternalError error
+		ApiCode       string `json:"api_code"`
+		Code          string `json:"code"`
+		Table         string `json:"table,omitempty"`
+		Column        string `json:"column,omitempty"`
+		Constraint    string `json:"constraint,omitempty"`
+		Detail        string `json:"detail,omitempty"`
+		Description   string `json:"description"`
+		StatusCode    int    `json:"status_code"`
+		Retryable     bool   `json:"retryable"`
+	}
 )
 
 func (err *ExternalIntegrationError) Error() string {
@@ -96,6 +111,25 @@ func (d *UnsupportedMediaTypeError) Error() string {
 	return "unsupported media type"
 }
 
+func (d *DatabaseError) Error() string {
+	return d.Description
+}
+
+func (d *DatabaseError) Unwrap() error {
+	return d.InternalError
+}
+
+// NewDatabaseError classifies err when its chain holds a *pgconn.PgError, like the
+// errors returned by gpgx, and returns nil otherwise.
+func NewDatabaseError(err error) *DatabaseError {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	return HandleDatabaseError(err)
+}
+
 func NewInvalidEntityError(details map[string][]string, entity any) *InvalidEntityError {
 	return &InvalidEntityError{
 		Details:    details,
@@ -103,39 +137,93 @@ func NewInvalidEntityError(details map[string][]string, entity any) *InvalidEnti
 	}
 }
 
+// DockError is an entry of the catalog mapping SQLSTATE codes to API errors.
 type DockError struct {
+	Code        string `json:"code"`
 	Description string `json:"description"`
 	StatusCode  int    `json:"status_code"`
+	Retryable   bool   `json:"retryable"`
 }
 
+const DEFAULT_ERROR_KEY = "500"
+
 var (
-	dockErrors map[string]DockError
+	dockErrors atomic.Pointer[map[string]DockError]
 
 	//go:embed errors.json
 	errorsFS embed.FS
 )
 
-func parseError(err error) string {
-	r := regexp.MustCompile(`^(.*)\(SQLSTATE (.*)\).*$`)
-	match := r.FindStringSubmatch(err.Error())
-	if len(match) == 3 {
-		fmt.Printf("Message: %s / Code: %s\n", match[1], match[2])
-		return match[2]
+// sqlState returns the SQLSTATE of the first *pgconn.PgError in the chain of err.
+func sqlState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
 	}
 
 	return ""
 }
 
-func findError(err error) DockError {
-	dockError, ok := dockErrors[parseError(err)]
-	if !ok {
-		return dockErrors["500"]
+// findError looks the SQLSTATE up in the catalog, falling back to its class, the first
+// two characters, and then to the DEFAULT_ERROR_KEY entry.
+func findError(code string) DockError {
+	catalog := *dockErrors.Load()
+
+	if dockError, ok := catalog[code]; ok && code != "" {
+		return dockError
+	}
+	if len(code) == 5 {
+		if dockError, ok := catalog[code[:2]]; ok {
+			return dockError
+		}
+	}
+
+	return catalog[DEFAULT_ERROR_KEY]
+}
+
+// HandleDatabaseError classifies err through the catalog. Errors without a SQLSTATE get
+// the DEFAULT_ERROR_KEY entry.
+func HandleDatabaseError(err error) *DatabaseError {
+	dbErr := &DatabaseError{InternalError: err}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		dbErr.Code = pgErr.Code
+		dbErr.Table = pgErr.TableName
+		dbErr.Column = pgErr.ColumnName
+		dbErr.Constraint = pgErr.ConstraintName
+		dbErr.Detail = pgErr.Detail
 	}
-	return dockError
+
+	dockError := findError(dbErr.Code)
+	dbErr.ApiCode = dockError.Code
+	dbErr.Description = dockError.Description
+	dbErr.StatusCode = dockError.StatusCode
+	dbErr.Retryable = dockError.Retryable
+
+	return dbErr
 }
 
-func HandleDatabaseError(err error) DockError {
-	return findError(err)
+// LoadErrorsFile layers the entries of the JSON file at path over the embedded catalog,
+// replacing the entries with the same key. It is meant to be called at startup.
+func LoadErrorsFile(path string) error {
+	overrides, err := loadErrors(path, false)
+	if err != nil {
+		return fmt.Errorf("load errors catalog %s: %w", path, err)
+	}
+
+	catalog, err := loadErrors("errors.json", true)
+	if err != nil {
+		return err
+	}
+
+	for key, dockError := range overrides {
+		catalog[key] = dockError
+	}
+
+	dockErrors.Store(&catalog)
+
+	return nil
 }
 
 func loadErrors(filepath string, embeded bool) (map[string]DockError, error) {
@@ -166,12 +254,12 @@ func loadErrors(filepath string, embeded bool) (map[string]DockError, error) {
 // MARK: - Initialization
 
 func init() {
-	var err error
 	useEmbededFS := true
 
-	dockErrors, err = loadErrors("errors.json", useEmbededFS)
-
+	catalog, err := loadErrors("errors.json", useEmbededFS)
 	if err != nil {
 		log.Panicln("Error loading errors.json")
 	}
+
+	dockErrors.Store(&catalog)
 }
@@ -0,0 +1,73 @@
+package domainerrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDatabaseErrorUsesSQLState(t *testing.T) {
+	pgErr := &pgconn.PgError{
+		Code:           "23505",
+		Message:        "duplicate key value violates unique constraint",
+		TableName:      "accounts",
+		ConstraintName: "accounts_email_key",
+	}
+
+	dbErr := NewDatabaseError(fmt.Errorf("repository: %w", pgErr))
+	require.NotNil(t, dbErr)
+	require.Equal(t, "23505", dbErr.Code)
+	require.Equal(t, "DB_UNIQUE_VIOLATION", dbErr.ApiCode)
+	require.Equal(t, "accounts", dbErr.Table)
+	require.Equal(t, "accounts_email_key", dbErr.Constraint)
+	require.Equal(t, http.StatusUnprocessableEntity, dbErr.StatusCode)
+	require.False(t, dbErr.Retryable)
+	require.ErrorIs(t, dbErr, pgErr)
+
+	require.Nil(t, NewDatabaseError(errors.New("duplicate key (SQLSTATE 23505)")))
+	require.Equal(t, http.StatusInternalServerError, HandleDatabaseError(errors.New("(SQLSTATE 23505)")).StatusCode)
+}
+
+func TestHandleDatabaseErrorCatalog(t *testing.T) {
+	for code, want := range map[string]DockError{
+		"40001": {Code: "DB_SERIALIZATION_FAILURE", StatusCode: http.StatusConflict, Retryable: true},
+		"40P01": {Code: "DB_DEADLOCK_DETECTED", StatusCode: http.StatusConflict, Retryable: true},
+		"57014": {Code: "DB_QUERY_CANCELED", StatusCode: http.StatusGatewayTimeout, Retryable: true},
+		"53300": {Code: "DB_TOO_MANY_CONNECTIONS", StatusCode: http.StatusServiceUnavailable, Retryable: true},
+		"08006": {Code: "DB_CONNECTION_FAILURE", StatusCode: http.StatusServiceUnavailable, Retryable: true},
+		"22P02": {Code: "DB_INVALID_TEXT_REPRESENTATION", StatusCode: http.StatusBadRequest},
+		// Unlisted codes fall back to their class.
+		"22021": {Code: "DB_DATA_EXCEPTION", StatusCode: http.StatusBadRequest},
+		"23000": {Code: "DB_INTEGRITY_VIOLATION", StatusCode: http.StatusUnprocessableEntity},
+		"XX000": {Code: "INTERNAL_SERVER_ERROR", StatusCode: http.StatusInternalServerError},
+	} {
+		dbErr := HandleDatabaseError(&pgconn.PgError{Code: code})
+		require.Equal(t, want.Code, dbErr.ApiCode, code)
+		require.Equal(t, want.StatusCode, dbErr.StatusCode, code)
+		require.Equal(t, want.Retryable, dbErr.Retryable, code)
+	}
+}
+
+func TestLoadErrorsFileOverridesEntries(t *testing.T) {
+	defer func(catalog *map[string]DockError) { dockErrors.Store(catalog) }(dockErrors.Load())
+
+	path := filepath.Join(t.TempDir(), "errors.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"23505": {"code": "ACCOUNT_ALREADY_EXISTS", "description": "Account already exists", "status_code": 409}
+	}`), 0o600))
+
+	require.NoError(t, LoadErrorsFile(path))
+
+	dbErr := HandleDatabaseError(&pgconn.PgError{Code: "23505"})
+	require.Equal(t, "ACCOUNT_ALREADY_EXISTS", dbErr.ApiCode)
+	require.Equal(t, http.StatusConflict, dbErr.StatusCode)
+	require.Equal(t, "DB_FOREIGN_KEY_VIOLATION", HandleDatabaseError(&pgconn.PgError{Code: "23503"}).ApiCode)
+
+	require.Error(t, LoadErrorsFile(filepath.Join(t.TempDir(), "missing.json")))
+}
@@ -4,49 +4,82 @@ import (
 	"context"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/domains"
+	"github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/ports"
 	"github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/services"
-	"github.com/fsvxavier/default-vertical-slice/pkg/database/redis"
+	"github.com/fsvxavier/default-vertical-slice/pkg/health"
 )
 
 type healthcheckController struct {
-	Db      *pgxpool.Pool
-	RdbConn *redis.Redigo
+	Service ports.IHealthCheckService
 }
 
-func NewHealthCheckController(db *pgxpool.Pool, rdbConn *redis.Redigo) *healthcheckController {
+func NewHealthCheckController(registry *health.Registry, startup *health.Startup, ready, stopping func() bool) *healthcheckController {
 	return &healthcheckController{
-		Db:      db,
-		RdbConn: rdbConn,
+		Service: services.NewHealthCheckService(registry, startup, ready, stopping),
 	}
 }
 
 // @Summary HealthCheck
-// @Description HealthCheck API
+// @Description Runs every dependency check
 // @Success 200
-// @Router /healthcheck [get].
+// @Failure 503
+// @Router /health [get].
 func (hcc *healthcheckController) GetHealthcheck(ctx *fiber.Ctx) (err error) {
-	dbConn, err := hcc.Db.Acquire(context.TODO())
-	defer dbConn.Release()
-	if err != nil {
-		return err
-	}
+	return respond(ctx, hcc.Service.GetHealthcheck)
+}
+
+// @Summary Liveness probe
+// @Description Checks the process only
+// @Success 200
+// @Router /health/live [get].
+func (hcc *healthcheckController) GetLiveness(ctx *fiber.Ctx) (err error) {
+	return respond(ctx, hcc.Service.GetLiveness)
+}
 
-	rdbConn, err := hcc.RdbConn.Acquire(context.TODO())
-	defer rdbConn.Close()
+// @Summary Readiness probe
+// @Description Checks the critical dependencies, fails during startup and shutdown
+// @Success 200
+// @Failure 503
+// @Router /health/ready [get].
+func (hcc *healthcheckController) GetReadiness(ctx *fiber.Ctx) (err error) {
+	return respond(ctx, hcc.Service.GetReadiness)
+}
+
+// @Summary Startup probe
+// @Description Fails until the warm-up completes
+// @Success 200
+// @Failure 503
+// @Router /health/startup [get].
+func (hcc *healthcheckController) GetStartup(ctx *fiber.Ctx) (err error) {
+	return respond(ctx, hcc.Service.GetStartup)
+}
+
+// @Summary Health details
+// @Description Runs every dependency check and reports the history of each one
+// @Success 200
+// @Failure 503
+// @Router /health/details [get].
+func (hcc *healthcheckController) GetDetails(ctx *fiber.Ctx) (err error) {
+	hdReturn, err := hcc.Service.GetDetails(ctx.UserContext())
 	if err != nil {
-		return err
+		ctx.Status(fiber.StatusServiceUnavailable)
+		return ctx.JSON(hdReturn)
 	}
 
-	hcService := services.NewHealthCheckService(dbConn, rdbConn)
-	hcReturn, err := hcService.GetHealthcheck()
+	ctx.Status(fiber.StatusOK)
+	return ctx.JSON(hdReturn)
+}
+
+func respond(ctx *fiber.Ctx, probe func(context.Context) (*domains.HealthCheck, error)) error {
+	hcReturn, err := probe(ctx.UserContext())
 	if err != nil {
-		ctx.SendStatus(500)
+		ctx.Status(fiber.StatusServiceUnavailable)
 		return ctx.JSON(hcReturn)
 	}
 
-	ctx.SendStatus(200)
+	ctx.Status(fiber.StatusOK)
 	return ctx.JSON(hcReturn)
 }
 
@@ -1,7 +1,15 @@
 package ports
 
-import "github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/domains"
+import (
+	"context"
+
+	"github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/domains"
+)
 
 type IHealthCheckService interface {
-	GetHealthcheck() (healthStatus *domains.HealthCheck, err error)
+	GetHealthcheck(ctx context.Context) (healthStatus *domains.HealthCheck, err error)
+	GetLiveness(ctx context.Context) (healthStatus *domains.HealthCheck, err error)
+	GetReadiness(ctx context.Context) (healthStatus *domains.HealthCheck, err error)
+	GetStartup(ctx context.Context) (healthStatus *domains.HealthCheck, err error)
+	GetDetails(ctx context.Context) (healthDetails *domains.HealthDetails, err error)
 }
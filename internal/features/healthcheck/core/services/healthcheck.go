@@ -3,114 +3,99 @@ package services
 import (
 	"context"
 	"errors"
-	"os"
-	"strings"
 
-	"github.com/gomodule/redigo/redis"
-	"github.com/jackc/pgx/v5/pgxpool"
-
-	"github.com/fsvxavier/default-vertical-slice/internal/features/commons/constants"
 	"github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/domains"
 	"github.com/fsvxavier/default-vertical-slice/internal/features/healthcheck/core/ports"
-	rports "github.com/fsvxavier/default-vertical-slice/pkg/database/redis/ports"
-	rrep "github.com/fsvxavier/default-vertical-slice/pkg/database/redis/repositories"
-	"github.com/fsvxavier/default-vertical-slice/pkg/httpclient/nethttp"
+	"github.com/fsvxavier/default-vertical-slice/pkg/health"
+)
+
+var (
+	ErrUnhealthy    = errors.New("a critical dependency is unhealthy")
+	ErrNotReady     = errors.New("not ready")
+	ErrShuttingDown = errors.New("shutting down")
+	ErrStarting     = errors.New("warming up")
 )
 
 type healthcheckService struct {
-	Db     *pgxpool.Conn
-	Redigo rports.IRedigoRepository
+	Registry *health.Registry
+	Startup  *health.Startup
+	Ready    func() bool
+	Stopping func() bool
 }
 
-func NewHealthCheckService(db *pgxpool.Conn, rdbConn redis.Conn) ports.IHealthCheckService {
+// NewHealthCheckService creates the service behind the probes. ready reports whether the
+// application finished starting and is not shutting down, stopping whether the shutdown
+// began; startup may be nil when there is nothing to warm up.
+func NewHealthCheckService(registry *health.Registry, startup *health.Startup, ready, stopping func() bool) ports.IHealthCheckService {
 	return &healthcheckService{
-		Db:     db,
-		Redigo: rrep.NewRedigoRepository(rdbConn),
+		Registry: registry,
+		Startup:  startup,
+		Ready:    ready,
+		Stopping: stopping,
 	}
 }
 
-func (hlc *healthcheckService) GetHealthcheck() (healthStatus *domains.HealthCheck, err error) {
-	healthStatus = &domains.HealthCheck{
-		AppStatus:          constants.OK,
-		DbStatus:           constants.OK,
-		RdbStatus:          constants.OK,
-		DrachmaStatus:      constants.OK,
-		MedjatStatus:       constants.OK,
-		ExchangeRateStatus: constants.OK,
-	}
+// GetHealthcheck runs every registered check. It returns ErrUnhealthy along with the
+// report when a critical check failed; failed degraded checks are only reported.
+func (hlc *healthcheckService) GetHealthcheck(ctx context.Context) (healthStatus *domains.HealthCheck, err error) {
+	return fromReport(hlc.Registry.Run(ctx), ErrUnhealthy)
+}
 
-	err = hlc.Db.Ping(context.TODO())
-	if err != nil {
-		healthStatus.DbStatus = constants.ERROR
-		healthStatus.DbMsg = err.Error()
-	}
+// GetLiveness only tells the process is able to serve requests, it never checks
+// dependencies so a slow downstream does not get the pod restarted.
+func (hlc *healthcheckService) GetLiveness(ctx context.Context) (healthStatus *domains.HealthCheck, err error) {
+	return &domains.HealthCheck{Status: health.STATUS_UP}, nil
+}
 
-	err = hlc.Redigo.Ping(context.TODO())
-	if err != nil {
-		healthStatus.RdbStatus = constants.ERROR
-		healthStatus.RdbMsg = err.Error()
+// GetReadiness fails with ErrNotReady while the application is starting, ErrShuttingDown
+// once it is draining and ErrUnhealthy when a critical dependency is unhealthy.
+func (hlc *healthcheckService) GetReadiness(ctx context.Context) (healthStatus *domains.HealthCheck, err error) {
+	if hlc.Ready != nil && !hlc.Ready() {
+		err = ErrNotReady
+		if hlc.Stopping != nil && hlc.Stopping() {
+			err = ErrShuttingDown
+		}
+		return &domains.HealthCheck{Status: health.STATUS_DOWN, Message: err.Error()}, err
 	}
 
-	healthStatus, err = hlc.checkExternalApps(healthStatus)
+	return fromReport(hlc.Registry.Run(ctx, health.CRITICAL), ErrUnhealthy)
+}
+
+// GetStartup fails until the warm-up checks pass.
+func (hlc *healthcheckService) GetStartup(ctx context.Context) (healthStatus *domains.HealthCheck, err error) {
+	if hlc.Startup == nil {
+		return &domains.HealthCheck{Status: health.STATUS_UP}, nil
+	}
 
-	// Else return notes
-	return healthStatus, err
+	return fromReport(hlc.Startup.Run(ctx), ErrStarting)
 }
 
-func (hlc *healthcheckService) checkExternalApps(actualHealthStatus *domains.HealthCheck) (healthStatus *domains.HealthCheck, err error) {
-	actualStatus := []string{
-		"MEDJAT_HEADER",
-		"DRACHMA_HEADER",
-		"EXCHANGE_RATE_HEADER",
+// GetDetails runs every registered check and adds the history of each component.
+func (hlc *healthcheckService) GetDetails(ctx context.Context) (healthDetails *domains.HealthDetails, err error) {
+	report := hlc.Registry.Details(ctx)
+
+	healthDetails = &domains.HealthDetails{
+		Components: report.Components,
+		Status:     report.Status,
 	}
 
-	var sliceErrors []error
+	if report.Status == health.STATUS_DOWN {
+		return healthDetails, ErrUnhealthy
+	}
 
-	for i := range actualStatus {
-		client := nethttp.NewRequester(nethttp.New())
-		client.SetTimeOutRequest(30)
-		client.SetBaseURL("https://vpce-078c9ba44be2cbce6-e7abdu82.execute-api.us-east-2.vpce.amazonaws.com/Live")
-		client.Headers = map[string]string{
-			"Content-Type": "application/json",
-			"Accept":       "application/json",
-		}
+	return healthDetails, nil
+}
 
-		switch strings.ToLower(actualStatus[i]) {
-		case strings.ToLower("MEDJAT_HEADER"):
-			client.Headers["x-apigw-api-id"] = os.Getenv("MEDJAT_HEADER")
-
-			_, err = client.Get(context.TODO(), "/medjat/health")
-			if err != nil {
-				sliceErrors = append(sliceErrors, err)
-				actualHealthStatus.MedjatStatus = "NOK"
-				actualHealthStatus.MedjatMsg = err.Error()
-			}
-
-		case strings.ToLower("DRACHMA_HEADER"):
-			client.Headers["x-apigw-api-id"] = os.Getenv("DRACHMA_HEADER")
-
-			_, err = client.Get(context.TODO(), "/health")
-			if err != nil {
-				sliceErrors = append(sliceErrors, err)
-				actualHealthStatus.DrachmaStatus = "NOK"
-				actualHealthStatus.DrachmaMsg = err.Error()
-			}
-
-		case strings.ToLower("EXCHANGE_RATE_HEADER"):
-			client.Headers["x-apigw-api-id"] = os.Getenv("EXCHANGE_RATE_HEADER")
-
-			_, err = client.Get(context.TODO(), "/health")
-			if err != nil {
-				sliceErrors = append(sliceErrors, err)
-				actualHealthStatus.ExchangeRateStatus = "NOK"
-				actualHealthStatus.ExchangeRateMsg = err.Error()
-			}
-		}
+func fromReport(report health.Report, errDown error) (*domains.HealthCheck, error) {
+	healthStatus := &domains.HealthCheck{
+		Components: report.Components,
+		Status:     report.Status,
 	}
 
-	if len(sliceErrors) > 0 {
-		err = errors.New("Error in healthcheck External Apps")
+	if report.Status == health.STATUS_DOWN {
+		healthStatus.Message = errDown.Error()
+		return healthStatus, errDown
 	}
 
-	return actualHealthStatus, err
+	return healthStatus, nil
 }
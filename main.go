@@ -1,8 +1,11 @@
 package main
 
 import (
+	"os"
+
 	"github.com/joho/godotenv"
 
+	"github.com/fsvxavier/default-vertical-slice/cmd/migrate"
 	"github.com/fsvxavier/default-vertical-slice/cmd/webserver"
 	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
 )
@@ -18,5 +21,15 @@ func main() {
 		logger.DebugOutCtx("\nNo .env file avaliable seaching ENVIROMENTS system")
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrate.Run(os.Args[2:])
+			return
+		case "webserver":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
 	webserver.Run()
 }
@@ -0,0 +1,433 @@
+package gpgx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fsvxavier/default-vertical-slice/internal/features/commons/pagination"
+)
+
+const (
+	ORDER_ASC  = "ASC"
+	ORDER_DESC = "DESC"
+)
+
+var (
+	ErrInvalidSort  = errors.New("invalid sort")
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// Statement is a SQL statement with its positional arguments.
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+// Debug renders the statement with its arguments interpolated, for logs only. When an
+// argument can not be rendered, the SQL is followed by the raw arguments.
+func (s Statement) Debug() string {
+	if sql, err := SanitizeSQL(s.SQL, s.Args...); err == nil {
+		return sql
+	}
+	return fmt.Sprintf("%s %v", s.SQL, s.Args)
+}
+
+// SelectBuilder composes a SELECT. Errors, like a sort column out of the whitelist, are
+// returned by Build.
+type SelectBuilder struct {
+	err     error
+	table   string
+	columns []string
+	filters []Filter
+	orders  []string
+	limit   int
+	offset  int
+}
+
+// Select starts a SELECT of columns, all of them when none is given.
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+func (sb *SelectBuilder) From(table string) *SelectBuilder {
+	sb.table = table
+	return sb
+}
+
+// Where adds filters, all of them must match.
+func (sb *SelectBuilder) Where(filters ...Filter) *SelectBuilder {
+	sb.filters = append(sb.filters, filters...)
+	return sb
+}
+
+// OrderBy sorts by column in order, ASC or DESC case insensitive. column must come from
+// a whitelist, never from the request.
+func (sb *SelectBuilder) OrderBy(column, order string) *SelectBuilder {
+	dir, err := sortOrder(order)
+	if err != nil {
+		sb.err = errors.Join(sb.err, err)
+		return sb
+	}
+
+	sb.orders = append(sb.orders, quoteColumn(column)+" "+dir)
+	return sb
+}
+
+func (sb *SelectBuilder) Limit(limit int) *SelectBuilder {
+	sb.limit = limit
+	return sb
+}
+
+func (sb *SelectBuilder) Offset(offset int) *SelectBuilder {
+	sb.offset = offset
+	return sb
+}
+
+// Paginate applies the sort and the page of meta using LIMIT and OFFSET. Pages start at
+// 1. sortable maps the sort fields accepted by the API to their columns; any other field
+// is rejected with ErrInvalidSort.
+func (sb *SelectBuilder) Paginate(meta *pagination.Metadata, sortable map[string]string) *SelectBuilder {
+	if meta == nil {
+		return sb
+	}
+
+	sb.sort(meta, sortable)
+
+	if meta.Pagination != nil && meta.Pagination.Limit != nil && *meta.Pagination.Limit > 0 {
+		sb.limit = *meta.Pagination.Limit
+		if meta.Pagination.Page != nil && *meta.Pagination.Page > 1 {
+			sb.offset = (*meta.Pagination.Page - 1) * sb.limit
+		}
+	}
+
+	return sb
+}
+
+// Keyset applies the sort and the limit of meta, seeking past cursor, the sort column
+// value of the last row of the previous page, instead of skipping rows with OFFSET.
+// The sort column must be unique and is required. A nil cursor reads the first page.
+func (sb *SelectBuilder) Keyset(meta *pagination.Metadata, sortable map[string]string, cursor any) *SelectBuilder {
+	if meta == nil || meta.Sort == nil {
+		sb.err = errors.Join(sb.err, fmt.Errorf("gpgx: %w: keyset pagination requires a sort field", ErrInvalidSort))
+		return sb
+	}
+
+	column, dir := sb.sort(meta, sortable)
+	if column != "" && cursor != nil {
+		if dir == ORDER_DESC {
+			sb.filters = append(sb.filters, Lt(column, cursor))
+		} else {
+			sb.filters = append(sb.filters, Gt(column, cursor))
+		}
+	}
+
+	if meta.Pagination != nil && meta.Pagination.Limit != nil && *meta.Pagination.Limit > 0 {
+		sb.limit = *meta.Pagination.Limit
+	}
+
+	return sb
+}
+
+func (sb *SelectBuilder) sort(meta *pagination.Metadata, sortable map[string]string) (column, dir string) {
+	if meta.Sort == nil || meta.Sort.Field == "" {
+		return "", ""
+	}
+
+	column, ok := sortable[meta.Sort.Field]
+	if !ok {
+		sb.err = errors.Join(sb.err, fmt.Errorf("gpgx: %w: field %q", ErrInvalidSort, meta.Sort.Field))
+		return "", ""
+	}
+
+	dir, err := sortOrder(meta.Sort.Order)
+	if err != nil {
+		sb.err = errors.Join(sb.err, err)
+		return "", ""
+	}
+
+	sb.orders = append(sb.orders, quoteColumn(column)+" "+dir)
+	return column, dir
+}
+
+// Build renders the statement.
+func (sb *SelectBuilder) Build() (Statement, error) {
+	if sb.err != nil {
+		return Statement{}, sb.err
+	}
+	if sb.table == "" {
+		return Statement{}, fmt.Errorf("gpgx: %w: missing table", ErrInvalidQuery)
+	}
+
+	projection := "*"
+	if len(sb.columns) > 0 {
+		projection = quoteColumns(sb.columns)
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "SELECT %s FROM %s", projection, quoteTable(sb.table))
+
+	where, args, err := renderWhere(sb.filters, nil)
+	if err != nil {
+		return Statement{}, err
+	}
+	buf.WriteString(where)
+
+	if len(sb.orders) > 0 {
+		buf.WriteString(" ORDER BY " + strings.Join(sb.orders, ", "))
+	}
+	if sb.limit > 0 {
+		fmt.Fprintf(&buf, " LIMIT %d", sb.limit)
+	}
+	if sb.offset > 0 {
+		fmt.Fprintf(&buf, " OFFSET %d", sb.offset)
+	}
+
+	return Statement{SQL: buf.String(), Args: args}, nil
+}
+
+// InsertBuilder composes an INSERT of one or more rows.
+type InsertBuilder struct {
+	table      string
+	columns    []string
+	rows       [][]any
+	conflict   string
+	returning  []string
+	doNothing  bool
+	updateCols []string
+}
+
+func InsertInto(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+func (ib *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	ib.columns = columns
+	return ib
+}
+
+// Values adds a row, with one value per column.
+func (ib *InsertBuilder) Values(values ...any) *InsertBuilder {
+	ib.rows = append(ib.rows, values)
+	return ib
+}
+
+// OnConflictDoNothing skips the rows conflicting on the target columns.
+func (ib *InsertBuilder) OnConflictDoNothing(target ...string) *InsertBuilder {
+	ib.conflict = quoteColumns(target)
+	ib.doNothing = true
+	return ib
+}
+
+// OnConflictUpdate updates columns of the rows conflicting on the target columns with
+// the values being inserted.
+func (ib *InsertBuilder) OnConflictUpdate(target []string, columns ...string) *InsertBuilder {
+	ib.conflict = quoteColumns(target)
+	ib.updateCols = columns
+	return ib
+}
+
+func (ib *InsertBuilder) Returning(columns ...string) *InsertBuilder {
+	ib.returning = columns
+	return ib
+}
+
+func (ib *InsertBuilder) Build() (Statement, error) {
+	if ib.table == "" || len(ib.columns) == 0 || len(ib.rows) == 0 {
+		return Statement{}, fmt.Errorf("gpgx: %w: insert requires table, columns and values", ErrInvalidQuery)
+	}
+
+	var (
+		args []any
+		rows = make([]string, 0, len(ib.rows))
+	)
+	for _, row := range ib.rows {
+		if len(row) != len(ib.columns) {
+			return Statement{}, fmt.Errorf("gpgx: %w: %d values for %d columns", ErrInvalidQuery, len(row), len(ib.columns))
+		}
+		placeholders := make([]string, 0, len(row))
+		for _, v := range row {
+			args = append(args, v)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "INSERT INTO %s (%s) VALUES %s", quoteTable(ib.table), quoteColumns(ib.columns), strings.Join(rows, ", "))
+
+	switch {
+	case ib.doNothing:
+		buf.WriteString(" ON CONFLICT")
+		if ib.conflict != "" {
+			buf.WriteString(" (" + ib.conflict + ")")
+		}
+		buf.WriteString(" DO NOTHING")
+	case ib.conflict != "" && len(ib.updateCols) > 0:
+		sets := make([]string, 0, len(ib.updateCols))
+		for _, c := range ib.updateCols {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quoteColumn(c), quoteColumn(c)))
+		}
+		fmt.Fprintf(&buf, " ON CONFLICT (%s) DO UPDATE SET %s", ib.conflict, strings.Join(sets, ", "))
+	}
+
+	if len(ib.returning) > 0 {
+		buf.WriteString(" RETURNING " + quoteColumns(ib.returning))
+	}
+
+	return Statement{SQL: buf.String(), Args: args}, nil
+}
+
+// UpdateBuilder composes an UPDATE.
+type UpdateBuilder struct {
+	table     string
+	columns   []string
+	values    []any
+	filters   []Filter
+	returning []string
+}
+
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+func (ub *UpdateBuilder) Set(column string, value any) *UpdateBuilder {
+	ub.columns = append(ub.columns, column)
+	ub.values = append(ub.values, value)
+	return ub
+}
+
+func (ub *UpdateBuilder) Where(filters ...Filter) *UpdateBuilder {
+	ub.filters = append(ub.filters, filters...)
+	return ub
+}
+
+func (ub *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	ub.returning = columns
+	return ub
+}
+
+// Build renders the statement. An UPDATE without filters is refused, use a filter
+// matching every row to update them all.
+func (ub *UpdateBuilder) Build() (Statement, error) {
+	if ub.table == "" || len(ub.columns) == 0 {
+		return Statement{}, fmt.Errorf("gpgx: %w: update requires table and values", ErrInvalidQuery)
+	}
+	if len(ub.filters) == 0 {
+		return Statement{}, fmt.Errorf("gpgx: %w: update without filters", ErrInvalidQuery)
+	}
+
+	args := make([]any, 0, len(ub.values))
+	sets := make([]string, 0, len(ub.columns))
+	for i, c := range ub.columns {
+		args = append(args, ub.values[i])
+		sets = append(sets, fmt.Sprintf("%s = $%d", quoteColumn(c), len(args)))
+	}
+
+	where, args, err := renderWhere(ub.filters, args)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	sql := fmt.Sprintf("UPDATE %s SET %s%s", quoteTable(ub.table), strings.Join(sets, ", "), where)
+	if len(ub.returning) > 0 {
+		sql += " RETURNING " + quoteColumns(ub.returning)
+	}
+
+	return Statement{SQL: sql, Args: args}, nil
+}
+
+// DeleteBuilder composes a DELETE.
+type DeleteBuilder struct {
+	table     string
+	filters   []Filter
+	returning []string
+}
+
+func DeleteFrom(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+func (db *DeleteBuilder) Where(filters ...Filter) *DeleteBuilder {
+	db.filters = append(db.filters, filters...)
+	return db
+}
+
+func (db *DeleteBuilder) Returning(columns ...string) *DeleteBuilder {
+	db.returning = columns
+	return db
+}
+
+// Build renders the statement. A DELETE without filters is refused.
+func (db *DeleteBuilder) Build() (Statement, error) {
+	if db.table == "" {
+		return Statement{}, fmt.Errorf("gpgx: %w: missing table", ErrInvalidQuery)
+	}
+	if len(db.filters) == 0 {
+		return Statement{}, fmt.Errorf("gpgx: %w: delete without filters", ErrInvalidQuery)
+	}
+
+	where, args, err := renderWhere(db.filters, nil)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	sql := fmt.Sprintf("DELETE FROM %s%s", quoteTable(db.table), where)
+	if len(db.returning) > 0 {
+		sql += " RETURNING " + quoteColumns(db.returning)
+	}
+
+	return Statement{SQL: sql, Args: args}, nil
+}
+
+// renderWhere renders filters with placeholders numbered after args.
+func renderWhere(filters []Filter, args []any) (string, []any, error) {
+	if len(filters) == 0 {
+		return "", args, nil
+	}
+
+	conds := make([]string, 0, len(filters))
+	for _, f := range filters {
+		var (
+			cond string
+			err  error
+		)
+		if cond, args, err = f.render(args); err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, cond)
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+func sortOrder(order string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(order)) {
+	case "", ORDER_ASC:
+		return ORDER_ASC, nil
+	case ORDER_DESC:
+		return ORDER_DESC, nil
+	default:
+		return "", fmt.Errorf("gpgx: %w: order %q", ErrInvalidSort, order)
+	}
+}
+
+// quoteTable quotes a table name, optionally schema qualified.
+func quoteTable(table string) string {
+	return pgx.Identifier(strings.Split(table, ".")).Sanitize()
+}
+
+// quoteColumn quotes a column name, optionally table qualified.
+func quoteColumn(column string) string {
+	return pgx.Identifier(strings.Split(column, ".")).Sanitize()
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quoted = append(quoted, quoteColumn(c))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,108 @@
+package gpgx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fsvxavier/default-vertical-slice/internal/features/commons/pagination"
+)
+
+var accountSorts = map[string]string{"createdAt": "created_at", "id": "id"}
+
+func TestSelectFilters(t *testing.T) {
+	stmt, err := Select("id", "email").
+		From("bank.accounts").
+		Where(
+			Eq("status", "active"),
+			In("kind", "a", "b"),
+			ILike("email", "%@acme.io"),
+			Range("balance", int64(10), int64(20)),
+			Range("created_at", nil, "2024-01-01"),
+			IsNull("deleted_at"),
+		).
+		OrderBy("id", "desc").
+		Build()
+	require.NoError(t, err)
+
+	require.Equal(t, `SELECT "id", "email" FROM "bank"."accounts" WHERE "status" = $1 AND "kind" IN ($2, $3) AND "email" ILIKE $4 AND "balance" BETWEEN $5 AND $6 AND "created_at" <= $7 AND "deleted_at" IS NULL ORDER BY "id" DESC`, stmt.SQL)
+	require.Equal(t, []any{"active", "a", "b", "%@acme.io", int64(10), int64(20), "2024-01-01"}, stmt.Args)
+	require.Contains(t, stmt.Debug(), `"kind" IN ('a', 'b')`)
+}
+
+func TestSelectRejectsFilterWithoutOperator(t *testing.T) {
+	_, err := Select().From("accounts").Where(Filter{Column: "id", Value: "1"}).Build()
+	require.ErrorIs(t, err, ErrInvalidQuery)
+
+	_, err = DeleteFrom("accounts").Where(Filter{Column: "id", Value: "1"}).Build()
+	require.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestSelectEmptyInMatchesNothing(t *testing.T) {
+	stmt, err := Select().From("accounts").Where(In[string]("id")).Build()
+	require.NoError(t, err)
+	require.Equal(t, `SELECT * FROM "accounts" WHERE FALSE`, stmt.SQL)
+}
+
+func TestSelectPaginate(t *testing.T) {
+	field, order := "createdAt", "DESC"
+	stmt, err := Select().From("accounts").Paginate(pagination.NewMetadata(3, 20, &field, &order), accountSorts).Build()
+	require.NoError(t, err)
+	require.Equal(t, `SELECT * FROM "accounts" ORDER BY "created_at" DESC LIMIT 20 OFFSET 40`, stmt.SQL)
+
+	field = "password"
+	_, err = Select().From("accounts").Paginate(pagination.NewMetadata(1, 20, &field, &order), accountSorts).Build()
+	require.ErrorIs(t, err, ErrInvalidSort)
+
+	field, order = "id", "asc; DROP TABLE accounts"
+	_, err = Select().From("accounts").Paginate(pagination.NewMetadata(1, 20, &field, &order), accountSorts).Build()
+	require.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestSelectKeyset(t *testing.T) {
+	field, order := "id", "desc"
+	meta := pagination.NewMetadata(1, 50, &field, &order)
+
+	stmt, err := Select().From("accounts").Where(Eq("status", "active")).Keyset(meta, accountSorts, "0190").Build()
+	require.NoError(t, err)
+	require.Equal(t, `SELECT * FROM "accounts" WHERE "status" = $1 AND "id" < $2 ORDER BY "id" DESC LIMIT 50`, stmt.SQL)
+	require.Equal(t, []any{"active", "0190"}, stmt.Args)
+
+	stmt, err = Select().From("accounts").Keyset(meta, accountSorts, nil).Build()
+	require.NoError(t, err)
+	require.Equal(t, `SELECT * FROM "accounts" ORDER BY "id" DESC LIMIT 50`, stmt.SQL)
+
+	_, err = Select().From("accounts").Keyset(pagination.NewMetadata(1, 50, nil, nil), accountSorts, nil).Build()
+	require.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestInsertUpdateDelete(t *testing.T) {
+	stmt, err := InsertInto("accounts").
+		Columns("id", "email").
+		Values("1", "a@b.c").
+		Values("2", "d@e.f").
+		OnConflictUpdate([]string{"id"}, "email").
+		Returning("id").
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, `INSERT INTO "accounts" ("id", "email") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "email" = EXCLUDED."email" RETURNING "id"`, stmt.SQL)
+	require.Len(t, stmt.Args, 4)
+
+	_, err = InsertInto("accounts").Columns("id", "email").Values("1").Build()
+	require.ErrorIs(t, err, ErrInvalidQuery)
+
+	stmt, err = Update("accounts").Set("email", "x@y.z").Where(Eq("id", "1")).Build()
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "accounts" SET "email" = $1 WHERE "id" = $2`, stmt.SQL)
+	require.Equal(t, `UPDATE "accounts" SET "email" = 'x@y.z' WHERE "id" = '1'`, stmt.Debug())
+
+	_, err = Update("accounts").Set("email", "x@y.z").Build()
+	require.ErrorIs(t, err, ErrInvalidQuery)
+
+	stmt, err = DeleteFrom("accounts").Where(NotEq("status", "active")).Returning("id").Build()
+	require.NoError(t, err)
+	require.Equal(t, `DELETE FROM "accounts" WHERE "status" <> $1 RETURNING "id"`, stmt.SQL)
+
+	_, err = DeleteFrom("accounts").Build()
+	require.ErrorIs(t, err, ErrInvalidQuery)
+}
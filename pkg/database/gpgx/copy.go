@@ -0,0 +1,443 @@
+package gpgx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
+)
+
+// Copier runs COPY FROM STDIN, like pgx.Tx, *pgxpool.Pool and PgConnection.
+type Copier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// CopyToer runs COPY TO STDOUT, like *pgconn.PgConn and PgConnection.
+type CopyToer interface {
+	CopyTo(ctx context.Context, w io.Writer, sql string) (pgconn.CommandTag, error)
+}
+
+var (
+	_ Copier   = (*PgConnection)(nil)
+	_ CopyToer = (*PgConnection)(nil)
+)
+
+// CopyFrom runs COPY FROM STDIN in the transaction carried by ctx or, without one, in
+// the primary. It is never retried, rowSrc being consumed by the first attempt.
+func (pgc *PgConnection) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (n int64, err error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.CopyFrom(ctx, tableName, columnNames, rowSrc)
+	}
+
+	err = pgc.attempt(ctx, func(p *pools) error {
+		if p.conn == nil {
+			return new(NotConnectedError)
+		}
+		n, err = p.conn.CopyFrom(ctx, tableName, columnNames, rowSrc)
+		return err
+	})
+	return n, err
+}
+
+// CopyTo runs COPY TO STDOUT in the transaction carried by ctx or, without one, in the
+// primary, writing the output to w.
+func (pgc *PgConnection) CopyTo(ctx context.Context, w io.Writer, sql string) (tag pgconn.CommandTag, err error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Conn().PgConn().CopyTo(ctx, w, sql)
+	}
+
+	err = pgc.attempt(ctx, func(p *pools) error {
+		if p.conn == nil {
+			return new(NotConnectedError)
+		}
+		conn, err := p.conn.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		tag, err = conn.Conn().PgConn().CopyTo(ctx, w, sql)
+		return err
+	})
+	return tag, err
+}
+
+// Iterator yields the rows of a bulk insert.
+type Iterator[T any] interface {
+	Next() bool
+	Value() T
+	Err() error
+}
+
+// SliceIterator iterates over items.
+func SliceIterator[T any](items []T) Iterator[T] {
+	return &sliceIterator[T]{items: items, pos: -1}
+}
+
+type sliceIterator[T any] struct {
+	items []T
+	pos   int
+}
+
+func (si *sliceIterator[T]) Next() bool {
+	si.pos++
+	return si.pos < len(si.items)
+}
+
+func (si *sliceIterator[T]) Value() T {
+	return si.items[si.pos]
+}
+
+func (si *sliceIterator[T]) Err() error {
+	return nil
+}
+
+// FuncIterator iterates over the values returned by next until it returns false or an
+// error, e.g. to stream the lines of a file without loading it.
+func FuncIterator[T any](next func() (T, bool, error)) Iterator[T] {
+	return &funcIterator[T]{next: next}
+}
+
+type funcIterator[T any] struct {
+	next  func() (T, bool, error)
+	err   error
+	value T
+}
+
+func (fi *funcIterator[T]) Next() bool {
+	if fi.err != nil {
+		return false
+	}
+
+	var ok bool
+	fi.value, ok, fi.err = fi.next()
+	return ok && fi.err == nil
+}
+
+func (fi *funcIterator[T]) Value() T {
+	return fi.value
+}
+
+func (fi *funcIterator[T]) Err() error {
+	return fi.err
+}
+
+// BulkInsert streams structs to COPY, mapping their fields to the columns of table by the
+// `db` tags as Repository does. Generated columns are left to the database and the
+// tenant column is written with the tenant id of the context, or of the row in contexts
+// marked by tenant.System.
+//
+// With SetUpsert, the rows are copied to a temporary staging table first, then moved to
+// table with INSERT ... ON CONFLICT, in the transaction carried by the context or else in
+// one of its own. The rows of a bulk upsert must not repeat a conflict key.
+type BulkInsert[T any] struct {
+	db            Copier
+	progress      func(rows int64)
+	table         pgx.Identifier
+	columns       []column
+	conflict      []string
+	progressEvery int64
+	tenant        bool
+}
+
+// NewBulkInsert creates the bulk insert of T in table, which may be schema qualified.
+func NewBulkInsert[T any](db Copier, table string) (*BulkInsert[T], error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("gpgx: bulk insert rows must be structs, got %s", rt)
+	}
+
+	b := &BulkInsert[T]{db: db, table: pgx.Identifier(strings.Split(table, "."))}
+
+	seen := make(map[string]bool)
+	collectColumns(rt, nil, func(c column) {
+		if seen[c.name] || c.generated {
+			return
+		}
+		seen[c.name] = true
+		b.columns = append(b.columns, c)
+		b.tenant = b.tenant || c.tenant
+	})
+
+	if len(b.columns) == 0 {
+		return nil, fmt.Errorf("gpgx: %s has no writable field with a %q tag", rt, tagDb)
+	}
+
+	return b, nil
+}
+
+// SetUpsert updates the rows conflicting on the conflict columns instead of failing.
+func (b *BulkInsert[T]) SetUpsert(conflict ...string) *BulkInsert[T] {
+	b.conflict = conflict
+	return b
+}
+
+// SetProgress calls fn with the number of rows streamed so far every every rows, and
+// once more with the total when the copy ends.
+func (b *BulkInsert[T]) SetProgress(every int64, fn func(rows int64)) *BulkInsert[T] {
+	b.progressEvery = every
+	b.progress = fn
+	return b
+}
+
+// Columns returns the copied columns, in field order.
+func (b *BulkInsert[T]) Columns() []string {
+	names := make([]string, 0, len(b.columns))
+	for _, c := range b.columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// Slice inserts items.
+func (b *BulkInsert[T]) Slice(ctx context.Context, items []T) (int64, error) {
+	return b.Run(ctx, SliceIterator(items))
+}
+
+// Run inserts the rows of it and returns how many were copied.
+func (b *BulkInsert[T]) Run(ctx context.Context, it Iterator[T]) (int64, error) {
+	src := &copySource[T]{it: it, columns: b.columns, progress: b.progress, every: b.progressEvery}
+	if b.tenant && !tenant.IsSystem(ctx) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return 0, err
+		}
+		src.tenantID = tenantID
+	}
+
+	var (
+		n   int64
+		err error
+	)
+	if len(b.conflict) == 0 {
+		n, err = b.db.CopyFrom(ctx, b.table, b.Columns(), src)
+	} else {
+		n, err = b.upsert(ctx, src)
+	}
+	if err == nil && b.progress != nil {
+		b.progress(n)
+	}
+
+	return n, err
+}
+
+// stagingSeq numbers the staging tables, so bulk upserts may share a transaction.
+var stagingSeq atomic.Uint64
+
+func (b *BulkInsert[T]) upsert(ctx context.Context, src pgx.CopyFromSource) (n int64, err error) {
+	db := b.db
+	if _, ok := TxFromContext(ctx); !ok {
+		if beginner, ok := db.(TxBeginner); ok {
+			tx, beginErr := beginner.BeginTx(ctx, pgx.TxOptions{})
+			if beginErr != nil {
+				return 0, beginErr
+			}
+			defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+			db = tx
+			defer func() {
+				if err == nil {
+					err = tx.Commit(ctx)
+				}
+			}()
+		}
+	}
+
+	staging := fmt.Sprintf("gpgx_staging_%d", stagingSeq.Add(1))
+	columns := quoteColumns(b.Columns())
+
+	_, err = db.Exec(ctx, fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		quote(staging), columns, b.table.Sanitize()))
+	if err != nil {
+		return 0, err
+	}
+
+	if n, err = db.CopyFrom(ctx, pgx.Identifier{staging}, b.Columns(), src); err != nil {
+		return 0, err
+	}
+
+	isConflict := make(map[string]bool, len(b.conflict))
+	for _, c := range b.conflict {
+		isConflict[c] = true
+	}
+	var (
+		sets        []string
+		tenantGuard string
+	)
+	for _, c := range b.columns {
+		if c.tenant {
+			// Never take over the row of another tenant.
+			tenantGuard = fmt.Sprintf(" WHERE %s.%s = EXCLUDED.%s", b.table.Sanitize(), quote(c.name), quote(c.name))
+		}
+		if !isConflict[c.name] && !c.tenant {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quote(c.name), quote(c.name)))
+		}
+	}
+	action := "DO NOTHING"
+	if len(sets) > 0 {
+		action = "DO UPDATE SET " + strings.Join(sets, ", ") + tenantGuard
+	}
+
+	_, err = db.Exec(ctx, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (%s) %s",
+		b.table.Sanitize(), columns, columns, quote(staging),
+		quoteColumns(b.conflict), action))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.Exec(ctx, "DROP TABLE "+quote(staging))
+	return n, err
+}
+
+// copySource adapts an Iterator to pgx.CopyFromSource.
+type copySource[T any] struct {
+	it       Iterator[T]
+	progress func(rows int64)
+	tenantID string
+	columns  []column
+	rows     int64
+	every    int64
+}
+
+func (cs *copySource[T]) Next() bool {
+	if !cs.it.Next() {
+		return false
+	}
+
+	cs.rows++
+	if cs.progress != nil && cs.every > 0 && cs.rows%cs.every == 0 {
+		cs.progress(cs.rows)
+	}
+	return true
+}
+
+func (cs *copySource[T]) Values() ([]any, error) {
+	item := cs.it.Value()
+	rv := reflect.ValueOf(&item).Elem()
+
+	values := make([]any, len(cs.columns))
+	for i, c := range cs.columns {
+		if c.tenant && cs.tenantID != "" {
+			values[i] = cs.tenantID
+			continue
+		}
+		values[i] = rv.FieldByIndex(c.index).Interface()
+	}
+	return values, nil
+}
+
+func (cs *copySource[T]) Err() error {
+	return cs.it.Err()
+}
+
+// Export streams the result of a query as CSV with COPY TO STDOUT.
+type Export struct {
+	db            CopyToer
+	progress      func(rows int64)
+	query         string
+	args          []any
+	delimiter     rune
+	progressEvery int64
+	header        bool
+}
+
+// NewExport creates the export of query, a SELECT or a table name. The args are
+// inlined with SanitizeSQL, COPY taking no parameters.
+func NewExport(db CopyToer, query string, args ...any) *Export {
+	return &Export{db: db, query: query, args: args, delimiter: ',', header: true}
+}
+
+// SetHeader sets whether the first line names the columns, true by default.
+func (e *Export) SetHeader(header bool) *Export {
+	e.header = header
+	return e
+}
+
+func (e *Export) SetDelimiter(delimiter rune) *Export {
+	e.delimiter = delimiter
+	return e
+}
+
+// SetProgress calls fn with the number of lines written so far every every lines, and
+// once more with the number of rows exported when the copy ends. Lines are counted as
+// they are written, so values holding line breaks make the running count approximate.
+func (e *Export) SetProgress(every int64, fn func(rows int64)) *Export {
+	e.progressEvery = every
+	e.progress = fn
+	return e
+}
+
+// SQL returns the COPY statement.
+func (e *Export) SQL() (string, error) {
+	query := e.query
+	if len(e.args) > 0 {
+		sanitized, err := SanitizeSQL(query, e.args...)
+		if err != nil {
+			return "", fmt.Errorf("gpgx: export: %w", err)
+		}
+		query = sanitized
+	}
+
+	source := pgx.Identifier(strings.Split(query, ".")).Sanitize()
+	if len(strings.Fields(query)) > 1 {
+		source = "(" + query + ")"
+	}
+
+	return fmt.Sprintf("COPY %s TO STDOUT WITH (FORMAT csv, HEADER %t, DELIMITER %s)",
+		source, e.header, quoteLiteral(string(e.delimiter))), nil
+}
+
+// To writes the CSV to w and returns how many rows were exported.
+func (e *Export) To(ctx context.Context, w io.Writer) (int64, error) {
+	sql, err := e.SQL()
+	if err != nil {
+		return 0, err
+	}
+
+	if e.progress != nil && e.progressEvery > 0 {
+		w = &lineCounter{w: w, every: e.progressEvery, progress: e.progress}
+	}
+
+	tag, err := e.db.CopyTo(ctx, w, sql)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.progress != nil {
+		e.progress(tag.RowsAffected())
+	}
+	return tag.RowsAffected(), nil
+}
+
+// lineCounter reports the lines written through it.
+type lineCounter struct {
+	w        io.Writer
+	progress func(rows int64)
+	lines    int64
+	every    int64
+}
+
+func (lc *lineCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' {
+			continue
+		}
+		lc.lines++
+		if lc.lines%lc.every == 0 {
+			lc.progress(lc.lines)
+		}
+	}
+	return lc.w.Write(p)
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
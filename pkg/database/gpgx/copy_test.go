@@ -0,0 +1,147 @@
+package gpgx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCopier records the statements and reads every row of the copies.
+type fakeCopier struct {
+	rows  [][]any
+	stmts []string
+}
+
+func (fc *fakeCopier) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	fc.stmts = append(fc.stmts, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (fc *fakeCopier) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	fc.stmts = append(fc.stmts, "COPY "+tableName.Sanitize()+" ("+strings.Join(columnNames, ", ")+")")
+
+	var n int64
+	for rowSrc.Next() {
+		values, err := rowSrc.Values()
+		if err != nil {
+			return n, err
+		}
+		fc.rows = append(fc.rows, values)
+		n++
+	}
+	return n, rowSrc.Err()
+}
+
+type rate struct {
+	ID       int64   `db:"id,generated"`
+	TenantID string  `db:"tenant_id,tenant"`
+	Currency string  `db:"currency"`
+	Day      string  `db:"day"`
+	Value    float64 `db:"value"`
+}
+
+func TestBulkInsert(t *testing.T) {
+	ctx := TenantIDContext(context.Background(), "t1")
+	db := &fakeCopier{}
+
+	bulk, err := NewBulkInsert[rate](db, "fx.rates")
+	require.NoError(t, err)
+	require.Equal(t, []string{"tenant_id", "currency", "day", "value"}, bulk.Columns())
+
+	var progress []int64
+	bulk.SetProgress(2, func(rows int64) { progress = append(progress, rows) })
+
+	n, err := bulk.Slice(ctx, []rate{
+		{Currency: "BRL", Day: "2024-01-01", Value: 5.1},
+		{Currency: "USD", Day: "2024-01-01", Value: 1},
+		{Currency: "EUR", Day: "2024-01-01", Value: 0.9, TenantID: "t2"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, []int64{2, 3}, progress)
+	require.Equal(t, []string{`COPY "fx"."rates" (tenant_id, currency, day, value)`}, db.stmts)
+	require.Equal(t, []any{"t1", "EUR", "2024-01-01", 0.9}, db.rows[2])
+
+	_, err = bulk.Slice(context.Background(), nil)
+	require.ErrorIs(t, err, ErrTenantRequired)
+}
+
+func TestBulkUpsert(t *testing.T) {
+	db := &fakeCopier{}
+
+	bulk, err := NewBulkInsert[rate](db, "rates")
+	require.NoError(t, err)
+
+	items := []rate{{Currency: "BRL", Day: "2024-01-01", Value: 5.1}}
+	n, err := bulk.SetUpsert("tenant_id", "currency", "day").
+		Run(TenantIDContext(context.Background(), "t1"), FuncIterator(func() (rate, bool, error) {
+			if len(items) == 0 {
+				return rate{}, false, nil
+			}
+			item := items[0]
+			items = items[1:]
+			return item, true, nil
+		}))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	require.Len(t, db.stmts, 4)
+	require.Regexp(t, `^CREATE TEMP TABLE "gpgx_staging_\d+" ON COMMIT DROP AS SELECT "tenant_id", "currency", "day", "value" FROM "rates" WITH NO DATA$`, db.stmts[0])
+	require.Regexp(t, `^INSERT INTO "rates" .* SELECT .* FROM "gpgx_staging_\d+" ON CONFLICT \("tenant_id", "currency", "day"\) DO UPDATE SET "value" = EXCLUDED."value" WHERE "rates"."tenant_id" = EXCLUDED."tenant_id"$`, db.stmts[2])
+	require.True(t, strings.HasPrefix(db.stmts[3], "DROP TABLE"))
+}
+
+func TestBulkInsertIteratorError(t *testing.T) {
+	bulk, err := NewBulkInsert[rate](&fakeCopier{}, "rates")
+	require.NoError(t, err)
+
+	failure := errors.New("malformed line")
+	_, err = bulk.Run(TenantIDContext(context.Background(), "t1"), FuncIterator(func() (rate, bool, error) {
+		return rate{}, false, failure
+	}))
+	require.ErrorIs(t, err, failure)
+}
+
+// fakeCopyToer writes a CSV of rows lines.
+type fakeCopyToer struct {
+	sql  string
+	rows int
+}
+
+func (fc *fakeCopyToer) CopyTo(ctx context.Context, w io.Writer, sql string) (pgconn.CommandTag, error) {
+	fc.sql = sql
+	for i := 0; i < fc.rows; i++ {
+		if _, err := io.WriteString(w, "BRL,5.1\n"); err != nil {
+			return pgconn.CommandTag{}, err
+		}
+	}
+	return pgconn.NewCommandTag("COPY 3"), nil
+}
+
+func TestExport(t *testing.T) {
+	db := &fakeCopyToer{rows: 3}
+
+	var (
+		buf      bytes.Buffer
+		progress []int64
+	)
+	n, err := NewExport(db, "SELECT currency, value FROM rates WHERE day = $1", "2024-01-01").
+		SetHeader(false).
+		SetProgress(2, func(rows int64) { progress = append(progress, rows) }).
+		To(context.Background(), &buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, []int64{2, 3}, progress)
+	require.Equal(t, 3, strings.Count(buf.String(), "\n"))
+	require.Equal(t, `COPY (SELECT currency, value FROM rates WHERE day = '2024-01-01') TO STDOUT WITH (FORMAT csv, HEADER false, DELIMITER ',')`, db.sql)
+
+	sql, err := NewExport(db, "fx.rates").SetDelimiter(';').SQL()
+	require.NoError(t, err)
+	require.Equal(t, `COPY "fx"."rates" TO STDOUT WITH (FORMAT csv, HEADER true, DELIMITER ';')`, sql)
+}
@@ -0,0 +1,107 @@
+package gpgx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB is an IDB recording the statements it receives and answering every query with
+// the same rows.
+type fakeDB struct {
+	statements []statement
+	columns    []string
+	rows       [][]any
+	affected   int64
+	err        error
+}
+
+type statement struct {
+	sql  string
+	args []any
+}
+
+func (fdb *fakeDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	fdb.statements = append(fdb.statements, statement{sql, arguments})
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", fdb.affected)), fdb.err
+}
+
+func (fdb *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	fdb.statements = append(fdb.statements, statement{sql, args})
+	if fdb.err != nil {
+		return nil, fdb.err
+	}
+	return &fakeRows{columns: fdb.columns, rows: fdb.rows, pos: -1}, nil
+}
+
+func (fdb *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := fdb.Query(ctx, sql, args...)
+	return fakeRow{rows: rows, err: err}
+}
+
+func (fdb *fakeDB) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	panic("not implemented")
+}
+
+func (fdb *fakeDB) last() statement {
+	return fdb.statements[len(fdb.statements)-1]
+}
+
+type fakeRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (fr fakeRow) Scan(dest ...any) error {
+	if fr.err != nil {
+		return fr.err
+	}
+	defer fr.rows.Close()
+	if !fr.rows.Next() {
+		return pgx.ErrNoRows
+	}
+	return fr.rows.Scan(dest...)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]any
+	pos     int
+}
+
+func (fr *fakeRows) Close()                        {}
+func (fr *fakeRows) Err() error                    { return nil }
+func (fr *fakeRows) CommandTag() pgconn.CommandTag { return pgconn.NewCommandTag("SELECT") }
+func (fr *fakeRows) Conn() *pgx.Conn               { return nil }
+func (fr *fakeRows) RawValues() [][]byte           { return nil }
+
+func (fr *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	fds := make([]pgconn.FieldDescription, 0, len(fr.columns))
+	for _, c := range fr.columns {
+		fds = append(fds, pgconn.FieldDescription{Name: c})
+	}
+	return fds
+}
+
+func (fr *fakeRows) Next() bool {
+	fr.pos++
+	return fr.pos < len(fr.rows)
+}
+
+func (fr *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		v := fr.rows[fr.pos][i]
+		if v == nil {
+			continue
+		}
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+func (fr *fakeRows) Values() ([]any, error) {
+	return fr.rows[fr.pos], nil
+}
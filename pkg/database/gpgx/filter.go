@@ -0,0 +1,129 @@
+package gpgx
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	opEq        = "="
+	opNotEq     = "<>"
+	opGt        = ">"
+	opGte       = ">="
+	opLt        = "<"
+	opLte       = "<="
+	opLike      = "LIKE"
+	opILike     = "ILIKE"
+	opIn        = "IN"
+	opBetween   = "BETWEEN"
+	opIsNull    = "IS NULL"
+	opIsNotNull = "IS NOT NULL"
+)
+
+// Filter is a condition on a column, rendered with positional parameters. Build it with
+// Eq, In, Like, Range, IsNull and the other constructors.
+type Filter struct {
+	Value  any
+	Column string
+	op     string
+	Values []any
+}
+
+// Eq matches the rows where column equals value.
+func Eq(column string, value any) Filter {
+	return Filter{Column: column, op: opEq, Value: value}
+}
+
+// NotEq matches the rows where column differs from value.
+func NotEq(column string, value any) Filter {
+	return Filter{Column: column, op: opNotEq, Value: value}
+}
+
+func Gt(column string, value any) Filter {
+	return Filter{Column: column, op: opGt, Value: value}
+}
+
+func Gte(column string, value any) Filter {
+	return Filter{Column: column, op: opGte, Value: value}
+}
+
+func Lt(column string, value any) Filter {
+	return Filter{Column: column, op: opLt, Value: value}
+}
+
+func Lte(column string, value any) Filter {
+	return Filter{Column: column, op: opLte, Value: value}
+}
+
+// Like matches column against a LIKE pattern; ILike ignores case.
+func Like(column, pattern string) Filter {
+	return Filter{Column: column, op: opLike, Value: pattern}
+}
+
+func ILike(column, pattern string) Filter {
+	return Filter{Column: column, op: opILike, Value: pattern}
+}
+
+// In matches the rows where column is one of values. No values match no rows.
+func In[V any](column string, values ...V) Filter {
+	vals := make([]any, 0, len(values))
+	for _, v := range values {
+		vals = append(vals, v)
+	}
+	return Filter{Column: column, op: opIn, Values: vals}
+}
+
+// Range matches the rows where column is between from and to, inclusive. A nil bound
+// leaves that side open.
+func Range(column string, from, to any) Filter {
+	switch {
+	case from != nil && to != nil:
+		return Filter{Column: column, op: opBetween, Values: []any{from, to}}
+	case from != nil:
+		return Gte(column, from)
+	case to != nil:
+		return Lte(column, to)
+	default:
+		return Filter{Column: column, op: opIsNotNull}
+	}
+}
+
+func IsNull(column string) Filter {
+	return Filter{Column: column, op: opIsNull}
+}
+
+func IsNotNull(column string) Filter {
+	return Filter{Column: column, op: opIsNotNull}
+}
+
+// render appends the values of the filter to args and returns the condition. Filters
+// not built by the constructors fail with ErrInvalidQuery.
+func (f Filter) render(args []any) (string, []any, error) {
+	col := quoteColumn(f.Column)
+
+	switch f.op {
+	case opIsNull, opIsNotNull:
+		return fmt.Sprintf("%s %s", col, f.op), args, nil
+	case opIn:
+		if len(f.Values) == 0 {
+			return "FALSE", args, nil
+		}
+		placeholders := make([]string, 0, len(f.Values))
+		for _, v := range f.Values {
+			args = append(args, v)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		return fmt.Sprintf("%s IN (%s)", col, strings.Join(placeholders, ", ")), args, nil
+	case opBetween:
+		if len(f.Values) != 2 {
+			return "", nil, fmt.Errorf("gpgx: %w: BETWEEN on %q needs 2 values", ErrInvalidQuery, f.Column)
+		}
+		args = append(args, f.Values...)
+		return fmt.Sprintf("%s BETWEEN $%d AND $%d", col, len(args)-1, len(args)), args, nil
+	case opEq, opNotEq, opGt, opGte, opLt, opLte, opLike, opILike:
+		args = append(args, f.Value)
+		return fmt.Sprintf("%s %s $%d", col, f.op, len(args)), args, nil
+	default:
+		return "", nil, fmt.Errorf("gpgx: %w: filter on %q without operator", ErrInvalidQuery, f.Column)
+	}
+}
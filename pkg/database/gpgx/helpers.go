@@ -1,12 +1,18 @@
 package gpgx
 
-import "context"
+import (
+	"context"
 
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
+)
+
+// TenantIDContext returns a copy of baseCtx carrying tenantID, like tenant.WithContext.
 func TenantIDContext(baseCtx context.Context, tenantID string) context.Context {
-	if baseCtx == nil {
-		baseCtx = context.TODO()
-	}
+	return tenant.WithContext(baseCtx, tenantID)
+}
 
-	//lint:ignore SA1029 - tentant_id is string
-	return context.WithValue(baseCtx, "tenant_id", tenantID)
+// TenantIDFromContext returns the tenant id set by TenantIDContext, empty without one.
+func TenantIDFromContext(ctx context.Context) string {
+	tenantID, _ := tenant.FromContext(ctx)
+	return tenantID
 }
@@ -55,3 +55,8 @@ type Tx interface {
 type Conn interface {
 	Pool() *pgxpool.Pool
 }
+
+var (
+	_ IDB        = (*PgConnection)(nil)
+	_ TxBeginner = (*PgConnection)(nil)
+)
@@ -0,0 +1,319 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	jsoniter "github.com/json-iterator/go"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+const (
+	DEFAULT_LISTENER_BACKOFF     = 500 * time.Millisecond
+	DEFAULT_LISTENER_MAX_BACKOFF = 30 * time.Second
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+var (
+	ErrListenerRunning      = errors.New("gpgx: listener already running")
+	ErrListenerDisconnected = errors.New("gpgx: listener disconnected")
+)
+
+// NotificationHandler handles the notifications of a channel. Handlers run one at a time
+// in the listener goroutine, so a slow handler delays the next notifications.
+type NotificationHandler func(ctx context.Context, notification *pgconn.Notification)
+
+// registration is a handler of a channel. The handlers of Notifications send to
+// subscriber, closed and unregistered when Run returns.
+type registration struct {
+	handler    NotificationHandler
+	subscriber chan *pgconn.Notification
+}
+
+// listenerConn is the part of *pgx.Conn used by the listener.
+type listenerConn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+// Listener delivers the notifications sent with NOTIFY or pg_notify. It holds a
+// dedicated connection, outside the pool, which is opened again after a failure and
+// listens to every registered channel again. Notifications sent while it is
+// disconnected are lost, SetOnReconnect lets the consumers catch up.
+type Listener struct {
+	connect     func(ctx context.Context) (listenerConn, error)
+	handlers    map[string][]registration
+	onReconnect func(ctx context.Context)
+	wake        chan struct{}
+	lastErr     atomic.Pointer[error]
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	mtx         sync.RWMutex
+	connected   atomic.Bool
+	running     atomic.Bool
+}
+
+func NewListener(connString string) *Listener {
+	return &Listener{
+		connect: func(ctx context.Context) (listenerConn, error) {
+			return pgx.Connect(ctx, connString)
+		},
+		handlers:   make(map[string][]registration),
+		wake:       make(chan struct{}, 1),
+		backoff:    DEFAULT_LISTENER_BACKOFF,
+		maxBackoff: DEFAULT_LISTENER_MAX_BACKOFF,
+	}
+}
+
+// NewListener returns a listener connecting to the primary database.
+func (pgc *PgConnection) NewListener() *Listener {
+	return NewListener(pgc.connString)
+}
+
+// SetReconnectBackoff sets the initial and maximum wait between two connection attempts.
+func (l *Listener) SetReconnectBackoff(initial, max time.Duration) *Listener {
+	l.backoff = initial
+	l.maxBackoff = max
+	return l
+}
+
+// SetOnReconnect sets a function called once the listener listens again after a
+// connection loss, e.g. to invalidate a whole cache.
+func (l *Listener) SetOnReconnect(fn func(ctx context.Context)) *Listener {
+	l.onReconnect = fn
+	return l
+}
+
+// Listen registers handler for the notifications of channel. It may be called while
+// the listener runs.
+func (l *Listener) Listen(channel string, handler NotificationHandler) *Listener {
+	return l.register(channel, registration{handler: handler})
+}
+
+func (l *Listener) register(channel string, reg registration) *Listener {
+	l.mtx.Lock()
+	l.handlers[channel] = append(l.handlers[channel], reg)
+	l.mtx.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+
+	return l
+}
+
+// Notifications returns a Go channel receiving the notifications of channel, closed
+// when Run returns. The listener waits for the receiver once buffer notifications are
+// pending. A Listener run again needs Notifications to be called again.
+func (l *Listener) Notifications(channel string, buffer int) <-chan *pgconn.Notification {
+	ch := make(chan *pgconn.Notification, buffer)
+
+	l.register(channel, registration{
+		subscriber: ch,
+		handler: func(ctx context.Context, notification *pgconn.Notification) {
+			select {
+			case ch <- notification:
+			case <-ctx.Done():
+			}
+		},
+	})
+
+	return ch
+}
+
+// Connected reports whether the listener listens to its channels.
+func (l *Listener) Connected() bool {
+	return l.connected.Load()
+}
+
+// Check fails while the listener is disconnected, to be registered as a health check.
+func (l *Listener) Check(ctx context.Context) error {
+	if l.connected.Load() {
+		return nil
+	}
+
+	if err := l.lastErr.Load(); err != nil {
+		return fmt.Errorf("%w: %w", ErrListenerDisconnected, *err)
+	}
+	return ErrListenerDisconnected
+}
+
+// Run listens until ctx is done, connecting again after every failure.
+func (l *Listener) Run(ctx context.Context) error {
+	if !l.running.CompareAndSwap(false, true) {
+		return ErrListenerRunning
+	}
+	defer l.stop()
+
+	for attempt, reconnected := 0, false; ; attempt++ {
+		conn, err := l.connect(ctx)
+		if err == nil {
+			err = l.serve(ctx, conn, reconnected, func() { attempt = 0 })
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		l.lastErr.Store(&err)
+		reconnected = true
+		logger.Warn(ctx, "gpgx: listener disconnected - "+err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(jitteredBackoff(l.backoff, l.maxBackoff, attempt)):
+		}
+	}
+}
+
+func (l *Listener) stop() {
+	l.connected.Store(false)
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	// Unregistered with their channel, so running again does not send to it.
+	for channel, regs := range l.handlers {
+		kept := regs[:0]
+		for _, reg := range regs {
+			if reg.subscriber != nil {
+				close(reg.subscriber)
+				continue
+			}
+			kept = append(kept, reg)
+		}
+		if len(kept) == 0 {
+			delete(l.handlers, channel)
+		} else {
+			l.handlers[channel] = kept
+		}
+	}
+	l.running.Store(false)
+}
+
+// serve listens on conn until it fails. listened is called once every channel is listened.
+func (l *Listener) serve(ctx context.Context, conn listenerConn, reconnected bool, listened func()) error {
+	defer func() {
+		l.connected.Store(false)
+		_ = conn.Close(context.WithoutCancel(ctx))
+	}()
+
+	listening := make(map[string]bool)
+	if err := l.listen(ctx, conn, listening); err != nil {
+		return err
+	}
+
+	l.connected.Store(true)
+	l.lastErr.Store(nil)
+	listened()
+	if reconnected && l.onReconnect != nil {
+		l.onReconnect(ctx)
+	}
+
+	for {
+		if err := l.listen(ctx, conn, listening); err != nil {
+			return err
+		}
+
+		notification, err := l.wait(ctx, conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, context.Canceled) {
+				// Woken up by Listen, the new channels are listened above.
+				continue
+			}
+			return err
+		}
+
+		l.dispatch(ctx, notification)
+	}
+}
+
+// wait waits for the next notification, returning early when Listen registers a channel.
+// The deadline set when the wait is canceled leaves the connection usable.
+func (l *Listener) wait(ctx context.Context, conn listenerConn) (*pgconn.Notification, error) {
+	waitCtx, cancel := context.WithCancel(ctx)
+	woken := make(chan struct{})
+
+	go func() {
+		defer close(woken)
+		select {
+		case <-l.wake:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	notification, err := conn.WaitForNotification(waitCtx)
+
+	// Outliving the wait, the goroutine would take the wake up meant for the next one.
+	cancel()
+	<-woken
+
+	return notification, err
+}
+
+// listen runs LISTEN for the registered channels not in listening yet.
+func (l *Listener) listen(ctx context.Context, conn listenerConn, listening map[string]bool) error {
+	l.mtx.RLock()
+	var channels []string
+	for channel := range l.handlers {
+		if !listening[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	l.mtx.RUnlock()
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+		listening[channel] = true
+	}
+
+	return nil
+}
+
+func (l *Listener) dispatch(ctx context.Context, notification *pgconn.Notification) {
+	l.mtx.RLock()
+	regs := append([]registration(nil), l.handlers[notification.Channel]...)
+	l.mtx.RUnlock()
+
+	for _, reg := range regs {
+		reg.handler(ctx, notification)
+	}
+}
+
+// DecodeNotification decodes the JSON payload of notification.
+func DecodeNotification[T any](notification *pgconn.Notification) (T, error) {
+	var payload T
+	if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+		return payload, fmt.Errorf("gpgx: decode notification of %s: %w", notification.Channel, err)
+	}
+	return payload, nil
+}
+
+// JSONHandler returns a handler decoding the JSON payloads into T before calling fn.
+// Payloads failing to decode are logged and skipped.
+func JSONHandler[T any](fn func(ctx context.Context, payload T)) NotificationHandler {
+	return func(ctx context.Context, notification *pgconn.Notification) {
+		payload, err := DecodeNotification[T](notification)
+		if err != nil {
+			logger.Error(ctx, err.Error())
+			return
+		}
+		fn(ctx, payload)
+	}
+}
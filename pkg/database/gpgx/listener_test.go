@@ -0,0 +1,150 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListenerConn delivers the notifications sent on its channel and fails once broken.
+type fakeListenerConn struct {
+	notifications chan *pgconn.Notification
+	broken        chan struct{}
+	mtx           sync.Mutex
+	listened      []string
+}
+
+func newFakeListenerConn() *fakeListenerConn {
+	return &fakeListenerConn{
+		notifications: make(chan *pgconn.Notification),
+		broken:        make(chan struct{}),
+	}
+}
+
+func (fc *fakeListenerConn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	fc.listened = append(fc.listened, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (fc *fakeListenerConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case n := <-fc.notifications:
+		return n, nil
+	case <-fc.broken:
+		return nil, errors.New("unexpected EOF")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (fc *fakeListenerConn) Close(ctx context.Context) error {
+	return nil
+}
+
+func (fc *fakeListenerConn) statements() []string {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	return append([]string(nil), fc.listened...)
+}
+
+func TestListenerReconnects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conns := make(chan *fakeListenerConn, 2)
+	reconnected := make(chan struct{}, 1)
+	first, second := newFakeListenerConn(), newFakeListenerConn()
+	conns <- first
+	conns <- second
+
+	type rate struct {
+		Currency string `json:"currency"`
+	}
+	rates := make(chan rate, 1)
+
+	l := NewListener("").
+		SetReconnectBackoff(time.Millisecond, time.Millisecond).
+		SetOnReconnect(func(ctx context.Context) { reconnected <- struct{}{} }).
+		Listen("rates", JSONHandler(func(ctx context.Context, payload rate) { rates <- payload }))
+	l.connect = func(ctx context.Context) (listenerConn, error) {
+		return <-conns, nil
+	}
+	require.ErrorIs(t, l.Check(ctx), ErrListenerDisconnected)
+
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+
+	first.notifications <- &pgconn.Notification{Channel: "rates", Payload: `{"currency":"BRL"}`}
+	require.Equal(t, rate{Currency: "BRL"}, <-rates)
+	require.NoError(t, l.Check(ctx))
+	require.Equal(t, []string{`LISTEN "rates"`}, first.statements())
+
+	// A channel registered while running is listened at once.
+	notifications := l.Notifications("fees", 1)
+	require.Eventually(t, func() bool { return len(first.statements()) == 2 }, time.Second, time.Millisecond)
+	first.notifications <- &pgconn.Notification{Channel: "fees", Payload: "1"}
+	require.Equal(t, "1", (<-notifications).Payload)
+
+	close(first.broken)
+	<-reconnected
+	require.ElementsMatch(t, []string{`LISTEN "rates"`, `LISTEN "fees"`}, second.statements())
+	second.notifications <- &pgconn.Notification{Channel: "rates", Payload: `{"currency":"USD"}`}
+	require.Equal(t, rate{Currency: "USD"}, <-rates)
+
+	require.ErrorIs(t, l.Run(ctx), ErrListenerRunning)
+
+	cancel()
+	require.NoError(t, <-done)
+	_, open := <-notifications
+	require.False(t, open)
+	require.False(t, l.Connected())
+}
+
+func TestListenerRunsAgainAfterStop(t *testing.T) {
+	conn := newFakeListenerConn()
+	received := make(chan string, 1)
+
+	l := NewListener("").Listen("rates", func(ctx context.Context, n *pgconn.Notification) { received <- n.Payload })
+	l.connect = func(ctx context.Context) (listenerConn, error) { return conn, nil }
+	stale := l.Notifications("fees", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+	require.Eventually(t, l.Connected, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	_, open := <-stale
+	require.False(t, open)
+
+	// The closed channel is not sent to anymore, the other handlers still run.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() { done <- l.Run(ctx) }()
+	require.Eventually(t, l.Connected, time.Second, time.Millisecond)
+
+	conn.notifications <- &pgconn.Notification{Channel: "fees", Payload: "1"}
+	conn.notifications <- &pgconn.Notification{Channel: "rates", Payload: "2"}
+	require.Equal(t, "2", <-received)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestDecodeNotification(t *testing.T) {
+	_, err := DecodeNotification[map[string]string](&pgconn.Notification{Channel: "rates", Payload: "{"})
+	require.ErrorContains(t, err, "decode notification of rates")
+
+	payload, err := DecodeNotification[map[string]string](&pgconn.Notification{Payload: `{"id":"1"}`})
+	require.NoError(t, err)
+	require.Equal(t, "1", payload["id"])
+}
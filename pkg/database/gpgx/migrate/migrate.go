@@ -0,0 +1,426 @@
+// Package migrate applies versioned SQL migrations to Postgres.
+//
+// Migrations are pairs of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, the down file being optional, read from an fs.FS, like an
+// embed.FS, or a directory. Applied versions are recorded in a table and concurrent
+// runs, from several pods starting together, are serialized by an advisory lock.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+const (
+	DEFAULT_TABLE = "gpgx_schema_migrations"
+	// DEFAULT_LOCK_ID is the key of the advisory lock taken while migrating.
+	DEFAULT_LOCK_ID int64 = 0x67706778_6d696772
+
+	DIRECTION_UP   = "up"
+	DIRECTION_DOWN = "down"
+
+	// noTransaction, in the first line of a file, runs it out of a transaction, as
+	// required by statements like CREATE INDEX CONCURRENTLY.
+	noTransaction = "-- gpgx:no-transaction"
+
+	sqlstateUndefinedTable = "42P01"
+)
+
+var (
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+	ErrNoDownMigration  = errors.New("migration has no down file")
+
+	fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+)
+
+// Conn is a single database connection, like *pgx.Conn or *pgxpool.Conn. The advisory
+// lock belongs to the session, so the whole run must use the same connection.
+type Conn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+type Migration struct {
+	Name    string
+	Up      string
+	Down    string
+	Version int64
+}
+
+// Step is a migration applied, or only planned in dry run, in one direction.
+type Step struct {
+	Name      string
+	Direction string
+	SQL       string
+	Version   int64
+}
+
+// Status tells whether a known migration is applied.
+type Status struct {
+	Name    string
+	Version int64
+	Applied bool
+}
+
+type Migrator struct {
+	conn       Conn
+	table      string
+	migrations []Migration
+	lockID     int64
+	dryRun     bool
+}
+
+// NewMigrator returns a Migrator of the migrations read from fsys, an embed.FS for
+// instance, in the directory dir.
+func NewMigrator(conn Conn, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		conn:       conn,
+		table:      DEFAULT_TABLE,
+		lockID:     DEFAULT_LOCK_ID,
+		migrations: migrations,
+	}, nil
+}
+
+// NewDirMigrator returns a Migrator of the migrations in the directory dir.
+func NewDirMigrator(conn Conn, dir string) (*Migrator, error) {
+	return NewMigrator(conn, os.DirFS(dir), ".")
+}
+
+// SetTable sets the table recording the applied versions, optionally schema qualified.
+func (m *Migrator) SetTable(table string) *Migrator {
+	m.table = table
+	return m
+}
+
+// SetLockID sets the advisory lock key, so applications sharing a database migrate
+// independently.
+func (m *Migrator) SetLockID(id int64) *Migrator {
+	m.lockID = id
+	return m
+}
+
+// SetDryRun makes the Migrator return the steps it would run without changing anything.
+func (m *Migrator) SetDryRun(dryRun bool) *Migrator {
+	m.dryRun = dryRun
+	return m
+}
+
+// Migrations returns the known migrations, sorted by version.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies the pending migrations up to target, every one when target is zero.
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Step, error) {
+	if err := m.known(target); err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	err := m.locked(ctx, func(applied map[int64]bool) error {
+		for _, mg := range m.migrations {
+			if applied[mg.Version] || (target > 0 && mg.Version > target) {
+				continue
+			}
+
+			step := Step{Version: mg.Version, Name: mg.Name, Direction: DIRECTION_UP, SQL: mg.Up}
+			if err := m.apply(ctx, step); err != nil {
+				return err
+			}
+			steps = append(steps, step)
+		}
+		return nil
+	})
+
+	return steps, err
+}
+
+// Down rolls back the applied migrations above target, newest first. A zero target
+// rolls back everything.
+func (m *Migrator) Down(ctx context.Context, target int64) ([]Step, error) {
+	if err := m.known(target); err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	err := m.locked(ctx, func(applied map[int64]bool) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mg := m.migrations[i]
+			if !applied[mg.Version] || mg.Version <= target {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("migrate: %w: %d_%s", ErrNoDownMigration, mg.Version, mg.Name)
+			}
+
+			step := Step{Version: mg.Version, Name: mg.Name, Direction: DIRECTION_DOWN, SQL: mg.Down}
+			if err := m.apply(ctx, step); err != nil {
+				return err
+			}
+			steps = append(steps, step)
+		}
+		return nil
+	})
+
+	return steps, err
+}
+
+// Baseline records the migrations up to version as applied without running them, to
+// adopt a database created before the migrations.
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Step, error) {
+	if version <= 0 {
+		return nil, fmt.Errorf("migrate: %w: %d", ErrUnknownVersion, version)
+	}
+	if err := m.known(version); err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	err := m.locked(ctx, func(applied map[int64]bool) error {
+		for _, mg := range m.migrations {
+			if applied[mg.Version] || mg.Version > version {
+				continue
+			}
+
+			step := Step{Version: mg.Version, Name: mg.Name, Direction: DIRECTION_UP}
+			if !m.dryRun {
+				if _, err := m.conn.Exec(ctx, m.insertSQL(), mg.Version, mg.Name); err != nil {
+					return fmt.Errorf("migrate: baseline %d_%s: %w", mg.Version, mg.Name, err)
+				}
+			}
+			steps = append(steps, step)
+		}
+		return nil
+	})
+
+	return steps, err
+}
+
+// Status lists every known migration and whether it is applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		statuses = append(statuses, Status{Version: mg.Version, Name: mg.Name, Applied: applied[mg.Version]})
+	}
+
+	return statuses, nil
+}
+
+// locked runs fn holding the advisory lock, with the versions applied when it was taken.
+func (m *Migrator) locked(ctx context.Context, fn func(applied map[int64]bool) error) (err error) {
+	if _, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", m.lockID); err != nil {
+		return fmt.Errorf("migrate: lock: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := m.conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", m.lockID); unlockErr != nil {
+			err = errors.Join(err, fmt.Errorf("migrate: unlock: %w", unlockErr))
+		}
+	}()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	return fn(applied)
+}
+
+// apply runs a step and records it, in a single transaction unless the file opts out.
+func (m *Migrator) apply(ctx context.Context, step Step) error {
+	logger.Info(ctx, fmt.Sprintf("migrate: %s %d_%s", step.Direction, step.Version, step.Name))
+	if m.dryRun {
+		return nil
+	}
+
+	record, args := m.insertSQL(), []any{step.Version, step.Name}
+	if step.Direction == DIRECTION_DOWN {
+		record, args = m.deleteSQL(), []any{step.Version}
+	}
+
+	wrap := func(err error) error {
+		return fmt.Errorf("migrate: %s %d_%s: %w", step.Direction, step.Version, step.Name, err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(step.SQL), noTransaction) {
+		if _, err := m.conn.Exec(ctx, step.SQL); err != nil {
+			return wrap(err)
+		}
+		if _, err := m.conn.Exec(ctx, record, args...); err != nil {
+			return wrap(err)
+		}
+		return nil
+	}
+
+	tx, err := m.conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return wrap(err)
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	if _, err := tx.Exec(ctx, step.SQL); err != nil {
+		return wrap(err)
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return wrap(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// ensureTable creates the versions table, except in dry run where a missing table reads
+// as no version applied.
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	if m.dryRun {
+		return nil
+	}
+
+	_, err := m.conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, m.quotedTable()))
+	if err != nil {
+		return fmt.Errorf("migrate: create %s: %w", m.table, err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]bool, error) {
+	rows, err := m.conn.Query(ctx, fmt.Sprintf("SELECT version FROM %s", m.quotedTable()))
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read %s: %w", m.table, err)
+	}
+
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	var pgErr *pgconn.PgError
+	if m.dryRun && errors.As(err, &pgErr) && pgErr.Code == sqlstateUndefinedTable {
+		return map[int64]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read %s: %w", m.table, err)
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+func (m *Migrator) insertSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (version, name) VALUES ($1, $2)", m.quotedTable())
+}
+
+func (m *Migrator) deleteSQL() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.quotedTable())
+}
+
+func (m *Migrator) quotedTable() string {
+	return pgx.Identifier(strings.Split(m.table, ".")).Sanitize()
+}
+
+// known checks target, when set, is the version of a migration.
+func (m *Migrator) known(target int64) error {
+	if target == 0 {
+		return nil
+	}
+	for _, mg := range m.migrations {
+		if mg.Version == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("migrate: %w: %d", ErrUnknownVersion, target)
+}
+
+// Load reads the migrations in the directory dir of fsys, sorted by version. Files not
+// named like migrations are ignored.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mg
+		} else if mg.Name != match[2] {
+			return nil, fmt.Errorf("migrate: %w: %d (%s and %s)", ErrDuplicateVersion, version, mg.Name, match[2])
+		}
+
+		body := &mg.Up
+		if match[3] == DIRECTION_DOWN {
+			body = &mg.Down
+		}
+		if *body != "" {
+			return nil, fmt.Errorf("migrate: %w: %s", ErrDuplicateVersion, entry.Name())
+		}
+		*body = string(data)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" {
+			return nil, fmt.Errorf("migrate: %d_%s has no up file", mg.Version, mg.Name)
+		}
+		migrations = append(migrations, *mg)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
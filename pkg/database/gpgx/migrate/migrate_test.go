@@ -0,0 +1,194 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn logs the statements and keeps the applied versions in memory.
+type fakeConn struct {
+	applied map[int64]bool
+	log     []string
+}
+
+func newFakeConn(applied ...int64) *fakeConn {
+	fc := &fakeConn{applied: make(map[int64]bool)}
+	for _, v := range applied {
+		fc.applied[v] = true
+	}
+	return fc
+}
+
+func (fc *fakeConn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	switch {
+	case strings.HasPrefix(sql, "INSERT INTO"):
+		fc.applied[arguments[0].(int64)] = true
+		fc.log = append(fc.log, "record")
+	case strings.HasPrefix(sql, "DELETE FROM"):
+		delete(fc.applied, arguments[0].(int64))
+		fc.log = append(fc.log, "unrecord")
+	case strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS"):
+		fc.log = append(fc.log, "create table")
+	case strings.Contains(sql, "pg_advisory_lock"):
+		fc.log = append(fc.log, "lock")
+	case strings.Contains(sql, "pg_advisory_unlock"):
+		fc.log = append(fc.log, "unlock")
+	default:
+		fc.log = append(fc.log, strings.TrimSpace(sql))
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (fc *fakeConn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	versions := make([]int64, 0, len(fc.applied))
+	for v := range fc.applied {
+		versions = append(versions, v)
+	}
+	return &fakeRows{versions: versions, pos: -1}, nil
+}
+
+func (fc *fakeConn) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	fc.log = append(fc.log, "begin")
+	return &fakeTx{conn: fc}, nil
+}
+
+type fakeTx struct {
+	pgx.Tx
+	conn *fakeConn
+	done bool
+}
+
+func (ft *fakeTx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return ft.conn.Exec(ctx, sql, arguments...)
+}
+
+func (ft *fakeTx) Commit(ctx context.Context) error {
+	ft.done = true
+	ft.conn.log = append(ft.conn.log, "commit")
+	return nil
+}
+
+func (ft *fakeTx) Rollback(ctx context.Context) error {
+	if !ft.done {
+		ft.conn.log = append(ft.conn.log, "rollback")
+	}
+	return nil
+}
+
+type fakeRows struct {
+	pgx.Rows
+	versions []int64
+	pos      int
+}
+
+func (fr *fakeRows) Next() bool {
+	fr.pos++
+	return fr.pos < len(fr.versions)
+}
+
+func (fr *fakeRows) Scan(dest ...any) error {
+	*dest[0].(*int64) = fr.versions[fr.pos]
+	return nil
+}
+
+func (fr *fakeRows) Close()                        {}
+func (fr *fakeRows) Err() error                    { return nil }
+func (fr *fakeRows) CommandTag() pgconn.CommandTag { return pgconn.CommandTag{} }
+
+var migrations = fstest.MapFS{
+	"sql/1_accounts.up.sql":   {Data: []byte("CREATE TABLE accounts ()")},
+	"sql/1_accounts.down.sql": {Data: []byte("DROP TABLE accounts")},
+	"sql/2_index.up.sql":      {Data: []byte(noTransaction + "\nCREATE INDEX CONCURRENTLY i ON accounts (id)")},
+	"sql/2_index.down.sql":    {Data: []byte("DROP INDEX i")},
+	"sql/10_rates.up.sql":     {Data: []byte("CREATE TABLE rates ()")},
+	"sql/README.md":           {Data: []byte("ignored")},
+}
+
+func TestLoadSortsAndValidates(t *testing.T) {
+	loaded, err := Load(migrations, "sql")
+	require.NoError(t, err)
+	require.Len(t, loaded, 3)
+	require.Equal(t, []int64{1, 2, 10}, []int64{loaded[0].Version, loaded[1].Version, loaded[2].Version})
+	require.Equal(t, "DROP TABLE accounts", loaded[0].Down)
+
+	_, err = Load(fstest.MapFS{
+		"1_a.up.sql": {Data: []byte("SELECT 1")},
+		"1_b.up.sql": {Data: []byte("SELECT 1")},
+	}, ".")
+	require.ErrorIs(t, err, ErrDuplicateVersion)
+}
+
+func TestUpAppliesPendingMigrationsUnderLock(t *testing.T) {
+	conn := newFakeConn(1)
+	m, err := NewMigrator(conn, migrations, "sql")
+	require.NoError(t, err)
+
+	steps, err := m.Up(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	require.Equal(t, []string{
+		"lock", "create table",
+		noTransaction + "\nCREATE INDEX CONCURRENTLY i ON accounts (id)", "record",
+		"begin", "CREATE TABLE rates ()", "record", "commit",
+		"unlock",
+	}, conn.log)
+	require.True(t, conn.applied[10])
+}
+
+func TestUpStopsAtTargetAndDryRunChangesNothing(t *testing.T) {
+	conn := newFakeConn()
+	m, err := NewMigrator(conn, migrations, "sql")
+	require.NoError(t, err)
+
+	steps, err := m.SetDryRun(true).Up(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	require.Equal(t, []string{"lock", "unlock"}, conn.log)
+	require.Empty(t, conn.applied)
+
+	_, err = m.Up(context.Background(), 3)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+func TestDownRollsBackNewestFirst(t *testing.T) {
+	conn := newFakeConn(1, 2)
+	m, err := NewMigrator(conn, migrations, "sql")
+	require.NoError(t, err)
+
+	steps, err := m.Down(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, 1}, []int64{steps[0].Version, steps[1].Version})
+	require.Empty(t, conn.applied)
+
+	conn = newFakeConn(1, 2, 10)
+	m, err = NewMigrator(conn, migrations, "sql")
+	require.NoError(t, err)
+	_, err = m.Down(context.Background(), 2)
+	require.ErrorIs(t, err, ErrNoDownMigration)
+	require.Equal(t, "unlock", conn.log[len(conn.log)-1])
+}
+
+func TestBaselineRecordsWithoutRunning(t *testing.T) {
+	conn := newFakeConn()
+	m, err := NewMigrator(conn, migrations, "sql")
+	require.NoError(t, err)
+
+	steps, err := m.Baseline(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	require.Equal(t, []string{"lock", "create table", "record", "record", "unlock"}, conn.log)
+
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Status{
+		{Version: 1, Name: "accounts", Applied: true},
+		{Version: 2, Name: "index", Applied: true},
+		{Version: 10, Name: "rates"},
+	}, statuses)
+}
@@ -5,38 +5,146 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
 )
 
-type MultiTenantConfig struct{}
+const (
+	// TENANT_SETTING holds the tenant the row level security policies compare to:
+	//
+	//	CREATE POLICY tenant_isolation ON rates
+	//		USING (tenant_id = current_setting('app.current_tenant', true)
+	//			OR current_setting('app.bypass_tenant', true) = 'on');
+	TENANT_SETTING = "app.current_tenant"
+	// BYPASS_SETTING is "on" for the contexts marked by tenant.System.
+	BYPASS_SETTING = "app.bypass_tenant"
+
+	scopeSQL = "SELECT set_config($1, $2, $3), set_config($4, $5, $3)"
+)
+
+// TenantScopeError reports a connection that could not be scoped to its tenant.
+type TenantScopeError struct {
+	Err      error
+	TenantID string
+}
+
+func (e *TenantScopeError) Error() string {
+	return fmt.Sprintf("gpgx: scope connection to tenant %q: %v", e.TenantID, e.Err)
+}
+
+func (e *TenantScopeError) Unwrap() error {
+	return e.Err
+}
+
+// MultiTenantConfig scopes the connections to the tenant of the context: with
+// TENANCY_RLS, row level security restricts every statement to it, with TENANCY_SCHEMA
+// the search_path is its schema. Transactions are scoped with SET LOCAL by
+// PgConnection.BeginTx, statements out of a transaction by the pool hooks, which scope
+// the connection while it is acquired. TENANCY_POOL connections need no scope.
+type MultiTenantConfig struct {
+	resolveSchema SchemaResolver
+	strategy      string
+}
 
-// beforeAcquireHook should be called before a connection is acquired from the pool.
+// beforeAcquireHook scopes the connection before it is acquired from the pool. A context
+// without tenant leaves it unscoped, matching no row; PgConnection rejects such
+// contexts with tenant.ErrRequired before acquiring. A connection failing to be scoped
+// is destroyed.
 func (mtc *MultiTenantConfig) beforeAcquireHook(ctx context.Context, conn *pgx.Conn) bool {
-	if tid := ctx.Value("tenant_id"); tid != nil && tid != "" {
-		if tenantID, ok := tid.(string); ok {
-			_, err := conn.Exec(ctx, "select set_config($1,$2,$3);", "app.current_tenant", tenantID, false)
-			if err != nil {
-				fmt.Printf("Failed to set tenant ID for session: %s\n", err.Error())
-			}
-		} else {
-			fmt.Println("Tenant ID set is not a string")
-			return false
-		}
-	} else {
+	if err := mtc.scope(ctx, conn, false); err != nil {
+		logger.Error(ctx, err.Error())
 		return false
 	}
 
 	return true
 }
 
-// afterReleaseHook should be called after a connection is released, but before it is returned to the pool.
+// afterReleaseHook unscopes the connection after it is released, before it is returned to
+// the pool. A connection failing to be unscoped is destroyed.
 func (mtc *MultiTenantConfig) afterReleaseHook(conn *pgx.Conn) bool {
-	// Undo what was done in BeforeAcquire.
-	// Set the configuration to empty before this connection is released to the pool.
-	_, err := conn.Exec(context.TODO(), "select set_config($1,$2,$3);", "app.current_tenant", "", false)
+	var err error
+	switch mtc.strategy {
+	case TENANCY_SCHEMA:
+		_, err = conn.Exec(context.TODO(), "RESET search_path")
+	case TENANCY_POOL:
+	default:
+		_, err = conn.Exec(context.TODO(), scopeSQL, TENANT_SETTING, "", false, BYPASS_SETTING, "off")
+	}
 	if err != nil {
-		fmt.Printf("Failed to unset tenant ID for session: %s", err.Error())
+		logger.Error(context.TODO(), "gpgx: unscope connection - "+err.Error())
 		return false
 	}
 
 	return true
 }
+
+// scope scopes db to the tenant of ctx, up to the end of the transaction when local.
+func (mtc *MultiTenantConfig) scope(ctx context.Context, db IDB, local bool) error {
+	switch mtc.strategy {
+	case TENANCY_SCHEMA:
+		return scopeSchema(ctx, db, local, mtc.resolveSchema)
+	case TENANCY_POOL:
+		return nil
+	default:
+		return scopeTenant(ctx, db, local)
+	}
+}
+
+// requireTenant fails closed with tenant.ErrRequired when ctx carries neither a tenant
+// nor the tenant.System mark.
+func requireTenant(ctx context.Context) error {
+	if tenant.IsSystem(ctx) {
+		return nil
+	}
+	_, err := tenant.Require(ctx)
+	return err
+}
+
+// ScopeTx scopes tx to the tenant of ctx with SET LOCAL, up to its end. Transactions
+// begun by PgConnection are scoped already.
+func ScopeTx(ctx context.Context, tx IDB) error {
+	if err := requireTenant(ctx); err != nil {
+		return err
+	}
+	return scopeTenant(ctx, tx, true)
+}
+
+func scopeTenant(ctx context.Context, db IDB, local bool) error {
+	tenantID, _ := tenant.FromContext(ctx)
+	bypass := "off"
+	if tenant.IsSystem(ctx) {
+		bypass = "on"
+	}
+
+	if _, err := db.Exec(ctx, scopeSQL, TENANT_SETTING, tenantID, local, BYPASS_SETTING, bypass); err != nil {
+		return &TenantScopeError{TenantID: tenantID, Err: err}
+	}
+	return nil
+}
+
+// scopeSchema sets the search_path to the schema of the tenant of ctx, alone, so a table
+// missing from it is never read from another schema. Shared objects must be schema
+// qualified. Contexts marked by tenant.System keep the default search_path.
+func scopeSchema(ctx context.Context, db IDB, local bool, resolve SchemaResolver) error {
+	if tenant.IsSystem(ctx) {
+		return nil
+	}
+
+	tenantID, _ := tenant.FromContext(ctx)
+	if tenantID == "" {
+		// Nothing resolves in an empty search_path, failing closed.
+		_, err := db.Exec(ctx, "SELECT set_config('search_path', '', $1)", local)
+		return err
+	}
+
+	schema, err := resolve(tenantID)
+	if err != nil {
+		return &TenantScopeError{TenantID: tenantID, Err: err}
+	}
+
+	if _, err := db.Exec(ctx, "SELECT set_config('search_path', $1, $2)", pgx.Identifier{schema}.Sanitize(), local); err != nil {
+		return &TenantScopeError{TenantID: tenantID, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build integration
+
+package gpgx
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
+)
+
+// rlsRole runs the statements of the test, superusers and table owners bypassing the
+// row level security.
+const rlsRole = "gpgx_rls_app"
+
+const rlsSetup = `
+DROP TABLE IF EXISTS gpgx_rls_rates;
+CREATE TABLE gpgx_rls_rates (
+	id SERIAL PRIMARY KEY,
+	tenant_id TEXT NOT NULL,
+	currency TEXT NOT NULL
+);
+ALTER TABLE gpgx_rls_rates ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON gpgx_rls_rates
+	USING (tenant_id = current_setting('app.current_tenant', true) OR current_setting('app.bypass_tenant', true) = 'on')
+	WITH CHECK (tenant_id = current_setting('app.current_tenant', true) OR current_setting('app.bypass_tenant', true) = 'on');
+DO $$ BEGIN CREATE ROLE gpgx_rls_app NOLOGIN; EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+GRANT SELECT, INSERT, UPDATE, DELETE ON gpgx_rls_rates TO gpgx_rls_app;
+GRANT USAGE ON SEQUENCE gpgx_rls_rates_id_seq TO gpgx_rls_app;
+`
+
+// TestRowLevelSecurityIsolatesTenants needs a superuser url of a scratch database in
+// GPGX_TEST_DATABASE_URL, run with: go test -tags integration ./pkg/database/gpgx/
+func TestRowLevelSecurityIsolatesTenants(t *testing.T) {
+	dsn := os.Getenv("GPGX_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("GPGX_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, dsn)
+	require.NoError(t, err)
+	defer admin.Close(ctx)
+	_, err = admin.Exec(ctx, rlsSetup)
+	require.NoError(t, err)
+	defer admin.Exec(ctx, "DROP TABLE gpgx_rls_rates")
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("options", "-c role="+rlsRole)
+	u.RawQuery = q.Encode()
+
+	db := NewPgConnection().SetMultiTenantEnabled(true).SetMinConns(1).SetMaxConns(2)
+	require.NoError(t, db.NewPool(ctx, u.String()))
+	defer db.Close()
+
+	t1, t2 := tenant.WithContext(ctx, "t1"), tenant.WithContext(ctx, "t2")
+	insert := "INSERT INTO gpgx_rls_rates (tenant_id, currency) VALUES ($1, $2)"
+
+	_, err = db.Exec(t1, insert, "t1", "BRL")
+	require.NoError(t, err)
+	_, err = db.Exec(t2, insert, "t2", "USD")
+	require.NoError(t, err)
+
+	// A tenant cannot write the rows of another.
+	_, err = db.Exec(t1, insert, "t2", "EUR")
+	require.Error(t, err)
+
+	count := func(ctx context.Context) (n int) {
+		require.NoError(t, db.QueryRow(ctx, "SELECT count(*) FROM gpgx_rls_rates").Scan(&n))
+		return n
+	}
+	require.Equal(t, 1, count(t1))
+	require.Equal(t, 1, count(t2))
+	require.Equal(t, 2, count(tenant.System(ctx)))
+
+	// Transactions are scoped with SET LOCAL.
+	tx, err := db.BeginTx(t2, pgx.TxOptions{})
+	require.NoError(t, err)
+	var currency string
+	require.NoError(t, tx.QueryRow(t2, "SELECT currency FROM gpgx_rls_rates").Scan(&currency))
+	require.Equal(t, "USD", currency)
+	var scoped string
+	require.NoError(t, tx.QueryRow(t2, "SELECT current_setting('app.current_tenant')").Scan(&scoped))
+	require.Equal(t, "t2", scoped)
+	require.NoError(t, tx.Commit(ctx))
+
+	// Without a tenant, gpgx fails closed and a bare pool connection sees no row.
+	_, err = db.Exec(ctx, "DELETE FROM gpgx_rls_rates")
+	require.ErrorIs(t, err, tenant.ErrRequired)
+	var n int
+	require.NoError(t, db.Pool().QueryRow(ctx, "SELECT count(*) FROM gpgx_rls_rates").Scan(&n))
+	require.Zero(t, n)
+}
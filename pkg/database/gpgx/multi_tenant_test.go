@@ -0,0 +1,71 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
+)
+
+func TestMultiTenantFailsClosed(t *testing.T) {
+	primary := &fakePool{}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary).SetMultiTenantEnabled(true)
+	ctx := context.Background()
+
+	_, err := pgc.Exec(ctx, "DELETE FROM rates")
+	require.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = pgc.BeginTx(ctx, pgx.TxOptions{})
+	require.ErrorIs(t, err, ErrTenantRequired)
+	require.ErrorIs(t, pgc.QueryRow(ctx, "SELECT 1").Scan(), tenant.ErrRequired)
+	require.Empty(t, primary.statements)
+
+	_, err = pgc.Exec(tenant.WithContext(ctx, "t1"), "DELETE FROM rates")
+	require.NoError(t, err)
+	_, err = pgc.Exec(tenant.System(ctx), "DELETE FROM rates")
+	require.NoError(t, err)
+	require.Len(t, primary.statements, 2)
+}
+
+func TestBeginTxScopesTenant(t *testing.T) {
+	primary := &fakePool{}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary).SetMultiTenantEnabled(true)
+
+	tx, err := pgc.BeginTx(tenant.WithContext(context.Background(), "t1"), pgx.TxOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, tx)
+	require.Equal(t, []string{"begin", scopeSQL}, primary.beginner.log)
+}
+
+func TestScopeTx(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDB{}
+
+	require.ErrorIs(t, ScopeTx(ctx, db), tenant.ErrRequired)
+
+	require.NoError(t, ScopeTx(tenant.WithContext(ctx, "t1"), db))
+	require.NoError(t, ScopeTx(tenant.System(ctx), db))
+	require.Equal(t, []any{TENANT_SETTING, "t1", true, BYPASS_SETTING, "off"}, db.statements[0].args)
+	require.Equal(t, []any{TENANT_SETTING, "", true, BYPASS_SETTING, "on"}, db.statements[1].args)
+
+	db.err = errors.New("connection reset")
+	var scopeErr *TenantScopeError
+	require.ErrorAs(t, ScopeTx(tenant.WithContext(ctx, "t2"), db), &scopeErr)
+	require.Equal(t, "t2", scopeErr.TenantID)
+}
+
+func TestRepositorySystemContext(t *testing.T) {
+	db := &fakeDB{}
+	repo, err := NewRepository[tenantAccount](db, "accounts")
+	require.NoError(t, err)
+
+	_, err = repo.FindMany(context.Background())
+	require.ErrorIs(t, err, ErrTenantRequired)
+
+	_, err = repo.FindMany(tenant.System(context.Background()))
+	require.NoError(t, err)
+	require.NotContains(t, db.statements[0].sql, "WHERE")
+}
@@ -0,0 +1,155 @@
+package gpgx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrNamedArg = errors.New("named argument")
+
+// namedArg is a :name or @name parameter.
+type namedArg struct {
+	name   string
+	prefix byte
+}
+
+func (na namedArg) String() string {
+	return string(na.prefix) + na.name
+}
+
+// Compile replaces the :name and @name parameters of the query with positional ones,
+// returning the SQL and the arguments to run it with. arg is a map with string keys,
+// like pgx.NamedArgs, or a struct, or a pointer to one, whose fields are named by their
+// db tag, or else match the name ignoring case. A name used twice is bound once.
+// Compile fails when a name is missing from arg or the query also has positional
+// parameters.
+func (q *Query) Compile(arg any) (string, []any, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		sb        strings.Builder
+		args      []any
+		positions = make(map[string]int)
+	)
+	for _, part := range q.Parts {
+		switch part := part.(type) {
+		case string:
+			sb.WriteString(part)
+		case namedArg:
+			pos, ok := positions[part.name]
+			if !ok {
+				value, found := lookup(part.name)
+				if !found {
+					return "", nil, fmt.Errorf("gpgx: %w %s not found in %T", ErrNamedArg, part, arg)
+				}
+				args = append(args, value)
+				pos = len(args)
+				positions[part.name] = pos
+			}
+			sb.WriteString("$" + strconv.Itoa(pos))
+		case int:
+			return "", nil, fmt.Errorf("gpgx: %w: positional parameter $%d among named ones", ErrNamedArg, part)
+		default:
+			return "", nil, fmt.Errorf("invalid Part type: %T", part)
+		}
+	}
+
+	return sb.String(), args, nil
+}
+
+// SanitizeNamed replaces the named parameters with the values of arg, see Compile and
+// Sanitize.
+func (q *Query) SanitizeNamed(arg any) (string, error) {
+	sql, args, err := q.Compile(arg)
+	if err != nil {
+		return "", err
+	}
+	return SanitizeSQL(sql, args...)
+}
+
+// CompileNamed compiles the named parameters of sql into positional ones, see
+// Query.Compile.
+func CompileNamed(sql string, arg any) (string, []any, error) {
+	query, err := NewQuery(sql)
+	if err != nil {
+		return "", nil, err
+	}
+	return query.Compile(arg)
+}
+
+// SanitizeNamedSQL replaces the named parameters of sql with the values of arg. Like
+// SanitizeSQL, it is only safe when standard_conforming_strings is on.
+func SanitizeNamedSQL(sql string, arg any) (string, error) {
+	query, err := NewQuery(sql)
+	if err != nil {
+		return "", err
+	}
+	return query.SanitizeNamed(arg)
+}
+
+// Named returns the statement of sql with its named parameters bound to arg, to run
+// with its Args or log with Debug.
+func Named(sql string, arg any) (Statement, error) {
+	sql, args, err := CompileNamed(sql, arg)
+	if err != nil {
+		return Statement{}, err
+	}
+	return Statement{SQL: sql, Args: args}, nil
+}
+
+// namedLookup returns the function finding the values of arg by name.
+func namedLookup(arg any) (func(name string) (any, bool), error) {
+	rv := reflect.ValueOf(arg)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("gpgx: %w: nil %T", ErrNamedArg, arg)
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("gpgx: %w: map keys of %T are not strings", ErrNamedArg, arg)
+		}
+		return func(name string) (any, bool) {
+			value := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+			if !value.IsValid() {
+				return nil, false
+			}
+			return value.Interface(), true
+		}, nil
+
+	case reflect.Struct:
+		fields := make(map[string][]int)
+		collectColumns(rv.Type(), nil, func(c column) {
+			fields[c.name] = c.index
+		})
+		return func(name string) (any, bool) {
+			if index, ok := fields[name]; ok {
+				return rv.FieldByIndex(index).Interface(), true
+			}
+			sf, ok := rv.Type().FieldByNameFunc(func(field string) bool {
+				return strings.EqualFold(field, name)
+			})
+			if !ok || !sf.IsExported() {
+				return nil, false
+			}
+			// Fails through a nil embedded pointer.
+			value, err := rv.FieldByIndexErr(sf.Index)
+			if err != nil {
+				return nil, false
+			}
+			return value.Interface(), true
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("gpgx: %w: %T is neither a map nor a struct", ErrNamedArg, arg)
+	}
+}
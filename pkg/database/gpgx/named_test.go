@@ -0,0 +1,59 @@
+package gpgx
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type namedBase struct {
+	TenantID string `db:"tenant_id"`
+}
+
+type namedAccount struct {
+	namedBase
+	ID    int64  `db:"id"`
+	Email string `db:"email"`
+	Name  string
+}
+
+func TestCompileStruct(t *testing.T) {
+	sql, args, err := CompileNamed(
+		"UPDATE accounts SET email = :email, name = @name WHERE id = :id AND tenant_id = :tenant_id AND :id > 0 AND created_at > now()::date",
+		&namedAccount{namedBase: namedBase{TenantID: "t1"}, ID: 7, Email: "x@y.z", Name: "bob"},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "UPDATE accounts SET email = $1, name = $2 WHERE id = $3 AND tenant_id = $4 AND $3 > 0 AND created_at > now()::date", sql)
+	require.Equal(t, []any{"x@y.z", "bob", int64(7), "t1"}, args)
+}
+
+func TestCompileMap(t *testing.T) {
+	stmt, err := Named("SELECT * FROM accounts WHERE id = ANY(@ids) AND email = :email", pgx.NamedArgs{
+		"ids":   []int64{1, 2},
+		"email": "o'k",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM accounts WHERE id = ANY($1) AND email = $2", stmt.SQL)
+	require.Equal(t, `SELECT * FROM accounts WHERE id = ANY('{"1","2"}') AND email = 'o''k'`, stmt.Debug())
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, _, err := CompileNamed("SELECT :missing", map[string]any{})
+	require.ErrorIs(t, err, ErrNamedArg)
+
+	_, _, err = CompileNamed("SELECT :a, $1", map[string]any{"a": 1})
+	require.ErrorIs(t, err, ErrNamedArg)
+
+	_, _, err = CompileNamed("SELECT :a", 1)
+	require.ErrorIs(t, err, ErrNamedArg)
+
+	_, _, err = CompileNamed("SELECT :a", (*namedAccount)(nil))
+	require.ErrorIs(t, err, ErrNamedArg)
+}
+
+func TestSanitizeNamedSQL(t *testing.T) {
+	sql, err := SanitizeNamedSQL("SELECT * FROM accounts WHERE id = :id OR email = :email", namedAccount{ID: -1, Email: "a"})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM accounts WHERE id = (-1) OR email = 'a'", sql)
+}
@@ -0,0 +1,176 @@
+package gpgx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ObfuscateSQL replaces the string, dollar quoted and numeric literals of sql with ?,
+// keeping the placeholders, identifiers and comments, so a statement can be traced or
+// logged without the values inlined in it.
+func ObfuscateSQL(sql string) string {
+	var sb strings.Builder
+	sb.Grow(len(sql))
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			sb.WriteByte('?')
+			i = skipQuoted(sql, i, '\'')
+		case (c == 'e' || c == 'E') && i+1 < len(sql) && sql[i+1] == '\'' && (i == 0 || !isIdentifierByte(sql[i-1])):
+			sb.WriteByte('?')
+			i = skipEscapeQuoted(sql, i+1)
+		case c == '"':
+			end := skipQuoted(sql, i, '"')
+			sb.WriteString(sql[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			sb.WriteString(sql[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := skipBlockComment(sql, i)
+			sb.WriteString(sql[i:end])
+			i = end
+		case c == '$':
+			if end, ok := skipDollarQuoted(sql, i); ok {
+				sb.WriteByte('?')
+				i = end
+				break
+			}
+			// A placeholder, $1, is kept with its digits.
+			end := i + 1
+			for end < len(sql) && isDigit(sql[end]) {
+				end++
+			}
+			sb.WriteString(sql[i:end])
+			i = end
+		case isDigit(c) && (i == 0 || !isIdentifierByte(sql[i-1])):
+			sb.WriteByte('?')
+			i = skipNumber(sql, i)
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	return sb.String()
+}
+
+// RedactArgs describes args by their types, NULL for nil, instead of their values.
+func RedactArgs(args []any) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			redacted[i] = "NULL"
+			continue
+		}
+		redacted[i] = fmt.Sprintf("%T", arg)
+	}
+	return redacted
+}
+
+// skipQuoted returns the index following the literal quoted by quote at start, a doubled
+// quote being part of it.
+func skipQuoted(sql string, start int, quote byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+// skipEscapeQuoted returns the index following the E'...' literal quoted at start, where a
+// backslash escapes the character after it.
+func skipEscapeQuoted(sql string, start int) int {
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\':
+			i++
+		case sql[i] != '\'':
+		case i+1 < len(sql) && sql[i+1] == '\'':
+			i++
+		default:
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the index following the /* */ comment at start, nested
+// comments included.
+func skipBlockComment(sql string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(sql); i++ {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i++
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// skipDollarQuoted returns the index following the $tag$ quoted literal at start, or
+// false when start is not the opening of one.
+func skipDollarQuoted(sql string, start int) (int, bool) {
+	end := start + 1
+	for end < len(sql) && sql[end] != '$' {
+		if !isIdentifierByte(sql[end]) || isDigit(sql[end]) && end == start+1 {
+			return 0, false
+		}
+		end++
+	}
+	if end >= len(sql) {
+		return 0, false
+	}
+
+	tag := sql[start : end+1]
+	closing := strings.Index(sql[end+1:], tag)
+	if closing < 0 {
+		return len(sql), true
+	}
+	return end + 1 + closing + len(tag), true
+}
+
+func skipNumber(sql string, start int) int {
+	i := start
+	for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.') {
+		i++
+	}
+	if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+		j := i + 1
+		if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+			j++
+		}
+		if j < len(sql) && isDigit(sql[j]) {
+			for i = j; i < len(sql) && isDigit(sql[i]); i++ {
+			}
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c >= 0x80
+}
@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics exports the relay activity to Prometheus.
+type Metrics struct {
+	lag       prometheus.Gauge
+	published *prometheus.CounterVec
+	failed    *prometheus.CounterVec
+	dead      *prometheus.CounterVec
+}
+
+// NewMetrics registers the outbox_relay_lag_seconds gauge and the outbox_published_total,
+// outbox_failed_total and outbox_dead_total counters with registry, usually
+// prometheus.DefaultRegisterer.
+func NewMetrics(registry prometheus.Registerer) *Metrics {
+	return &Metrics{
+		lag: promauto.With(registry).NewGauge(prometheus.GaugeOpts{
+			Name: "outbox_relay_lag_seconds",
+			Help: "Age of the oldest event waiting to be published.",
+		}),
+		published: promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+			Name: "outbox_published_total",
+			Help: "Events published, by topic.",
+		}, []string{"topic"}),
+		failed: promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+			Name: "outbox_failed_total",
+			Help: "Publications failed and scheduled again, by topic.",
+		}, []string{"topic"}),
+		dead: promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+			Name: "outbox_dead_total",
+			Help: "Events dead lettered after every attempt failed, by topic.",
+		}, []string{"topic"}),
+	}
+}
+
+func (m *Metrics) incPublished(topic string) {
+	if m != nil {
+		m.published.WithLabelValues(topic).Inc()
+	}
+}
+
+func (m *Metrics) incFailed(topic string) {
+	if m != nil {
+		m.failed.WithLabelValues(topic).Inc()
+	}
+}
+
+func (m *Metrics) incDead(topic string) {
+	if m != nil {
+		m.dead.WithLabelValues(topic).Inc()
+	}
+}
@@ -0,0 +1,124 @@
+// Package outbox publishes domain events reliably with the transactional outbox pattern.
+//
+// Events are written by Enqueue in the transaction changing the data they describe, so
+// both are committed or none is. A Relay reads the committed events and hands them to a
+// Publisher. Delivery is at least once: an event may be published again when the relay
+// stops between publishing it and recording it, so consumers must dedupe by Event.ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx"
+)
+
+const DEFAULT_TABLE = "outbox"
+
+var (
+	ErrNoTransaction = errors.New("outbox: enqueue requires a transaction")
+	ErrInvalidEvent  = errors.New("outbox: event requires a topic and a payload")
+)
+
+// Event is a domain event. Payload is JSON.
+type Event struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ID        string            `json:"id"`
+	Topic     string            `json:"topic"`
+	Key       string            `json:"key,omitempty"`
+	Payload   json.RawMessage   `json:"payload"`
+	Attempts  int               `json:"attempts"`
+}
+
+// NewEvent returns an event of topic about the aggregate key, with payload marshaled to
+// JSON.
+func NewEvent(topic, key string, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("outbox: marshal payload: %w", err)
+	}
+	return Event{Topic: topic, Key: key, Payload: data}, nil
+}
+
+// Outbox writes events to the outbox table.
+type Outbox struct {
+	table string
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{table: DEFAULT_TABLE}
+}
+
+// SetTable sets the outbox table, optionally schema qualified.
+func (o *Outbox) SetTable(table string) *Outbox {
+	o.table = table
+	return o
+}
+
+// Enqueue writes event in tx, or in the transaction carried by ctx when tx is nil, so it
+// is published only if the transaction commits. The ID and the creation time are set
+// when missing. Outside a transaction it fails with ErrNoTransaction.
+func (o *Outbox) Enqueue(ctx context.Context, tx gpgx.IDB, event Event) (Event, error) {
+	if tx == nil {
+		ctxTx, ok := gpgx.TxFromContext(ctx)
+		if !ok {
+			return event, ErrNoTransaction
+		}
+		tx = ctxTx
+	}
+
+	if event.Topic == "" || len(event.Payload) == 0 {
+		return event, ErrInvalidEvent
+	}
+	if event.ID == "" {
+		event.ID = ulid.Make().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	if event.Headers == nil {
+		event.Headers = map[string]string{}
+	}
+
+	_, err := tx.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s (id, topic, key, payload, headers, created_at, available_at) VALUES ($1, $2, $3, $4, $5, $6, $6)",
+		quote(o.table),
+	), event.ID, event.Topic, event.Key, []byte(event.Payload), event.Headers, event.CreatedAt)
+	if err != nil {
+		return event, gpgx.WrapPgError(err)
+	}
+
+	return event, nil
+}
+
+// Schema returns the DDL of the outbox table, to be added to the migrations.
+func Schema(table string) string {
+	name := strings.ReplaceAll(table, ".", "_")
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id TEXT PRIMARY KEY,
+	topic TEXT NOT NULL,
+	key TEXT NOT NULL DEFAULT '',
+	payload JSONB NOT NULL,
+	headers JSONB NOT NULL DEFAULT '{}',
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	published_at TIMESTAMPTZ,
+	dead_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS %[2]s_pending_idx ON %[1]s (available_at) WHERE published_at IS NULL AND dead_at IS NULL;
+`, quote(table), name)
+}
+
+func quote(table string) string {
+	return pgx.Identifier(strings.Split(table, ".")).Sanitize()
+}
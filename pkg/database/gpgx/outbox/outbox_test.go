@@ -0,0 +1,222 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx"
+)
+
+// fakeStore keeps the outbox rows in memory and applies the relay statements to them.
+type fakeStore struct {
+	rows      map[string]*fakeRow
+	order     []string
+	committed int
+}
+
+type fakeRow struct {
+	event     Event
+	lastError string
+	published bool
+	dead      bool
+}
+
+func newFakeStore(events ...Event) *fakeStore {
+	fs := &fakeStore{rows: make(map[string]*fakeRow)}
+	for _, ev := range events {
+		fs.rows[ev.ID] = &fakeRow{event: ev}
+		fs.order = append(fs.order, ev.ID)
+	}
+	return fs
+}
+
+func (fs *fakeStore) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return &fakeTx{store: fs}, nil
+}
+
+type fakeTx struct {
+	pgx.Tx
+	store *fakeStore
+	execs []string
+}
+
+func (ft *fakeTx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	ft.execs = append(ft.execs, sql)
+	if !strings.HasPrefix(sql, "UPDATE") {
+		return pgconn.CommandTag{}, nil
+	}
+
+	row := ft.store.rows[arguments[0].(string)]
+	row.event.Attempts = arguments[1].(int)
+	switch {
+	case strings.Contains(sql, "published_at = now()"):
+		row.published = true
+	case strings.Contains(sql, "dead_at = now()"):
+		row.dead = true
+		row.lastError = arguments[2].(string)
+	default:
+		row.lastError = arguments[2].(string)
+	}
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (ft *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	var events []Event
+	for _, id := range ft.store.order {
+		if row := ft.store.rows[id]; !row.published && !row.dead && len(events) < args[0].(int) {
+			events = append(events, row.event)
+		}
+	}
+	return &fakeRows{events: events, pos: -1}, nil
+}
+
+func (ft *fakeTx) Commit(ctx context.Context) error {
+	ft.store.committed++
+	return nil
+}
+
+func (ft *fakeTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+type fakeRows struct {
+	pgx.Rows
+	events []Event
+	pos    int
+}
+
+func (fr *fakeRows) Next() bool {
+	fr.pos++
+	return fr.pos < len(fr.events)
+}
+
+func (fr *fakeRows) Scan(dest ...any) error {
+	ev := fr.events[fr.pos]
+	*dest[0].(*string) = ev.ID
+	*dest[1].(*string) = ev.Topic
+	*dest[2].(*string) = ev.Key
+	*dest[3].(*json.RawMessage) = ev.Payload
+	*dest[4].(*map[string]string) = ev.Headers
+	*dest[5].(*int) = ev.Attempts
+	*dest[6].(*time.Time) = ev.CreatedAt
+	return nil
+}
+
+func (fr *fakeRows) Err() error { return nil }
+
+func (fr *fakeRows) Close() {}
+
+func TestEnqueue(t *testing.T) {
+	ctx := context.Background()
+	ob := NewOutbox().SetTable("events.outbox")
+
+	ev, err := NewEvent("order.created", "42", map[string]int{"total": 10})
+	require.NoError(t, err)
+
+	_, err = ob.Enqueue(ctx, nil, ev)
+	require.ErrorIs(t, err, ErrNoTransaction)
+
+	tx := &fakeTx{store: newFakeStore()}
+	_, err = ob.Enqueue(ctx, tx, Event{Topic: "order.created"})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+
+	ev, err = ob.Enqueue(gpgx.WithTx(ctx, tx), nil, ev)
+	require.NoError(t, err)
+	require.NotEmpty(t, ev.ID)
+	require.False(t, ev.CreatedAt.IsZero())
+	require.Len(t, tx.execs, 1)
+	require.True(t, strings.HasPrefix(tx.execs[0], `INSERT INTO "events"."outbox"`))
+}
+
+func TestRelayPublishes(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore(
+		Event{ID: "1", Topic: "order.created", Payload: json.RawMessage(`{}`)},
+		Event{ID: "2", Topic: "order.paid", Payload: json.RawMessage(`{}`)},
+	)
+	publisher := NewMemoryPublisher()
+
+	n, err := NewRelay(store, publisher).ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 1, store.committed)
+	require.Len(t, publisher.Events(), 2)
+	require.True(t, store.rows["1"].published)
+	require.Equal(t, 1, store.rows["2"].event.Attempts)
+
+	n, err = NewRelay(store, publisher).ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestRelayRetriesAndDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore(Event{ID: "1", Topic: "order.created", Payload: json.RawMessage(`{}`)})
+
+	publisher := NewMemoryPublisher()
+	publisher.Subscribe("order.created", func(ctx context.Context, event Event) error {
+		return errors.New("broker unavailable")
+	})
+	relay := NewRelay(store, publisher).SetMaxAttempts(2)
+
+	_, err := relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.False(t, store.rows["1"].dead)
+	require.Equal(t, "broker unavailable", store.rows["1"].lastError)
+
+	_, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.True(t, store.rows["1"].dead)
+	require.Equal(t, 2, store.rows["1"].event.Attempts)
+	require.Empty(t, publisher.Events())
+}
+
+func TestRelayTruncatesLastError(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore(Event{ID: "1", Topic: "order.created", Payload: json.RawMessage(`{}`)})
+
+	publisher := NewMemoryPublisher()
+	publisher.Subscribe("order.created", func(ctx context.Context, event Event) error {
+		return errors.New("x" + strings.Repeat("é", maxErrorLength))
+	})
+
+	_, err := NewRelay(store, publisher).ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.True(t, utf8.ValidString(store.rows["1"].lastError))
+	require.Len(t, store.rows["1"].lastError, maxErrorLength-1)
+}
+
+func TestRetryAfter(t *testing.T) {
+	relay := NewRelay(nil, nil).SetRetryBackoff(time.Second, 10*time.Second)
+
+	for attempt, max := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: 10 * time.Second, 70: 10 * time.Second} {
+		d := relay.retryAfter(attempt)
+		require.GreaterOrEqual(t, d, max/2)
+		require.LessOrEqual(t, d, max)
+	}
+}
+
+func TestRelaySettersKeepDefaultsForNonPositive(t *testing.T) {
+	relay := NewRelay(nil, nil).SetBatchSize(0).SetMaxAttempts(-1).SetPollInterval(0)
+
+	require.Equal(t, DEFAULT_BATCH_SIZE, relay.batchSize)
+	require.Equal(t, DEFAULT_MAX_ATTEMPTS, relay.maxAttempts)
+	require.Equal(t, DEFAULT_POLL_INTERVAL, relay.pollInterval)
+}
+
+func TestRedisPublisherArgs(t *testing.T) {
+	ev := Event{ID: "1", Topic: "order.created", Key: "42", Payload: json.RawMessage(`{"total":10}`)}
+
+	args := NewRedisPublisher(nil).SetPrefix("events:").SetMaxLen(1000).args(ev)
+	require.Equal(t, []any{"events:order.created", "MAXLEN", "~", 1000, "*"}, args[:5])
+	require.Equal(t, []byte(`{"total":10}`), args[10])
+}
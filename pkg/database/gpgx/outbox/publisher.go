@@ -0,0 +1,128 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	rgo "github.com/gomodule/redigo/redis"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/database/redis"
+)
+
+// DEFAULT_STREAM_MAX_LEN is the approximate length the Redis streams are trimmed to.
+const DEFAULT_STREAM_MAX_LEN = 100000
+
+// Publisher delivers events to the consumers. An error schedules the event to be
+// published again.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, event Event) error
+
+func (pf PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return pf(ctx, event)
+}
+
+// MemoryPublisher delivers the events to handlers in the same process, for tests and
+// single instance deployments.
+type MemoryPublisher struct {
+	handlers map[string][]func(ctx context.Context, event Event) error
+	events   []Event
+	mtx      sync.RWMutex
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{handlers: make(map[string][]func(ctx context.Context, event Event) error)}
+}
+
+// Subscribe registers handler for the events of topic. A handler error fails the
+// publication, so the event is delivered again to every handler of the topic.
+func (mp *MemoryPublisher) Subscribe(topic string, handler func(ctx context.Context, event Event) error) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.handlers[topic] = append(mp.handlers[topic], handler)
+}
+
+func (mp *MemoryPublisher) Publish(ctx context.Context, event Event) error {
+	mp.mtx.RLock()
+	handlers := mp.handlers[event.Topic]
+	mp.mtx.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	mp.mtx.Lock()
+	mp.events = append(mp.events, event)
+	mp.mtx.Unlock()
+
+	return nil
+}
+
+// Events returns the events published so far.
+func (mp *MemoryPublisher) Events() []Event {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	return append([]Event(nil), mp.events...)
+}
+
+// RedisPublisher appends the events to Redis streams, one per topic, named the topic
+// with a prefix.
+type RedisPublisher struct {
+	rdb    *redis.Redigo
+	prefix string
+	maxLen int
+}
+
+func NewRedisPublisher(rdb *redis.Redigo) *RedisPublisher {
+	return &RedisPublisher{rdb: rdb, maxLen: DEFAULT_STREAM_MAX_LEN}
+}
+
+// SetPrefix sets the prefix of the stream names.
+func (rp *RedisPublisher) SetPrefix(prefix string) *RedisPublisher {
+	rp.prefix = prefix
+	return rp
+}
+
+// SetMaxLen sets the approximate length the streams are trimmed to, zero disables it.
+func (rp *RedisPublisher) SetMaxLen(maxLen int) *RedisPublisher {
+	rp.maxLen = maxLen
+	return rp
+}
+
+// Publish runs XADD with the fields id, key, payload and headers, as JSON, and
+// created_at.
+func (rp *RedisPublisher) Publish(ctx context.Context, event Event) error {
+	conn, err := rp.rdb.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = rgo.DoContext(conn, ctx, "XADD", rp.args(event)...)
+	return err
+}
+
+func (rp *RedisPublisher) args(event Event) []any {
+	headers, _ := json.Marshal(event.Headers)
+
+	args := []any{rp.prefix + event.Topic}
+	if rp.maxLen > 0 {
+		args = append(args, "MAXLEN", "~", rp.maxLen)
+	}
+
+	return append(args, "*",
+		"id", event.ID,
+		"key", event.Key,
+		"payload", []byte(event.Payload),
+		"headers", headers,
+		"created_at", event.CreatedAt.UTC().Format("2006-01-02T15:04:05.999999Z07:00"),
+	)
+}
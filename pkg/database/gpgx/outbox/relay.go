@@ -0,0 +1,305 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/database/gpgx"
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+const (
+	DEFAULT_BATCH_SIZE       = 100
+	DEFAULT_POLL_INTERVAL    = time.Second
+	DEFAULT_MAX_ATTEMPTS     = 10
+	DEFAULT_RETRY_BACKOFF    = time.Second
+	DEFAULT_MAX_BACKOFF      = 5 * time.Minute
+	DEFAULT_RETENTION        = 7 * 24 * time.Hour
+	DEFAULT_CLEANUP_INTERVAL = time.Hour
+
+	// maxErrorLength bounds the last_error stored for a failed event.
+	maxErrorLength = 1024
+)
+
+// Relay publishes the committed events of the outbox. Several relays may run together,
+// each batch being locked with FOR UPDATE SKIP LOCKED, in which case events of the same
+// key may be published out of order.
+type Relay struct {
+	db              gpgx.TxBeginner
+	publisher       Publisher
+	metrics         *Metrics
+	table           string
+	batchSize       int
+	maxAttempts     int
+	pollInterval    time.Duration
+	backoff         time.Duration
+	maxBackoff      time.Duration
+	retention       time.Duration
+	cleanupInterval time.Duration
+}
+
+func NewRelay(db gpgx.TxBeginner, publisher Publisher) *Relay {
+	return &Relay{
+		db:              db,
+		publisher:       publisher,
+		table:           DEFAULT_TABLE,
+		batchSize:       DEFAULT_BATCH_SIZE,
+		maxAttempts:     DEFAULT_MAX_ATTEMPTS,
+		pollInterval:    DEFAULT_POLL_INTERVAL,
+		backoff:         DEFAULT_RETRY_BACKOFF,
+		maxBackoff:      DEFAULT_MAX_BACKOFF,
+		retention:       DEFAULT_RETENTION,
+		cleanupInterval: DEFAULT_CLEANUP_INTERVAL,
+	}
+}
+
+func (r *Relay) SetTable(table string) *Relay {
+	r.table = table
+	return r
+}
+
+// SetBatchSize sets how many events a batch locks, DEFAULT_BATCH_SIZE when not positive.
+func (r *Relay) SetBatchSize(size int) *Relay {
+	if size <= 0 {
+		size = DEFAULT_BATCH_SIZE
+	}
+	r.batchSize = size
+	return r
+}
+
+// SetPollInterval sets the wait before looking for events again once the outbox is empty,
+// DEFAULT_POLL_INTERVAL when not positive.
+func (r *Relay) SetPollInterval(interval time.Duration) *Relay {
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+	r.pollInterval = interval
+	return r
+}
+
+// SetMaxAttempts sets how many times an event is published before it is dead lettered,
+// DEFAULT_MAX_ATTEMPTS when not positive.
+func (r *Relay) SetMaxAttempts(attempts int) *Relay {
+	if attempts <= 0 {
+		attempts = DEFAULT_MAX_ATTEMPTS
+	}
+	r.maxAttempts = attempts
+	return r
+}
+
+// SetRetryBackoff sets the initial and maximum wait before publishing a failed event
+// again. The wait doubles on every attempt and is jittered.
+func (r *Relay) SetRetryBackoff(initial, max time.Duration) *Relay {
+	r.backoff = initial
+	r.maxBackoff = max
+	return r
+}
+
+// SetRetention sets how long published events are kept before Cleanup deletes them and
+// how often Run cleans up. Dead letters are kept for inspection.
+func (r *Relay) SetRetention(retention, cleanupInterval time.Duration) *Relay {
+	r.retention = retention
+	r.cleanupInterval = cleanupInterval
+	return r
+}
+
+func (r *Relay) SetMetrics(metrics *Metrics) *Relay {
+	r.metrics = metrics
+	return r
+}
+
+// Run publishes events until ctx is done, reading the next batch at once while batches
+// come full and waiting the poll interval otherwise.
+func (r *Relay) Run(ctx context.Context) {
+	lastCleanup := time.Now()
+
+	for {
+		n, err := r.ProcessBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error(ctx, "outbox: relay failed - "+err.Error())
+		}
+
+		if r.cleanupInterval > 0 && time.Since(lastCleanup) >= r.cleanupInterval {
+			lastCleanup = time.Now()
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				logger.Error(ctx, "outbox: cleanup failed - "+err.Error())
+			}
+		}
+
+		wait := r.pollInterval
+		if err == nil && n == r.batchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ProcessBatch publishes the next batch of due events and returns how many were read.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	events, err := r.lockBatch(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ev := range events {
+		if err := r.publish(ctx, tx, ev); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(events), r.observeLag(ctx)
+}
+
+func (r *Relay) lockBatch(ctx context.Context, tx pgx.Tx) ([]Event, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT id, topic, key, payload, headers, attempts, created_at
+FROM %s
+WHERE published_at IS NULL AND dead_at IS NULL AND available_at <= now()
+ORDER BY created_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED`, quote(r.table)), r.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var ev Event
+		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Key, &ev.Payload, &ev.Headers, &ev.Attempts, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+
+	return events, rows.Err()
+}
+
+// publish hands ev to the publisher and records the outcome: published, scheduled again
+// after a backoff or, out of attempts, dead lettered.
+func (r *Relay) publish(ctx context.Context, tx pgx.Tx, ev Event) error {
+	ev.Attempts++
+	pubErr := r.publisher.Publish(ctx, ev)
+
+	if pubErr == nil {
+		r.metrics.incPublished(ev.Topic)
+		_, err := tx.Exec(ctx, fmt.Sprintf(
+			"UPDATE %s SET published_at = now(), attempts = $2, last_error = NULL WHERE id = $1",
+			quote(r.table)), ev.ID, ev.Attempts)
+		return err
+	}
+
+	lastError := pubErr.Error()
+	if len(lastError) > maxErrorLength {
+		// Cut on a rune boundary, postgres rejects an invalid UTF-8 parameter.
+		n := maxErrorLength
+		for n > 0 && !utf8.RuneStart(lastError[n]) {
+			n--
+		}
+		lastError = lastError[:n]
+	}
+
+	if ev.Attempts >= r.maxAttempts {
+		r.metrics.incDead(ev.Topic)
+		logger.Error(ctx, fmt.Sprintf("outbox: event %s of %s dead lettered after %d attempts - %s", ev.ID, ev.Topic, ev.Attempts, lastError))
+		_, err := tx.Exec(ctx, fmt.Sprintf(
+			"UPDATE %s SET dead_at = now(), attempts = $2, last_error = $3 WHERE id = $1",
+			quote(r.table)), ev.ID, ev.Attempts, lastError)
+		return err
+	}
+
+	r.metrics.incFailed(ev.Topic)
+	_, err := tx.Exec(ctx, fmt.Sprintf(
+		"UPDATE %s SET available_at = now() + $4 * interval '1 microsecond', attempts = $2, last_error = $3 WHERE id = $1",
+		quote(r.table)), ev.ID, ev.Attempts, lastError, r.retryAfter(ev.Attempts).Microseconds())
+	return err
+}
+
+func (r *Relay) retryAfter(attempts int) time.Duration {
+	d := r.backoff << (attempts - 1)
+	if d <= 0 || d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	// Half fixed, half jittered, so a failing publisher is not retried in bursts nor
+	// too early.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Cleanup deletes the events published longer than the retention ago.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	if r.retention <= 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE published_at < now() - $1 * interval '1 microsecond'",
+		quote(r.table)), r.retention.Microseconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+// Lag returns the age of the oldest event waiting to be published, zero when none is.
+func (r *Relay) Lag(ctx context.Context) (time.Duration, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	var seconds float64
+	err = tx.QueryRow(ctx, fmt.Sprintf(
+		"SELECT COALESCE(EXTRACT(EPOCH FROM now() - min(created_at)), 0)::float8 FROM %s WHERE published_at IS NULL AND dead_at IS NULL",
+		quote(r.table))).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (r *Relay) observeLag(ctx context.Context) error {
+	if r.metrics == nil {
+		return nil
+	}
+
+	lag, err := r.Lag(ctx)
+	if err != nil {
+		return errors.Join(errors.New("outbox: measure lag"), err)
+	}
+
+	r.metrics.lag.Set(lag.Seconds())
+	return nil
+}
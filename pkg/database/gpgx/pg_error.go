@@ -3,23 +3,89 @@ package gpgx
 import (
 	"errors"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var ErrNoRows = errors.New("no rows in result set")
 
+const (
+	SQLSTATE_NOT_NULL_VIOLATION    = "23502"
+	SQLSTATE_FOREIGN_KEY_VIOLATION = "23503"
+	SQLSTATE_UNIQUE_VIOLATION      = "23505"
+	SQLSTATE_CHECK_VIOLATION       = "23514"
+	SQLSTATE_QUERY_CANCELED        = "57014"
+)
+
+// PgError is an error returned by a query. When the server reported it, Code and the
+// other fields come from the underlying *pgconn.PgError, still reachable with errors.As.
 type PgError struct {
-	Message string
+	Err            error
+	Message        string
+	Code           string
+	SchemaName     string
+	TableName      string
+	ColumnName     string
+	ConstraintName string
+	Detail         string
+	Hint           string
 }
 
 func NewPgError(message string) *PgError {
 	return &PgError{Message: message}
 }
 
+// WrapPgError wraps err keeping the details of the *pgconn.PgError in its chain.
+func WrapPgError(err error) *PgError {
+	pe := &PgError{Err: err, Message: err.Error()}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		pe.Code = pgErr.Code
+		pe.SchemaName = pgErr.SchemaName
+		pe.TableName = pgErr.TableName
+		pe.ColumnName = pgErr.ColumnName
+		pe.ConstraintName = pgErr.ConstraintName
+		pe.Detail = pgErr.Detail
+		pe.Hint = pgErr.Hint
+	}
+
+	return pe
+}
+
+// AsPgError finds the first PgError or *pgconn.PgError in the chain of err.
+func AsPgError(err error) (*PgError, bool) {
+	var pe *PgError
+	if errors.As(err, &pe) {
+		return pe, true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return WrapPgError(err), true
+	}
+
+	return nil, false
+}
+
 func (pe PgError) Error() string {
 	return pe.Message
 }
 
+func (pe PgError) Unwrap() error {
+	return pe.Err
+}
+
+// SQLState returns the SQLSTATE code reported by the server, empty for client errors.
+func (pe PgError) SQLState() string {
+	return pe.Code
+}
+
 func (pe PgError) IsEmptyResult() bool {
+	if pe.Err != nil {
+		return errors.Is(pe.Err, pgx.ErrNoRows)
+	}
 	return strings.Contains(pe.Message, "no row was found") ||
 		strings.Contains(pe.Message, ErrNoRows.Error())
 }
@@ -28,7 +94,37 @@ func (pe PgError) IsFinal() bool {
 	return strings.Contains(pe.Message, "rows final error")
 }
 
+// ReturnedMultipleRows reports whether a single row scan got more rows. scany has no
+// sentinel error for it, so the message is checked.
 func (pe PgError) ReturnedMultipleRows() bool {
 	return strings.Contains(pe.Message, "expected 1 row, got:") ||
 		strings.Contains(pe.Message, "query multiple result rows")
 }
+
+func (pe PgError) IsNotNullViolation() bool {
+	return pe.Code == SQLSTATE_NOT_NULL_VIOLATION
+}
+
+func (pe PgError) IsForeignKeyViolation() bool {
+	return pe.Code == SQLSTATE_FOREIGN_KEY_VIOLATION
+}
+
+func (pe PgError) IsUniqueViolation() bool {
+	return pe.Code == SQLSTATE_UNIQUE_VIOLATION
+}
+
+func (pe PgError) IsCheckViolation() bool {
+	return pe.Code == SQLSTATE_CHECK_VIOLATION
+}
+
+func (pe PgError) IsSerializationFailure() bool {
+	return pe.Code == SQLSTATE_SERIALIZATION_FAILURE
+}
+
+func (pe PgError) IsDeadlock() bool {
+	return pe.Code == SQLSTATE_DEADLOCK_DETECTED
+}
+
+func (pe PgError) IsQueryCanceled() bool {
+	return pe.Code == SQLSTATE_QUERY_CANCELED
+}
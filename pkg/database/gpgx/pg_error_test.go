@@ -0,0 +1,63 @@
+package gpgx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapPgErrorKeepsServerDetails(t *testing.T) {
+	pgErr := &pgconn.PgError{
+		Code:           SQLSTATE_UNIQUE_VIOLATION,
+		Message:        "duplicate key value violates unique constraint \"accounts_email_key\"",
+		TableName:      "accounts",
+		ColumnName:     "email",
+		ConstraintName: "accounts_email_key",
+		Detail:         "Key (email)=(a@b.c) already exists.",
+		Hint:           "use another email",
+	}
+
+	pe := WrapPgError(fmt.Errorf("insert account: %w", pgErr))
+	require.Equal(t, SQLSTATE_UNIQUE_VIOLATION, pe.Code)
+	require.Equal(t, SQLSTATE_UNIQUE_VIOLATION, pe.SQLState())
+	require.Equal(t, "accounts", pe.TableName)
+	require.Equal(t, "email", pe.ColumnName)
+	require.Equal(t, "accounts_email_key", pe.ConstraintName)
+	require.Equal(t, "Key (email)=(a@b.c) already exists.", pe.Detail)
+	require.Equal(t, "use another email", pe.Hint)
+	require.True(t, pe.IsUniqueViolation())
+	require.False(t, pe.IsForeignKeyViolation())
+
+	var target *pgconn.PgError
+	require.ErrorAs(t, pe, &target)
+	require.Same(t, pgErr, target)
+}
+
+func TestPgErrorPredicates(t *testing.T) {
+	for code, is := range map[string]func(PgError) bool{
+		SQLSTATE_FOREIGN_KEY_VIOLATION: PgError.IsForeignKeyViolation,
+		SQLSTATE_SERIALIZATION_FAILURE: PgError.IsSerializationFailure,
+		SQLSTATE_DEADLOCK_DETECTED:     PgError.IsDeadlock,
+		SQLSTATE_NOT_NULL_VIOLATION:    PgError.IsNotNullViolation,
+		SQLSTATE_CHECK_VIOLATION:       PgError.IsCheckViolation,
+		SQLSTATE_QUERY_CANCELED:        PgError.IsQueryCanceled,
+	} {
+		pe, ok := AsPgError(&pgconn.PgError{Code: code})
+		require.True(t, ok, code)
+		require.True(t, is(*pe), code)
+		require.False(t, pe.IsUniqueViolation(), code)
+	}
+
+	_, ok := AsPgError(errors.New("plain"))
+	require.False(t, ok)
+}
+
+func TestPgErrorEmptyResult(t *testing.T) {
+	require.True(t, WrapPgError(fmt.Errorf("scany: %w", pgx.ErrNoRows)).IsEmptyResult())
+	require.False(t, WrapPgError(errors.New("connection reset")).IsEmptyResult())
+	require.True(t, NewPgError("no rows in result set").IsEmptyResult())
+}
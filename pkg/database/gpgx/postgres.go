@@ -3,13 +3,20 @@ package gpgx
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
 )
 
 var pgInstances map[string]*PgConnection
@@ -23,9 +30,24 @@ type PgxConenector interface {
 }
 
 type PgConnection struct {
-	conn                  *pgxpool.Pool
+	lastReconnect         time.Time
+	pools                 atomic.Pointer[pools]
+	tracer                atomic.Pointer[TracerConfig]
+	retry                 *RetryPolicy
+	queryMetrics          *QueryMetrics
 	QueryExecutor         *SimpleQueryExecutor
 	connString            string
+	replicaStrategy       string
+	replicaConnStrings    []string
+	nextReplica           atomic.Uint64
+	replicaMaxLag         time.Duration
+	slowQueryThreshold    time.Duration
+	tenancy               string
+	schemaResolver        SchemaResolver
+	tenantRegistry        TenantRegistry
+	tenantPools           *tenantPools
+	tenantPoolLimit       int
+	reconnectMtx          sync.Mutex
 	maxConns              int32
 	minConns              int32
 	maxConnLifetime       time.Duration
@@ -34,6 +56,7 @@ type PgConnection struct {
 	multiTenantEnabled    bool
 	multiTenantRepEnabled bool
 	queryTracerEnabled    bool
+	explainSlowQueries    bool
 }
 
 func NewPgConnection() *PgConnection {
@@ -42,13 +65,51 @@ func NewPgConnection() *PgConnection {
 		minConns:        20,
 		maxConnLifetime: time.Second * 9,
 		maxConnIdletime: time.Second * 3,
+		replicaStrategy: REPLICA_ROUND_ROBIN,
+		replicaMaxLag:   DEFAULT_REPLICA_MAX_LAG,
+		tenancy:         TENANCY_RLS,
+		tenantPoolLimit: DEFAULT_TENANT_POOL_LIMIT,
+		retry:           NewRetryPolicy(),
 	}
 	pgInstances["main"] = pg
 	return pg
 }
 
+// pools is the set of pools in use, replaced as a whole by Reconnect.
+type pools struct {
+	conn     *pgxpool.Pool
+	primary  Pooler
+	replicas []*replica
+}
+
+func (p *pools) close() {
+	if p.primary != nil {
+		p.primary.Close()
+	}
+	for _, r := range p.replicas {
+		r.pool.Close()
+	}
+}
+
+// current returns the pools in use, empty before NewPool.
+func (pgc *PgConnection) current() *pools {
+	if p := pgc.pools.Load(); p != nil {
+		return p
+	}
+	return &pools{}
+}
+
+// Pool returns the primary pool. It is closed by Reconnect, so keep the PgConnection
+// instead of the returned pool.
 func (pgc *PgConnection) Pool() *pgxpool.Pool {
-	return pgc.conn
+	return pgc.current().conn
+}
+
+// SetRetryPolicy sets how statements failing with transient errors are retried, nil
+// disables the retries.
+func (pgc *PgConnection) SetRetryPolicy(policy *RetryPolicy) *PgConnection {
+	pgc.retry = policy
+	return pgc
 }
 
 func (pgc *PgConnection) SetDatadogEnable(enabled bool) *PgConnection {
@@ -56,6 +117,9 @@ func (pgc *PgConnection) SetDatadogEnable(enabled bool) *PgConnection {
 	return pgc
 }
 
+// SetMultiTenantEnabled scopes every statement to the tenant of its context, see
+// MultiTenantConfig. Statements whose context carries neither a tenant nor the
+// tenant.System mark fail with tenant.ErrRequired.
 func (pgc *PgConnection) SetMultiTenantEnabled(enabled bool) *PgConnection {
 	pgc.multiTenantEnabled = enabled
 	return pgc
@@ -66,8 +130,37 @@ func (pgc *PgConnection) SetMultiTenantRepEnabled(enabled bool) *PgConnection {
 	return pgc
 }
 
+// SetQueryTracerEnabled may be called after NewPool to toggle the query output at runtime.
 func (pgc *PgConnection) SetQueryTracerEnabled(enabled bool) *PgConnection {
+	// Serialized with newPools, so a concurrent Reconnect keeps the last value.
+	pgc.reconnectMtx.Lock()
+	defer pgc.reconnectMtx.Unlock()
+
 	pgc.queryTracerEnabled = enabled
+	if tracer := pgc.tracer.Load(); tracer != nil {
+		tracer.SetQueryTracerEnabled(enabled)
+	}
+	return pgc
+}
+
+// SetQueryMetrics sets the metrics observing the duration and the errors of the
+// statements, see NewQueryMetrics. It applies to the pools created by the next NewPool.
+func (pgc *PgConnection) SetQueryMetrics(metrics *QueryMetrics) *PgConnection {
+	pgc.queryMetrics = metrics
+	return pgc
+}
+
+// SetSlowQueryThreshold logs the statements lasting threshold or more as warnings, with
+// their arguments redacted. Zero disables it.
+func (pgc *PgConnection) SetSlowQueryThreshold(threshold time.Duration) *PgConnection {
+	pgc.slowQueryThreshold = threshold
+	return pgc
+}
+
+// SetExplainSlowQueries adds the plan of the slow queries to their log. Meant for
+// development, it costs the slow queries a round trip more.
+func (pgc *PgConnection) SetExplainSlowQueries(enabled bool) *PgConnection {
+	pgc.explainSlowQueries = enabled
 	return pgc
 }
 
@@ -91,16 +184,74 @@ func (pgc *PgConnection) SetMaxConnIdleTime(vtime time.Duration) *PgConnection {
 	return pgc
 }
 
-// NewPool creates a new Pool and immediately establishes one connection.
+// NewPool creates a new Pool and immediately establishes one connection, plus one pool
+// per replica set by SetReplicas. Pools created by a previous call are closed once their
+// connections in use are released.
 // maxConns is the maximum size of the pool. The default is the max(4, runtime.NumCPU()).
 func (pgc *PgConnection) NewPool(ctx context.Context, connString string) error {
+	pgc.reconnectMtx.Lock()
+	defer pgc.reconnectMtx.Unlock()
+
+	return pgc.newPools(ctx, connString)
+}
+
+func (pgc *PgConnection) newPools(ctx context.Context, connString string) error {
+	if err := pgc.checkTenancy(); err != nil {
+		return err
+	}
 	pgc.connString = connString
 
-	config, err := pgxpool.ParseConfig(connString)
+	pgc.tracer.Store(&TracerConfig{
+		QueryTracerEnabled: pgc.isQueryTracerEnabled(),
+		DatadogEnabled:     pgc.isDatadogEnabled(),
+		Metrics:            pgc.queryMetrics,
+		SlowQueryThreshold: pgc.slowQueryThreshold,
+		ExplainSlowQueries: pgc.explainSlowQueries,
+	})
+
+	pool, err := pgc.newPool(ctx, connString)
 	if err != nil {
 		return err
 	}
 
+	replicas := make([]*replica, 0, len(pgc.replicaConnStrings))
+	for _, rcs := range pgc.replicaConnStrings {
+		rp, err := pgc.newPool(ctx, rcs)
+		if err != nil {
+			pool.Close()
+			for _, r := range replicas {
+				r.pool.Close()
+			}
+			return fmt.Errorf("replica %s: %w", replicaHost(rcs), err)
+		}
+		replicas = append(replicas, newReplica(rp, replicaHost(rcs)))
+	}
+
+	if pgc.isMultiTenant() && pgc.tenancy == TENANCY_POOL && pgc.tenantPools == nil {
+		pgc.tenantPools = newTenantPools(pgc.tenantRegistry, pgc.tenantPoolLimit, func(ctx context.Context, dsn string) (*pools, error) {
+			pool, err := pgc.newPool(ctx, dsn)
+			if err != nil {
+				return nil, err
+			}
+			return &pools{conn: pool, primary: pool}, nil
+		})
+	}
+
+	if stale := pgc.pools.Swap(&pools{conn: pool, primary: pool, replicas: replicas}); stale != nil {
+		// Close waits for the connections in use, let the statements running finish.
+		go stale.close()
+	}
+	pgc.lastReconnect = time.Now()
+
+	return nil
+}
+
+func (pgc *PgConnection) newPool(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: true,
 	}
@@ -120,13 +271,10 @@ func (pgc *PgConnection) NewPool(ctx context.Context, connString string) error {
 	config.MaxConnLifetime = pgc.maxConnLifetime
 	config.MaxConnIdleTime = pgc.maxConnIdletime
 
-	config.ConnConfig.Tracer = &TracerConfig{
-		QueryTracerEnabled: pgc.isQueryTracerEnabled(),
-		DatadogEnabled:     pgc.isDatadogEnabled(),
-	}
+	config.ConnConfig.Tracer = pgc.tracer.Load()
 
-	if pgc.multiTenantEnabled && !pgc.multiTenantRepEnabled {
-		mtc := &MultiTenantConfig{}
+	if pgc.isMultiTenant() && pgc.tenancy != TENANCY_POOL {
+		mtc := pgc.multiTenantConfig()
 		// BeforeAcquire is called before a connection is acquired from the pool.
 		// It must return true to allow the acquisition or false to indicate that the connection should be destroyed and
 		// a different connection should be acquired.
@@ -137,33 +285,62 @@ func (pgc *PgConnection) NewPool(ctx context.Context, connString string) error {
 		config.AfterRelease = mtc.afterReleaseHook
 	}
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
-	if err != nil {
-		return err
-	}
-	pgc.conn = pool
-
-	return nil
+	return pgxpool.NewWithConfig(ctx, config)
 }
 
 func (pgc *PgConnection) isDatadogEnabled() bool {
 	return pgc.datadogEnabled && os.Getenv("DD_AGENT_HOST") != ""
 }
 
+func (pgc *PgConnection) isMultiTenant() bool {
+	return pgc.multiTenantEnabled && !pgc.multiTenantRepEnabled
+}
+
 func (pgc *PgConnection) isQueryTracerEnabled() bool {
 	return pgc.queryTracerEnabled
 }
 
+// Reconnect replaces the pools with new ones, closing the stale pools. It is safe to
+// call concurrently.
 func (pgc *PgConnection) Reconnect(ctx context.Context) error {
 	return pgc.NewPool(ctx, pgc.connString)
 }
 
+// reconnect replaces stale, unless another caller already replaced it or the pools were
+// rebuilt less than DEFAULT_RECONNECT_INTERVAL ago.
+func (pgc *PgConnection) reconnect(ctx context.Context, stale *pools) error {
+	pgc.reconnectMtx.Lock()
+	defer pgc.reconnectMtx.Unlock()
+
+	if pgc.pools.Load() != stale || time.Since(pgc.lastReconnect) < DEFAULT_RECONNECT_INTERVAL {
+		return nil
+	}
+
+	logger.Warn(ctx, "gpgx: database connection lost, reconnecting")
+	if err := pgc.newPools(ctx, pgc.connString); err != nil {
+		logger.Error(ctx, "gpgx: unable to reconnect - "+err.Error())
+		return err
+	}
+
+	return nil
+}
+
 func (pgc *PgConnection) Close() {
-	if pgc.Pool() != nil {
-		pgc.Pool().Close()
+	pgc.current().close()
+	if pgc.tenantPools != nil {
+		pgc.tenantPools.close()
 	}
 }
 
+// Ping checks the primary is reachable.
+func (pgc *PgConnection) Ping(ctx context.Context) error {
+	p := pgc.current()
+	if p.primary == nil {
+		return new(NotConnectedError)
+	}
+	return p.primary.Ping(ctx)
+}
+
 func (pgc *PgConnection) Stat() *pgxpool.Stat {
 	if pgc.Pool() != nil {
 		return pgc.Pool().Stat()
@@ -177,7 +354,7 @@ func (pgc *PgConnection) queryFor(ctx context.Context, tx *pgx.Tx, dst any, many
 		if _, ok := err.(*NotConnectedError); ok {
 			return err
 		}
-		return NewPgError(err.Error())
+		return WrapPgError(err)
 	}
 
 	defer qr.Close()
@@ -191,25 +368,22 @@ func (pgc *PgConnection) queryFor(ctx context.Context, tx *pgx.Tx, dst any, many
 	}
 
 	if err != nil {
-		return NewPgError(err.Error())
+		return WrapPgError(err)
 	}
 
 	return nil
 }
 
 func (pgc *PgConnection) query(ctx context.Context, tx *pgx.Tx, sql string, arguments ...any) (pgx.Rows, error) {
-	if pgc.conn == nil {
-		return nil, new(NotConnectedError)
+	if ctx == nil {
+		ctx = context.TODO()
 	}
-	f := pgc.conn.Query
 
+	f := pgc.Query
 	if tx != nil {
 		f = (*tx).Query
 	}
 
-	if ctx == nil {
-		ctx = context.TODO()
-	}
 	r, err := f(ctx, sql, arguments...)
 	if err != nil {
 		if strings.HasPrefix(err.Error(), "failed to connect") {
@@ -226,6 +400,242 @@ func (pgc *PgConnection) query(ctx context.Context, tx *pgx.Tx, sql string, argu
 	return r, nil
 }
 
+// BeginTx starts a transaction, making PgConnection a TxBeginner that survives
+// Reconnect. Read only transactions are started in a replica when one is healthy.
+func (pgc *PgConnection) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (tx pgx.Tx, err error) {
+	err = pgc.retry.do(ctx, "begin", false, func(ctx context.Context) error {
+		return pgc.attempt(ctx, func(p *pools) error {
+			if txOptions.AccessMode == pgx.ReadOnly {
+				if r := pgc.replica(p); r != nil {
+					tx, err = r.pool.BeginTx(ctx, txOptions)
+					if !pgc.fallback(r, err) {
+						return err
+					}
+				}
+			}
+			tx, err = p.primary.BeginTx(ctx, txOptions)
+			return err
+		})
+	})
+	if err != nil || !pgc.isMultiTenant() {
+		return tx, err
+	}
+
+	if err = pgc.multiTenantConfig().scope(ctx, tx, true); err != nil {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Exec runs sql in the transaction carried by ctx or, without one, in the primary. Out
+// of a transaction, it is retried only when the statement surely did not run.
+func (pgc *PgConnection) Exec(ctx context.Context, sql string, arguments ...any) (tag pgconn.CommandTag, err error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Exec(ctx, sql, arguments...)
+	}
+
+	err = pgc.retry.do(ctx, "exec", true, func(ctx context.Context) error {
+		return pgc.attempt(ctx, func(p *pools) error {
+			tag, err = p.primary.Exec(ctx, sql, arguments...)
+			return err
+		})
+	})
+	return tag, err
+}
+
+// Query runs sql in the transaction carried by ctx or, without one, in a replica when
+// ctx is marked by ReadOnlyContext and in the primary otherwise. Out of a transaction,
+// it is retried after any transient error when ctx is marked by ReadOnlyContext, and
+// otherwise only when the statement surely did not run, as it may be a write with
+// RETURNING.
+func (pgc *PgConnection) Query(ctx context.Context, sql string, args ...any) (rows pgx.Rows, err error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Query(ctx, sql, args...)
+	}
+
+	err = pgc.retry.do(ctx, "query", !IsReadOnly(ctx), func(ctx context.Context) error {
+		return pgc.attempt(ctx, func(p *pools) error {
+			db, r := pgc.reader(ctx, p)
+			rows, err = db.Query(ctx, sql, args...)
+			if pgc.fallback(r, err) {
+				rows, err = p.primary.Query(ctx, sql, args...)
+			}
+			return err
+		})
+	})
+	return rows, err
+}
+
+// QueryRow runs sql like Query. Its errors surface on Scan, which runs the query again
+// when it fails with a transient error, under the same conditions as Query.
+func (pgc *PgConnection) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.QueryRow(ctx, sql, args...)
+	}
+
+	return &retryRow{pgc: pgc, ctx: ctx, sql: sql, args: args}
+}
+
+// SendBatch sends b in the transaction carried by ctx or, without one, in the primary.
+// Out of a transaction, the batch is sent again when reading its first result fails with
+// an error proving it did not run.
+func (pgc *PgConnection) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.SendBatch(ctx, b)
+	}
+
+	br := &retryBatchResults{pgc: pgc, ctx: ctx, batch: b}
+	br.send()
+	return br
+}
+
+// attempt runs fn with the pools in use, rebuilding them when fn fails because they are
+// unusable.
+func (pgc *PgConnection) attempt(ctx context.Context, fn func(p *pools) error) error {
+	p := pgc.current()
+	if p.primary == nil {
+		return new(NotConnectedError)
+	}
+	if pgc.isMultiTenant() {
+		if err := requireTenant(ctx); err != nil {
+			return err
+		}
+		if tenantID, ok := tenant.FromContext(ctx); ok && pgc.tenantPools != nil {
+			return pgc.attemptTenant(ctx, tenantID, fn)
+		}
+	}
+
+	err := fn(p)
+	if err != nil && needsReconnect(err) {
+		_ = pgc.reconnect(ctx, p)
+	}
+	return err
+}
+
+// attemptTenant runs fn with the pools of the TENANCY_POOL tenant, opening them on
+// first use and closing them when fn fails because they are unusable.
+func (pgc *PgConnection) attemptTenant(ctx context.Context, tenantID string, fn func(p *pools) error) error {
+	p, err := pgc.tenantPools.get(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	err = fn(p)
+	if err != nil && needsReconnect(err) {
+		pgc.tenantPools.evict(tenantID, p)
+	}
+	return err
+}
+
+type retryRow struct {
+	pgc  *PgConnection
+	ctx  context.Context
+	sql  string
+	args []any
+}
+
+func (rr *retryRow) Scan(dest ...any) error {
+	return rr.pgc.retry.do(rr.ctx, "query_row", !IsReadOnly(rr.ctx), func(ctx context.Context) error {
+		return rr.pgc.attempt(ctx, func(p *pools) error {
+			db, _ := rr.pgc.reader(ctx, p)
+			return db.QueryRow(ctx, rr.sql, rr.args...).Scan(dest...)
+		})
+	})
+}
+
+// retryBatchResults sends the batch again while reading its first result fails with an
+// error proving the batch did not run.
+type retryBatchResults struct {
+	pgx.BatchResults
+	err     error
+	pgc     *PgConnection
+	ctx     context.Context
+	batch   *pgx.Batch
+	started bool
+}
+
+func (rbr *retryBatchResults) send() {
+	p := rbr.pgc.current()
+	if p.primary == nil {
+		rbr.BatchResults, rbr.err = nil, new(NotConnectedError)
+		return
+	}
+	rbr.BatchResults, rbr.err = p.primary.SendBatch(rbr.ctx, rbr.batch), nil
+}
+
+// first runs read, the read of a result, retrying it when it is the first one.
+func (rbr *retryBatchResults) first(read func() error) error {
+	if rbr.started {
+		if rbr.err != nil {
+			return rbr.err
+		}
+		return read()
+	}
+	rbr.started = true
+
+	resend := false
+	return rbr.pgc.retry.do(rbr.ctx, "batch", true, func(ctx context.Context) error {
+		return rbr.pgc.attempt(ctx, func(p *pools) error {
+			if resend || rbr.err != nil {
+				rbr.send()
+			}
+			resend = true
+			if rbr.err != nil {
+				return rbr.err
+			}
+
+			err := read()
+			if err != nil && rbr.pgc.retry.retryable(err, true) {
+				_ = rbr.BatchResults.Close()
+			}
+			return err
+		})
+	})
+}
+
+func (rbr *retryBatchResults) Exec() (tag pgconn.CommandTag, err error) {
+	err = rbr.first(func() error {
+		tag, err = rbr.BatchResults.Exec()
+		return err
+	})
+	return tag, err
+}
+
+func (rbr *retryBatchResults) Query() (rows pgx.Rows, err error) {
+	err = rbr.first(func() error {
+		rows, err = rbr.BatchResults.Query()
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow reads the next result. When it is the first one, it is read on Scan, so Scan
+// it before reading the next result.
+func (rbr *retryBatchResults) QueryRow() pgx.Row {
+	if rbr.started && rbr.err == nil {
+		return rbr.BatchResults.QueryRow()
+	}
+	return batchRow{rbr}
+}
+
+func (rbr *retryBatchResults) Close() error {
+	if rbr.BatchResults == nil {
+		return nil
+	}
+	return rbr.BatchResults.Close()
+}
+
+type batchRow struct {
+	rbr *retryBatchResults
+}
+
+func (br batchRow) Scan(dest ...any) error {
+	return br.rbr.first(func() error {
+		return br.rbr.BatchResults.QueryRow().Scan(dest...)
+	})
+}
+
 func Pg(name ...string) *PgConnection {
 	if len(name) == 0 {
 		name = append(name, "main")
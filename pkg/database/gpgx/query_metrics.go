@@ -0,0 +1,176 @@
+package gpgx
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MAX_FINGERPRINT_LENGTH bounds the fingerprint label, statements sharing their
+// beginning being counted together beyond it.
+const MAX_FINGERPRINT_LENGTH = 200
+
+var (
+	placeholderPattern = regexp.MustCompile(`\$\d+`)
+	listPattern        = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+	rowsPattern        = regexp.MustCompile(`\(\?\)(\s*,\s*\(\?\))+`)
+)
+
+// Fingerprint normalizes sql so the statements differing only by their values, their
+// placeholders, the length of their lists, their comments or their spacing share it.
+func Fingerprint(sql string) string {
+	lines := strings.Split(ObfuscateSQL(sql), "\n")
+	for i, line := range lines {
+		if comment := strings.Index(line, "--"); comment >= 0 && strings.Count(line[:comment], `"`)%2 == 0 {
+			lines[i] = line[:comment]
+		}
+	}
+
+	fp := strings.Join(strings.Fields(strings.Join(lines, " ")), " ")
+	fp = placeholderPattern.ReplaceAllString(fp, "?")
+	fp = listPattern.ReplaceAllString(fp, "?")
+	fp = rowsPattern.ReplaceAllString(fp, "(?)")
+
+	if len(fp) > MAX_FINGERPRINT_LENGTH {
+		// Cut on a rune boundary, an invalid UTF-8 label is rejected by prometheus.
+		n := MAX_FINGERPRINT_LENGTH
+		for n > 0 && !utf8.RuneStart(fp[n]) {
+			n--
+		}
+		fp = fp[:n]
+	}
+	return fp
+}
+
+// statementOperation returns the first keyword of sql, SELECT, INSERT, WITH and so on.
+func statementOperation(sql string) string {
+	sql = strings.TrimLeft(sql, " \t\r\n(")
+	end := strings.IndexFunc(sql, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if end < 0 {
+		end = len(sql)
+	}
+	if end == 0 {
+		return "UNKNOWN"
+	}
+	return strings.ToUpper(sql[:end])
+}
+
+// QueryMetrics exports the duration and the errors of the statements to Prometheus.
+type QueryMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewQueryMetrics registers the gpgx_query_duration_seconds histogram and the
+// gpgx_query_errors_total counter with registry, usually prometheus.DefaultRegisterer.
+func NewQueryMetrics(registry prometheus.Registerer) *QueryMetrics {
+	return &QueryMetrics{
+		duration: promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gpgx_query_duration_seconds",
+			Help:    "Duration of the statements, by fingerprint and operation.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"fingerprint", "operation"}),
+		errors: promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+			Name: "gpgx_query_errors_total",
+			Help: "Statements failed, by operation and SQLSTATE or connection.",
+		}, []string{"operation", "sqlstate"}),
+	}
+}
+
+func (m *QueryMetrics) observe(fingerprint, operation string, seconds float64) {
+	if m != nil {
+		m.duration.WithLabelValues(fingerprint, operation).Observe(seconds)
+	}
+}
+
+func (m *QueryMetrics) incErrors(operation string, err error) {
+	if m != nil {
+		m.errors.WithLabelValues(operation, retryReason(err)).Inc()
+	}
+}
+
+// poolCollector reads the statistics of the pools of a PgConnection when scraped.
+type poolCollector struct {
+	pgc *PgConnection
+
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireTotal         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	canceledAcquireTotal *prometheus.Desc
+	emptyAcquireTotal    *prometheus.Desc
+	newConnsTotal        *prometheus.Desc
+}
+
+// RegisterPoolMetrics registers with registry the gauges and counters of the pools of
+// pgc, the primary and every replica, labeled by pool, read from their Stat when
+// scraped.
+func RegisterPoolMetrics(registry prometheus.Registerer, pgc *PgConnection) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("gpgx_pool_"+name, help, []string{"pool"}, nil)
+	}
+
+	registry.MustRegister(&poolCollector{
+		pgc:                  pgc,
+		acquiredConns:        desc("acquired_conns", "Connections in use."),
+		idleConns:            desc("idle_conns", "Connections idle in the pool."),
+		constructingConns:    desc("constructing_conns", "Connections being opened."),
+		totalConns:           desc("total_conns", "Connections open or being opened."),
+		maxConns:             desc("max_conns", "Maximum size of the pool."),
+		acquireTotal:         desc("acquire_total", "Connections acquired."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		canceledAcquireTotal: desc("canceled_acquire_total", "Acquisitions canceled by their context."),
+		emptyAcquireTotal:    desc("empty_acquire_total", "Acquisitions that waited for a connection."),
+		newConnsTotal:        desc("new_conns_total", "Connections opened."),
+	})
+}
+
+func (pc *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		pc.acquiredConns, pc.idleConns, pc.constructingConns, pc.totalConns, pc.maxConns,
+		pc.acquireTotal, pc.acquireDuration, pc.canceledAcquireTotal, pc.emptyAcquireTotal, pc.newConnsTotal,
+	} {
+		ch <- d
+	}
+}
+
+func (pc *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	p := pc.pgc.current()
+	if p.conn != nil {
+		pc.collect(ch, "primary", p.conn.Stat())
+	}
+	for _, r := range p.replicas {
+		if pool, ok := r.pool.(*pgxpool.Pool); ok {
+			pc.collect(ch, r.host, pool.Stat())
+		}
+	}
+}
+
+func (pc *poolCollector) collect(ch chan<- prometheus.Metric, pool string, stat *pgxpool.Stat) {
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, pool)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, pool)
+	}
+
+	gauge(pc.acquiredConns, float64(stat.AcquiredConns()))
+	gauge(pc.idleConns, float64(stat.IdleConns()))
+	gauge(pc.constructingConns, float64(stat.ConstructingConns()))
+	gauge(pc.totalConns, float64(stat.TotalConns()))
+	gauge(pc.maxConns, float64(stat.MaxConns()))
+	counter(pc.acquireTotal, float64(stat.AcquireCount()))
+	counter(pc.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(pc.canceledAcquireTotal, float64(stat.CanceledAcquireCount()))
+	counter(pc.emptyAcquireTotal, float64(stat.EmptyAcquireCount()))
+	counter(pc.newConnsTotal, float64(stat.NewConnsCount()))
+}
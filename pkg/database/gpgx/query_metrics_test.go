@@ -0,0 +1,102 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE id = $1":                                "SELECT * FROM users WHERE id = ?",
+		"SELECT *\n  FROM users -- by name\n WHERE name = 'bob'":           "SELECT * FROM users WHERE name = ?",
+		"SELECT * FROM users WHERE id IN ($1, $2, $3)":                     "SELECT * FROM users WHERE id IN (?)",
+		"SELECT * FROM users WHERE id IN (1,2)":                            "SELECT * FROM users WHERE id IN (?)",
+		"INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4), ($5, $6)": "INSERT INTO users (id, name) VALUES (?)",
+		"SELECT /* don't */ 'secret'":                                      "SELECT /* don't */ ?",
+	}
+
+	for sql, want := range tests {
+		require.Equal(t, want, Fingerprint(sql), sql)
+	}
+
+	require.Len(t, Fingerprint("SELECT "+strings.Repeat("a, ", 200)+"b FROM t"), MAX_FINGERPRINT_LENGTH)
+
+	fp := Fingerprint("SELECT " + strings.Repeat("é", 200) + " FROM t")
+	require.True(t, utf8.ValidString(fp))
+	require.Len(t, fp, MAX_FINGERPRINT_LENGTH-1)
+}
+
+func TestStatementOperation(t *testing.T) {
+	require.Equal(t, "SELECT", statementOperation("  select 1"))
+	require.Equal(t, "WITH", statementOperation("WITH x AS (SELECT 1) SELECT * FROM x"))
+	require.Equal(t, "SELECT", statementOperation("(SELECT 1) UNION (SELECT 2)"))
+	require.Equal(t, "UNKNOWN", statementOperation(""))
+}
+
+func TestTracerMetrics(t *testing.T) {
+	metrics := NewQueryMetrics(prometheus.NewRegistry())
+	cfg := &TracerConfig{Metrics: metrics, SlowQueryThreshold: time.Nanosecond}
+
+	ctx := cfg.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT * FROM users WHERE id = $1", Args: []any{1}})
+	cfg.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	ctx = cfg.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "UPDATE users SET name = $1"})
+	cfg.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: SQLSTATE_SERIALIZATION_FAILURE}})
+
+	ctx = cfg.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: &pgx.Batch{}})
+	cfg.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "DELETE FROM users", Err: errors.New("connection reset")})
+	cfg.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+
+	ctx = cfg.TracePrepareStart(context.Background(), nil, pgx.TracePrepareStartData{SQL: "SELECT 1"})
+	cfg.TracePrepareEnd(ctx, nil, pgx.TracePrepareEndData{})
+
+	require.Equal(t, 3, testutil.CollectAndCount(metrics.duration))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.errors.WithLabelValues("UPDATE", SQLSTATE_SERIALIZATION_FAILURE)))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.errors.WithLabelValues("DELETE", retryReasonConnection)))
+}
+
+func TestTraceExplainable(t *testing.T) {
+	require.True(t, (&trace{queryType: queryTypeQuery, sql: "select 1"}).explainable())
+	require.False(t, (&trace{queryType: queryTypeQuery, sql: "CREATE TABLE t (id int)"}).explainable())
+	require.False(t, (&trace{queryType: queryTypeBatch, sql: "BATCH"}).explainable())
+}
+
+func TestTracerUntraced(t *testing.T) {
+	metrics := NewQueryMetrics(prometheus.NewRegistry())
+	cfg := &TracerConfig{Metrics: metrics}
+
+	outer := cfg.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	inner := cfg.TraceQueryStart(context.WithValue(outer, untracedKey{}, true), nil, pgx.TraceQueryStartData{SQL: "EXPLAIN SELECT 1"})
+	cfg.TraceQueryEnd(inner, nil, pgx.TraceQueryEndData{})
+
+	require.Equal(t, 0, testutil.CollectAndCount(metrics.duration))
+}
+
+func TestPoolMetrics(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/db")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	pgc := &PgConnection{}
+	pgc.pools.Store(&pools{conn: pool, primary: pool})
+	registry := prometheus.NewRegistry()
+	RegisterPoolMetrics(registry, pgc)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 10)
+	for _, family := range families {
+		require.Equal(t, "primary", family.GetMetric()[0].GetLabel()[0].GetValue(), family.GetName())
+	}
+}
@@ -0,0 +1,263 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	REPLICA_ROUND_ROBIN = "round_robin"
+	REPLICA_LEAST_CONN  = "least_conn"
+
+	DEFAULT_REPLICA_MAX_LAG = 10 * time.Second
+)
+
+// replicationLagSQL returns the seconds the replica is behind the primary, zero when it
+// replayed everything it received, so an idle primary does not look like lag.
+const replicationLagSQL = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+var ErrReplicaLagging = errors.New("replica lag above the maximum")
+
+// Pooler is the part of *pgxpool.Pool used to route the statements between the primary
+// and the replicas.
+type Pooler interface {
+	IDB
+	TxBeginner
+	Ping(ctx context.Context) error
+	Close()
+}
+
+type readOnlyKeyType struct{}
+
+var readOnlyKey readOnlyKeyType
+
+// ReadOnlyContext marks the statements run with ctx, outside a transaction, as reads
+// that may be served by a replica.
+func ReadOnlyContext(baseCtx context.Context) context.Context {
+	if baseCtx == nil {
+		baseCtx = context.TODO()
+	}
+	return context.WithValue(baseCtx, readOnlyKey, true)
+}
+
+// IsReadOnly reports whether ctx was marked by ReadOnlyContext.
+func IsReadOnly(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	readOnly, _ := ctx.Value(readOnlyKey).(bool)
+	return readOnly
+}
+
+// ReplicaStatus is the last known state of a replica.
+type ReplicaStatus struct {
+	Error   error
+	Host    string
+	Lag     time.Duration
+	Healthy bool
+}
+
+type replica struct {
+	pool    Pooler
+	lastErr atomic.Pointer[error]
+	host    string
+	lag     atomic.Int64
+	healthy atomic.Bool
+}
+
+func newReplica(pool Pooler, host string) *replica {
+	r := &replica{pool: pool, host: host}
+	r.healthy.Store(true)
+	return r
+}
+
+func (r *replica) markDown(err error) {
+	r.lastErr.Store(&err)
+	r.healthy.Store(false)
+}
+
+func (r *replica) status() ReplicaStatus {
+	rs := ReplicaStatus{Host: r.host, Healthy: r.healthy.Load(), Lag: time.Duration(r.lag.Load())}
+	if err := r.lastErr.Load(); err != nil && !rs.Healthy {
+		rs.Error = *err
+	}
+	return rs
+}
+
+// SetReplicas sets the connection strings of the read replicas opened by NewPool.
+func (pgc *PgConnection) SetReplicas(connStrings ...string) *PgConnection {
+	pgc.replicaConnStrings = connStrings
+	return pgc
+}
+
+// SetReplicaStrategy sets how a replica is chosen for each read, REPLICA_ROUND_ROBIN,
+// the default, or REPLICA_LEAST_CONN.
+func (pgc *PgConnection) SetReplicaStrategy(strategy string) *PgConnection {
+	pgc.replicaStrategy = strategy
+	return pgc
+}
+
+// SetReplicaMaxLag sets the replication lag above which CheckReplicas takes a replica
+// out of the rotation. Zero disables the lag check.
+func (pgc *PgConnection) SetReplicaMaxLag(lag time.Duration) *PgConnection {
+	pgc.replicaMaxLag = lag
+	return pgc
+}
+
+// Replicas returns the state of every replica, in the configured order.
+func (pgc *PgConnection) Replicas() []ReplicaStatus {
+	replicas := pgc.current().replicas
+	statuses := make([]ReplicaStatus, 0, len(replicas))
+	for _, r := range replicas {
+		statuses = append(statuses, r.status())
+	}
+	return statuses
+}
+
+// CheckReplicas pings every replica and measures its replication lag, taking the failing
+// and lagging ones out of the rotation and bringing back the recovered ones.
+func (pgc *PgConnection) CheckReplicas(ctx context.Context) error {
+	var errs []error
+	for _, r := range pgc.current().replicas {
+		if err := pgc.checkReplica(ctx, r); err != nil {
+			r.markDown(err)
+			errs = append(errs, fmt.Errorf("replica %s: %w", r.host, err))
+			continue
+		}
+		r.healthy.Store(true)
+	}
+	return errors.Join(errs...)
+}
+
+func (pgc *PgConnection) checkReplica(ctx context.Context, r *replica) error {
+	if err := r.pool.Ping(ctx); err != nil {
+		return err
+	}
+
+	var seconds float64
+	if err := r.pool.QueryRow(ctx, replicationLagSQL).Scan(&seconds); err != nil {
+		return err
+	}
+
+	lag := time.Duration(seconds * float64(time.Second))
+	r.lag.Store(int64(lag))
+	if pgc.replicaMaxLag > 0 && lag > pgc.replicaMaxLag {
+		return fmt.Errorf("%w: %s", ErrReplicaLagging, lag)
+	}
+
+	return nil
+}
+
+// WatchReplicas blocks running CheckReplicas every interval until ctx is done.
+func (pgc *PgConnection) WatchReplicas(ctx context.Context, interval time.Duration) {
+	if len(pgc.replicaConnStrings) == 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = pgc.CheckReplicas(ctx)
+		}
+	}
+}
+
+// replica picks a healthy replica using the configured strategy, nil when none is
+// available and the primary must serve the read.
+func (pgc *PgConnection) replica(p *pools) *replica {
+	n := len(p.replicas)
+	if n == 0 {
+		return nil
+	}
+
+	if pgc.replicaStrategy == REPLICA_LEAST_CONN {
+		var (
+			best  *replica
+			least int32
+		)
+		for _, r := range p.replicas {
+			if !r.healthy.Load() {
+				continue
+			}
+			if conns := acquiredConns(r.pool); best == nil || conns < least {
+				best, least = r, conns
+			}
+		}
+		return best
+	}
+
+	start := int(pgc.nextReplica.Add(1) - 1)
+	for i := 0; i < n; i++ {
+		if r := p.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// reader returns the pool serving a read outside a transaction.
+func (pgc *PgConnection) reader(ctx context.Context, p *pools) (Pooler, *replica) {
+	if IsReadOnly(ctx) {
+		if r := pgc.replica(p); r != nil {
+			return r.pool, r
+		}
+	}
+	return p.primary, nil
+}
+
+// fallback takes r out of the rotation when err means it could not be reached, telling
+// the caller to run the statement again in the primary.
+func (pgc *PgConnection) fallback(r *replica, err error) bool {
+	if r == nil || err == nil || !isConnectionError(err) {
+		return false
+	}
+	r.markDown(err)
+	return true
+}
+
+func isConnectionError(err error) bool {
+	var (
+		nce *NotConnectedError
+		ce  *pgconn.ConnectError
+	)
+	return errors.As(err, &nce) || errors.As(err, &ce) || pgconn.SafeToRetry(err) || strings.HasPrefix(err.Error(), "failed to connect")
+}
+
+// acquiredConns returns the connections in use of pool, zero when it does not tell.
+func acquiredConns(pool Pooler) int32 {
+	switch p := pool.(type) {
+	case *pgxpool.Pool:
+		return p.Stat().AcquiredConns()
+	case interface{ AcquiredConns() int32 }:
+		return p.AcquiredConns()
+	default:
+		return 0
+	}
+}
+
+// replicaHost returns the host of a connection string, for the logs and the status,
+// without the credentials.
+func replicaHost(connString string) string {
+	cfg, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
@@ -0,0 +1,143 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePool stands in for a *pgxpool.Pool, answering the lag query with lag seconds.
+type fakePool struct {
+	fakeDB
+	beginner fakeBeginner
+	pingErr  error
+	closed   atomic.Bool
+	acquired int32
+	lag      float64
+}
+
+func (fp *fakePool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	if fp.err != nil {
+		return nil, fp.err
+	}
+	return fp.beginner.BeginTx(ctx, txOptions)
+}
+
+func (fp *fakePool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if sql == replicationLagSQL {
+		return fakeRow{rows: &fakeRows{columns: []string{"lag"}, rows: [][]any{{fp.lag}}, pos: -1}}
+	}
+	return fp.fakeDB.QueryRow(ctx, sql, args...)
+}
+
+func (fp *fakePool) Ping(ctx context.Context) error { return fp.pingErr }
+func (fp *fakePool) Close()                         { fp.closed.Store(true) }
+func (fp *fakePool) AcquiredConns() int32           { return fp.acquired }
+
+func newRoutedConnection(strategy string, primary *fakePool, replicas ...*fakePool) *PgConnection {
+	pgc := &PgConnection{replicaStrategy: strategy, replicaMaxLag: time.Second}
+	p := &pools{primary: primary}
+	for i, r := range replicas {
+		p.replicas = append(p.replicas, newReplica(r, string(rune('a'+i))))
+	}
+	pgc.pools.Store(p)
+	return pgc
+}
+
+func TestReadsGoToReplicasRoundRobin(t *testing.T) {
+	primary, r1, r2 := &fakePool{}, &fakePool{}, &fakePool{}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary, r1, r2)
+
+	ctx := context.Background()
+	readCtx := ReadOnlyContext(ctx)
+
+	for i := 0; i < 4; i++ {
+		_, err := pgc.Query(readCtx, "select")
+		require.NoError(t, err)
+	}
+	_, err := pgc.Query(ctx, "select")
+	require.NoError(t, err)
+	_, err = pgc.Exec(readCtx, "update")
+	require.NoError(t, err)
+
+	require.Len(t, r1.statements, 2)
+	require.Len(t, r2.statements, 2)
+	require.Equal(t, []string{"select", "update"}, []string{primary.statements[0].sql, primary.statements[1].sql})
+}
+
+func TestReadOnlyTxGoesToReplica(t *testing.T) {
+	primary, r1 := &fakePool{}, &fakePool{}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary, r1)
+	tm := NewTxManager(pgc)
+
+	err := tm.WithinTx(context.Background(), TxOptions{AccessMode: pgx.ReadOnly}, func(ctx context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"begin", "commit"}, r1.beginner.log)
+
+	err = tm.WithinTx(ReadOnlyContext(context.Background()), TxOptions{}, func(ctx context.Context) error {
+		_, err := pgc.Query(ctx, "select")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"begin", "select", "commit"}, primary.beginner.log)
+	require.Empty(t, r1.statements)
+}
+
+func TestLeastConnPicksIdlestReplica(t *testing.T) {
+	primary, r1, r2 := &fakePool{}, &fakePool{acquired: 5}, &fakePool{acquired: 2}
+	pgc := newRoutedConnection(REPLICA_LEAST_CONN, primary, r1, r2)
+
+	_, err := pgc.Query(ReadOnlyContext(context.Background()), "select")
+	require.NoError(t, err)
+	require.Empty(t, r1.statements)
+	require.Len(t, r2.statements, 1)
+}
+
+func TestReplicaFailureFallsBackToPrimary(t *testing.T) {
+	primary, r1 := &fakePool{}, &fakePool{}
+	r1.err = &pgconn.ConnectError{Config: &pgconn.Config{Host: "replica"}}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary, r1)
+	readCtx := ReadOnlyContext(context.Background())
+
+	_, err := pgc.Query(readCtx, "select")
+	require.NoError(t, err)
+	require.Len(t, primary.statements, 1)
+	require.False(t, pgc.Replicas()[0].Healthy)
+
+	r1.err = nil
+	_, err = pgc.Query(readCtx, "select")
+	require.NoError(t, err)
+	require.Len(t, primary.statements, 2)
+
+	require.NoError(t, pgc.CheckReplicas(context.Background()))
+	_, err = pgc.Query(readCtx, "select")
+	require.NoError(t, err)
+	require.Len(t, primary.statements, 2)
+	require.Len(t, r1.statements, 2)
+}
+
+func TestCheckReplicasEnforcesMaxLag(t *testing.T) {
+	primary, r1, r2 := &fakePool{}, &fakePool{lag: 5}, &fakePool{pingErr: errors.New("refused")}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary, r1, r2)
+
+	err := pgc.CheckReplicas(context.Background())
+	require.ErrorIs(t, err, ErrReplicaLagging)
+
+	statuses := pgc.Replicas()
+	require.False(t, statuses[0].Healthy)
+	require.Equal(t, 5*time.Second, statuses[0].Lag)
+	require.False(t, statuses[1].Healthy)
+	require.EqualError(t, statuses[1].Error, "refused")
+
+	_, err = pgc.Query(ReadOnlyContext(context.Background()), "select")
+	require.NoError(t, err)
+	require.Len(t, primary.statements, 1)
+}
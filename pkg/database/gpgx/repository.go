@@ -0,0 +1,416 @@
+package gpgx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
+)
+
+const (
+	tagDb = "db"
+
+	optPrimaryKey = "pk"
+	optGenerated  = "generated"
+	optTenant     = "tenant"
+
+	DEFAULT_PRIMARY_KEY = "id"
+)
+
+var (
+	ErrUnknownColumn   = errors.New("unknown column")
+	ErrNothingToUpdate = errors.New("nothing to update")
+	ErrConflict        = errors.New("conflicting row not updated")
+	ErrTenantRequired  = tenant.ErrRequired
+)
+
+// column is a struct field mapped through the `db` tag.
+type column struct {
+	name      string
+	index     []int
+	pk        bool
+	generated bool
+	tenant    bool
+}
+
+// Repository persists T, a struct whose fields are mapped to the columns of table by
+// the `db` tags also used by scany. Tag options mark the primary key, columns filled by
+// the database and the tenant column:
+//
+//	type Account struct {
+//		ID        string    `db:"id,pk,generated"`
+//		TenantID  string    `db:"tenant_id,tenant"`
+//		Email     string    `db:"email"`
+//		CreatedAt time.Time `db:"created_at,generated"`
+//	}
+//
+// Without a pk option the "id" column is the primary key. Generated columns are never
+// written, and every write returns the row to refresh them in the entity. When there is
+// a tenant column, every statement is restricted to, and every insert writes, the tenant
+// id of the context, failing with ErrTenantRequired without one. Contexts marked by
+// tenant.System reach every tenant and insert the tenant id of the entity.
+//
+// Statements run in the transaction carried by the context or else in db, and entities
+// implementing ContextualModel receive the context they were loaded with.
+type Repository[T any] struct {
+	db      IDB
+	table   string
+	columns []column
+	byName  map[string]column
+	pk      column
+	tenant  *column
+}
+
+// NewRepository creates the repository of T persisted in table, which may be schema
+// qualified.
+func NewRepository[T any](db IDB, table string) (*Repository[T], error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("gpgx: repository entity must be a struct, got %s", rt)
+	}
+
+	r := &Repository[T]{
+		db:     db,
+		table:  pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+		byName: make(map[string]column),
+	}
+
+	collectColumns(rt, nil, func(c column) {
+		if _, ok := r.byName[c.name]; ok {
+			return
+		}
+		r.columns = append(r.columns, c)
+		r.byName[c.name] = c
+	})
+
+	if len(r.columns) == 0 {
+		return nil, fmt.Errorf("gpgx: %s has no field with a %q tag", rt, tagDb)
+	}
+
+	pk, ok := r.byName[DEFAULT_PRIMARY_KEY]
+	for _, c := range r.columns {
+		if c.pk {
+			pk, ok = c, true
+		}
+		if c.tenant {
+			tenant := c
+			r.tenant = &tenant
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("gpgx: %s has no primary key column", rt)
+	}
+	r.pk = pk
+
+	if r.tenant != nil {
+		ft := rt.FieldByIndex(r.tenant.index).Type
+		if ft.Kind() != reflect.String && !reflect.PointerTo(ft).Implements(scannerType) {
+			return nil, fmt.Errorf("gpgx: tenant column %s of %s must be a string or a sql.Scanner, got %s", r.tenant.name, rt, ft)
+		}
+	}
+
+	return r, nil
+}
+
+func collectColumns(rt reflect.Type, prefix []int, fn func(column)) {
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		index := append(append([]int(nil), prefix...), sf.Index...)
+
+		tag, ok := sf.Tag.Lookup(tagDb)
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				collectColumns(sf.Type, index, fn)
+			}
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		if parts[0] == "-" || parts[0] == "" || !sf.IsExported() {
+			continue
+		}
+
+		c := column{name: parts[0], index: index}
+		for _, opt := range parts[1:] {
+			switch strings.TrimSpace(opt) {
+			case optPrimaryKey:
+				c.pk = true
+			case optGenerated:
+				c.generated = true
+			case optTenant:
+				c.tenant = true
+			}
+		}
+		fn(c)
+	}
+}
+
+// WithDB returns a copy of the repository running its statements in db.
+func (r Repository[T]) WithDB(db IDB) *Repository[T] {
+	r.db = db
+	return &r
+}
+
+// Columns returns the columns of the table, in field order.
+func (r *Repository[T]) Columns() []string {
+	names := make([]string, 0, len(r.columns))
+	for _, c := range r.columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// FindByID loads the entity with primary key id. A missing row is reported as a
+// PgError whose IsEmptyResult is true.
+func (r *Repository[T]) FindByID(ctx context.Context, id any) (*T, error) {
+	sql, args, err := r.selectSQL(ctx, "*", []Filter{Eq(r.pk.name, id)})
+	if err != nil {
+		return nil, err
+	}
+
+	entity := new(T)
+	if err := r.get(ctx, entity, sql, args...); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// FindMany loads every entity matching all filters.
+func (r *Repository[T]) FindMany(ctx context.Context, filters ...Filter) ([]T, error) {
+	sql, args, err := r.selectSQL(ctx, "*", filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []T
+	if err := pgxscan.Select(ctx, DB(ctx, r.db), &entities, sql, args...); err != nil {
+		return nil, WrapPgError(err)
+	}
+
+	for i := range entities {
+		hydrate(ctx, &entities[i])
+	}
+
+	return entities, nil
+}
+
+// Count returns how many entities match all filters.
+func (r *Repository[T]) Count(ctx context.Context, filters ...Filter) (int64, error) {
+	sql, args, err := r.selectSQL(ctx, "count(*)", filters)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := DB(ctx, r.db).QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, WrapPgError(err)
+	}
+
+	return count, nil
+}
+
+// Insert writes entity and refreshes it with the row stored, generated columns included.
+func (r *Repository[T]) Insert(ctx context.Context, entity *T) error {
+	sql, args, err := r.insertSQL(ctx, entity, false)
+	if err != nil {
+		return err
+	}
+
+	return r.get(ctx, entity, sql, args...)
+}
+
+// Upsert inserts entity or, when its primary key exists, updates the row. The entity is
+// refreshed with the row stored. When the existing row is left untouched, as it belongs
+// to another tenant or entity has no column to update, ErrConflict is returned and
+// entity is not refreshed.
+func (r *Repository[T]) Upsert(ctx context.Context, entity *T) error {
+	sql, args, err := r.insertSQL(ctx, entity, true)
+	if err != nil {
+		return err
+	}
+
+	err = r.get(ctx, entity, sql, args...)
+	if pe, ok := AsPgError(err); ok && pe.IsEmptyResult() {
+		return fmt.Errorf("gpgx: %w: %s", ErrConflict, r.table)
+	}
+	return err
+}
+
+// Update writes every non generated column of entity to the row with its primary key and
+// refreshes it with the row stored. A missing row is reported as a PgError whose
+// IsEmptyResult is true, and an entity without such a column as ErrNothingToUpdate.
+func (r *Repository[T]) Update(ctx context.Context, entity *T) error {
+	rv := reflect.ValueOf(entity).Elem()
+
+	var (
+		sets []string
+		args []any
+	)
+	for _, c := range r.columns {
+		if c.pk || c.generated || c.tenant {
+			continue
+		}
+		args = append(args, rv.FieldByIndex(c.index).Interface())
+		sets = append(sets, fmt.Sprintf("%s = $%d", quote(c.name), len(args)))
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("gpgx: %w: every column of %s is a key, generated or the tenant", ErrNothingToUpdate, r.table)
+	}
+
+	where, args, err := r.where(ctx, []Filter{Eq(r.pk.name, rv.FieldByIndex(r.pk.index).Interface())}, args)
+	if err != nil {
+		return err
+	}
+
+	sql := fmt.Sprintf("UPDATE %s SET %s%s RETURNING %s", r.table, strings.Join(sets, ", "), where, r.returning())
+
+	return r.get(ctx, entity, sql, args...)
+}
+
+// Delete removes the row with primary key id. A missing row is reported as a PgError
+// whose IsEmptyResult is true.
+func (r *Repository[T]) Delete(ctx context.Context, id any) error {
+	where, args, err := r.where(ctx, []Filter{Eq(r.pk.name, id)}, nil)
+	if err != nil {
+		return err
+	}
+
+	tag, err := DB(ctx, r.db).Exec(ctx, fmt.Sprintf("DELETE FROM %s%s", r.table, where), args...)
+	if err != nil {
+		return WrapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return WrapPgError(pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (r *Repository[T]) get(ctx context.Context, entity *T, sql string, args ...any) error {
+	if err := pgxscan.Get(ctx, DB(ctx, r.db), entity, sql, args...); err != nil {
+		return WrapPgError(err)
+	}
+
+	hydrate(ctx, entity)
+
+	return nil
+}
+
+func (r *Repository[T]) selectSQL(ctx context.Context, projection string, filters []Filter) (string, []any, error) {
+	if projection == "*" {
+		projection = r.returning()
+	}
+
+	where, args, err := r.where(ctx, filters, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("SELECT %s FROM %s%s", projection, r.table, where), args, nil
+}
+
+func (r *Repository[T]) insertSQL(ctx context.Context, entity *T, upsert bool) (string, []any, error) {
+	rv := reflect.ValueOf(entity).Elem()
+
+	if r.tenant != nil && !tenant.IsSystem(ctx) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := setTenant(rv.FieldByIndex(r.tenant.index), tenantID); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var (
+		names, placeholders, sets []string
+		args                      []any
+	)
+	for _, c := range r.columns {
+		if c.generated {
+			continue
+		}
+		args = append(args, rv.FieldByIndex(c.index).Interface())
+		names = append(names, quote(c.name))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		if !c.pk && !c.tenant {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quote(c.name), quote(c.name)))
+		}
+	}
+
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", r.table, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+	if upsert {
+		action := "DO NOTHING"
+		if len(sets) > 0 {
+			action = "DO UPDATE SET " + strings.Join(sets, ", ")
+		}
+		sql += fmt.Sprintf(" ON CONFLICT (%s) %s", quote(r.pk.name), action)
+		if r.tenant != nil && len(sets) > 0 {
+			// Never take over the row of another tenant.
+			sql += fmt.Sprintf(" WHERE %s.%s = EXCLUDED.%s", r.table, quote(r.tenant.name), quote(r.tenant.name))
+		}
+	}
+
+	return sql + " RETURNING " + r.returning(), args, nil
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// setTenant writes tenantID to the tenant field fv, a string or a sql.Scanner like
+// uuid.UUID, as checked by NewRepository.
+func setTenant(fv reflect.Value, tenantID string) error {
+	if fv.Kind() == reflect.String {
+		fv.SetString(tenantID)
+		return nil
+	}
+	if err := fv.Addr().Interface().(sql.Scanner).Scan(tenantID); err != nil {
+		return fmt.Errorf("gpgx: tenant id %q: %w", tenantID, err)
+	}
+	return nil
+}
+
+// where renders filters, and the tenant restriction, with placeholders numbered after args.
+func (r *Repository[T]) where(ctx context.Context, filters []Filter, args []any) (string, []any, error) {
+	if r.tenant != nil && !tenant.IsSystem(ctx) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		// Copied, not to write to the array of the caller.
+		filters = append(append([]Filter(nil), filters...), Eq(r.tenant.name, tenantID))
+	}
+
+	for _, f := range filters {
+		if _, ok := r.byName[f.Column]; !ok {
+			return "", nil, fmt.Errorf("gpgx: %w %q", ErrUnknownColumn, f.Column)
+		}
+	}
+
+	return renderWhere(filters, args)
+}
+
+func (r *Repository[T]) returning() string {
+	names := make([]string, 0, len(r.columns))
+	for _, c := range r.columns {
+		names = append(names, quote(c.name))
+	}
+	return strings.Join(names, ", ")
+}
+
+func hydrate(ctx context.Context, entity any) {
+	if ctm, ok := entity.(ContextualModel); ok {
+		ctm.SetContext(ctx)
+	}
+}
+
+func quote(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
@@ -0,0 +1,166 @@
+package gpgx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type base struct {
+	ctx context.Context
+	ID  string `db:"id,generated"`
+}
+
+func (b *base) Context() context.Context       { return b.ctx }
+func (b *base) SetContext(ctx context.Context) { b.ctx = ctx }
+
+type account struct {
+	base
+	Email    string `db:"email"`
+	Internal string `db:"-"`
+	Balance  int64  `db:"balance"`
+}
+
+type tenantAccount struct {
+	Code     string `db:"code,pk"`
+	TenantID string `db:"tenant_id,tenant"`
+	Email    string `db:"email"`
+}
+
+func TestRepositoryQueries(t *testing.T) {
+	db := &fakeDB{columns: []string{"id", "email", "balance"}, rows: [][]any{{"1", "a@b.c", int64(10)}}}
+	repo, err := NewRepository[account](db, "bank.accounts")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "email", "balance"}, repo.Columns())
+
+	ctx := context.WithValue(context.Background(), "marker", true)
+
+	found, err := repo.FindByID(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "id", "email", "balance" FROM "bank"."accounts" WHERE "id" = $1`, db.last().sql)
+	require.Equal(t, []any{"1"}, db.last().args)
+	require.Equal(t, "a@b.c", found.Email)
+	require.Equal(t, ctx, found.Context())
+
+	many, err := repo.FindMany(ctx, Eq("email", "a@b.c"), Eq("balance", 10))
+	require.NoError(t, err)
+	require.Len(t, many, 1)
+	require.Equal(t, ctx, many[0].Context())
+	require.Equal(t, `SELECT "id", "email", "balance" FROM "bank"."accounts" WHERE "email" = $1 AND "balance" = $2`, db.last().sql)
+
+	_, err = repo.FindMany(ctx, Eq("email; drop table x", 1))
+	require.ErrorIs(t, err, ErrUnknownColumn)
+
+	entity := &account{Email: "a@b.c", Balance: 10}
+	require.NoError(t, repo.Insert(ctx, entity))
+	require.Equal(t, `INSERT INTO "bank"."accounts" ("email", "balance") VALUES ($1, $2) RETURNING "id", "email", "balance"`, db.last().sql)
+	require.Equal(t, "1", entity.ID)
+
+	require.NoError(t, repo.Update(ctx, entity))
+	require.Equal(t, `UPDATE "bank"."accounts" SET "email" = $1, "balance" = $2 WHERE "id" = $3 RETURNING "id", "email", "balance"`, db.last().sql)
+	require.Equal(t, []any{"a@b.c", int64(10), "1"}, db.last().args)
+
+	db.affected = 1
+	require.NoError(t, repo.Delete(ctx, "1"))
+	require.Equal(t, `DELETE FROM "bank"."accounts" WHERE "id" = $1`, db.last().sql)
+
+	db.affected = 0
+	err = repo.Delete(ctx, "2")
+	pe, ok := AsPgError(err)
+	require.True(t, ok)
+	require.True(t, pe.IsEmptyResult())
+
+	db.columns, db.rows = []string{"count"}, [][]any{{int64(3)}}
+	count, err := repo.Count(ctx, Eq("balance", 10))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+	require.Equal(t, `SELECT count(*) FROM "bank"."accounts" WHERE "balance" = $1`, db.last().sql)
+}
+
+func TestRepositoryTenantScope(t *testing.T) {
+	db := &fakeDB{columns: []string{"code", "tenant_id", "email"}, rows: [][]any{{"c1", "t1", "a@b.c"}}}
+	repo, err := NewRepository[tenantAccount](db, "accounts")
+	require.NoError(t, err)
+
+	_, err = repo.FindByID(context.Background(), "c1")
+	require.ErrorIs(t, err, ErrTenantRequired)
+
+	ctx := TenantIDContext(context.Background(), "t1")
+
+	_, err = repo.FindByID(ctx, "c1")
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "code", "tenant_id", "email" FROM "accounts" WHERE "code" = $1 AND "tenant_id" = $2`, db.last().sql)
+	require.Equal(t, []any{"c1", "t1"}, db.last().args)
+
+	entity := &tenantAccount{Code: "c1", Email: "a@b.c"}
+	require.NoError(t, repo.Upsert(ctx, entity))
+	require.Equal(t, `INSERT INTO "accounts" ("code", "tenant_id", "email") VALUES ($1, $2, $3) `+
+		`ON CONFLICT ("code") DO UPDATE SET "email" = EXCLUDED."email" WHERE "accounts"."tenant_id" = EXCLUDED."tenant_id" `+
+		`RETURNING "code", "tenant_id", "email"`, db.last().sql)
+	require.Equal(t, []any{"c1", "t1", "a@b.c"}, db.last().args)
+
+	db.rows = nil
+	err = repo.Upsert(ctx, entity)
+	require.ErrorIs(t, err, ErrConflict)
+
+	filters := make([]Filter, 1, 2)
+	filters[0] = Eq("email", "a@b.c")
+	_, err = repo.FindMany(ctx, filters...)
+	require.NoError(t, err)
+	require.Zero(t, filters[:2][1])
+}
+
+type uuidTenantAccount struct {
+	Code     string    `db:"code,pk"`
+	TenantID uuid.UUID `db:"tenant_id,tenant"`
+}
+
+func TestRepositoryTenantFieldTypes(t *testing.T) {
+	tenantID := uuid.New()
+	db := &fakeDB{columns: []string{"code", "tenant_id"}, rows: [][]any{{"c1", tenantID}}}
+	repo, err := NewRepository[uuidTenantAccount](db, "accounts")
+	require.NoError(t, err)
+
+	// The tenant of the entity is replaced by the tenant of the context.
+	entity := &uuidTenantAccount{Code: "c1", TenantID: uuid.New()}
+	require.NoError(t, repo.Insert(TenantIDContext(context.Background(), tenantID.String()), entity))
+	require.Equal(t, []any{"c1", tenantID}, db.last().args)
+
+	err = repo.Insert(TenantIDContext(context.Background(), "not-a-uuid"), entity)
+	require.ErrorContains(t, err, "not-a-uuid")
+
+	_, err = NewRepository[struct {
+		ID       string `db:"id"`
+		TenantID int64  `db:"tenant_id,tenant"`
+	}](db, "accounts")
+	require.ErrorContains(t, err, "must be a string or a sql.Scanner")
+}
+
+func TestRepositoryUsesContextTx(t *testing.T) {
+	pool := &fakeDB{}
+	repo, err := NewRepository[account](pool, "accounts")
+	require.NoError(t, err)
+
+	var log []string
+	ctx := WithTx(context.Background(), &fakeTx{log: &log})
+
+	_ = repo.Delete(ctx, "1")
+	require.Empty(t, pool.statements)
+	require.Equal(t, []string{`DELETE FROM "accounts" WHERE "id" = $1`}, log)
+}
+
+type keyOnlyEvent struct {
+	ID        string `db:"id,pk"`
+	CreatedAt string `db:"created_at,generated"`
+}
+
+func TestRepositoryUpdateWithoutColumns(t *testing.T) {
+	db := &fakeDB{}
+	repo, err := NewRepository[keyOnlyEvent](db, "events")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, repo.Update(context.Background(), &keyOnlyEvent{ID: "e1"}), ErrNothingToUpdate)
+	require.Empty(t, db.statements)
+}
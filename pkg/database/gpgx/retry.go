@@ -0,0 +1,225 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+const (
+	DEFAULT_RETRY_MAX_ATTEMPTS = 3
+	DEFAULT_RETRY_BACKOFF      = 50 * time.Millisecond
+	DEFAULT_RETRY_MAX_BACKOFF  = 2 * time.Second
+
+	// DEFAULT_RECONNECT_INTERVAL is the minimum time between two pools rebuilt by the
+	// retries, so an outage does not turn into a stream of new pools.
+	DEFAULT_RECONNECT_INTERVAL = time.Second
+
+	SQLSTATE_TOO_MANY_CONNECTIONS = "53300"
+	SQLSTATE_ADMIN_SHUTDOWN       = "57P01"
+	SQLSTATE_CRASH_SHUTDOWN       = "57P02"
+	SQLSTATE_CANNOT_CONNECT_NOW   = "57P03"
+
+	retryReasonConnection = "connection"
+)
+
+// RetryPolicy runs again the statements failing with transient errors, waiting an
+// exponential, jittered backoff between the attempts.
+type RetryPolicy struct {
+	classifier  func(error) bool
+	metrics     *RetryMetrics
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		classifier:  IsRetryableError,
+		maxAttempts: DEFAULT_RETRY_MAX_ATTEMPTS,
+		backoff:     DEFAULT_RETRY_BACKOFF,
+		maxBackoff:  DEFAULT_RETRY_MAX_BACKOFF,
+	}
+}
+
+// SetMaxAttempts sets how many times a statement is run, the first included. One
+// disables the retries.
+func (rp *RetryPolicy) SetMaxAttempts(attempts int) *RetryPolicy {
+	rp.maxAttempts = attempts
+	return rp
+}
+
+// SetBackoff sets the initial and maximum wait between attempts. The wait doubles on
+// every attempt and is jittered.
+func (rp *RetryPolicy) SetBackoff(initial, max time.Duration) *RetryPolicy {
+	rp.backoff = initial
+	rp.maxBackoff = max
+	return rp
+}
+
+// SetClassifier replaces IsRetryableError in deciding which errors are retried.
+func (rp *RetryPolicy) SetClassifier(classifier func(error) bool) *RetryPolicy {
+	rp.classifier = classifier
+	return rp
+}
+
+func (rp *RetryPolicy) SetMetrics(metrics *RetryMetrics) *RetryPolicy {
+	rp.metrics = metrics
+	return rp
+}
+
+// Do calls fn until it succeeds, fails with an error the classifier does not retry, the
+// attempts run out or ctx is done. operation labels the logs and the metrics.
+func (rp *RetryPolicy) Do(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	return rp.do(ctx, operation, false, fn)
+}
+
+// do is Do retrying, when write is set, only the errors proving the statement did not
+// run, so it is not applied twice.
+func (rp *RetryPolicy) do(ctx context.Context, operation string, write bool, fn func(ctx context.Context) error) error {
+	if rp == nil {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !rp.retryable(err, write) {
+			return err
+		}
+
+		reason := retryReason(err)
+		if attempt >= rp.maxAttempts {
+			if attempt > 1 {
+				rp.metrics.incExhausted(operation, reason)
+				logger.Error(ctx, "gpgx: giving up "+operation+" after retries - "+err.Error(),
+					zap.Int("attempts", attempt), zap.String("reason", reason))
+			}
+			return err
+		}
+
+		wait := jitteredBackoff(rp.backoff, rp.maxBackoff, attempt-1)
+		rp.metrics.incRetries(operation, reason)
+		logger.Warn(ctx, "gpgx: retrying "+operation+" - "+err.Error(),
+			zap.Int("attempt", attempt), zap.Duration("backoff", wait), zap.String("reason", reason))
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (rp *RetryPolicy) retryable(err error, write bool) bool {
+	if rp == nil || (write && !isUnsent(err)) {
+		return false
+	}
+	return rp.classifier(err)
+}
+
+// IsRetryableError reports whether err is transient: the connection could not be
+// established or was lost, the server is starting, shutting down or out of connection
+// slots, or the statement lost a serialization conflict or a deadlock.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if pe, ok := AsPgError(err); ok && pe.Code != "" {
+		switch pe.Code {
+		case SQLSTATE_SERIALIZATION_FAILURE, SQLSTATE_DEADLOCK_DETECTED, SQLSTATE_TOO_MANY_CONNECTIONS,
+			SQLSTATE_ADMIN_SHUTDOWN, SQLSTATE_CRASH_SHUTDOWN, SQLSTATE_CANNOT_CONNECT_NOW:
+			return true
+		}
+		return strings.HasPrefix(pe.Code, "08")
+	}
+
+	var netErr net.Error
+	return isConnectionError(err) || errors.As(err, &netErr) || isClosedPool(err)
+}
+
+// isUnsent reports whether err proves the statement never reached the server, or was
+// rejected before running, so even a write can be sent again.
+func isUnsent(err error) bool {
+	if pe, ok := AsPgError(err); ok && pe.Code != "" {
+		return true
+	}
+
+	var nce *NotConnectedError
+	return errors.As(err, &nce) || isClosedPool(err) || isConnectionError(err)
+}
+
+// needsReconnect reports whether err means the pool itself is unusable and must be
+// rebuilt, instead of one of its connections.
+func needsReconnect(err error) bool {
+	var nce *NotConnectedError
+	return errors.As(err, &nce) || isClosedPool(err)
+}
+
+func isClosedPool(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "closed pool")
+}
+
+func retryReason(err error) string {
+	if pe, ok := AsPgError(err); ok && pe.Code != "" {
+		return pe.Code
+	}
+	return retryReasonConnection
+}
+
+// jitteredBackoff returns the wait before the attempt following attempt, starting at 0,
+// doubling initial up to max. Full jitter keeps the callers retrying together from
+// colliding again.
+func jitteredBackoff(initial, max time.Duration, attempt int) time.Duration {
+	d := initial << attempt
+	if d <= 0 || d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// RetryMetrics exports the retries to Prometheus.
+type RetryMetrics struct {
+	retries   *prometheus.CounterVec
+	exhausted *prometheus.CounterVec
+}
+
+// NewRetryMetrics registers the gpgx_retries_total and gpgx_retries_exhausted_total
+// counters with registry, usually prometheus.DefaultRegisterer.
+func NewRetryMetrics(registry prometheus.Registerer) *RetryMetrics {
+	return &RetryMetrics{
+		retries: promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+			Name: "gpgx_retries_total",
+			Help: "Statements run again after a transient error, by operation and SQLSTATE or connection.",
+		}, []string{"operation", "reason"}),
+		exhausted: promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+			Name: "gpgx_retries_exhausted_total",
+			Help: "Statements that kept failing after every attempt, by operation and SQLSTATE or connection.",
+		}, []string{"operation", "reason"}),
+	}
+}
+
+func (m *RetryMetrics) incRetries(operation, reason string) {
+	if m != nil {
+		m.retries.WithLabelValues(operation, reason).Inc()
+	}
+}
+
+func (m *RetryMetrics) incExhausted(operation, reason string) {
+	if m != nil {
+		m.exhausted.WithLabelValues(operation, reason).Inc()
+	}
+}
@@ -0,0 +1,225 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyPool fails the first failures statements with err.
+type flakyPool struct {
+	fakePool
+	err      error
+	failures int
+	calls    int
+}
+
+func (fp *flakyPool) fail() error {
+	fp.calls++
+	if fp.calls <= fp.failures {
+		return fp.err
+	}
+	return nil
+}
+
+func (fp *flakyPool) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	if err := fp.fail(); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return fp.fakePool.Exec(ctx, sql, arguments...)
+}
+
+func (fp *flakyPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := fp.fail(); err != nil {
+		return fakeRow{err: err}
+	}
+	return fp.fakePool.QueryRow(ctx, sql, args...)
+}
+
+func (fp *flakyPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := fp.fail(); err != nil {
+		return nil, err
+	}
+	return fp.fakePool.Query(ctx, sql, args...)
+}
+
+func (fp *flakyPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return &fakeBatchResults{err: fp.fail()}
+}
+
+type fakeBatchResults struct {
+	pgx.BatchResults
+	err error
+}
+
+func (fbr *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.NewCommandTag("INSERT 0 1"), fbr.err
+}
+
+func (fbr *fakeBatchResults) Close() error { return nil }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func newRetryingConnection(pool Pooler, policy *RetryPolicy) *PgConnection {
+	pgc := &PgConnection{retry: policy}
+	pgc.pools.Store(&pools{primary: pool})
+	return pgc
+}
+
+func fastRetries() *RetryPolicy {
+	return NewRetryPolicy().SetBackoff(time.Microsecond, time.Microsecond)
+}
+
+var errConnect = &pgconn.ConnectError{Config: &pgconn.Config{Host: "db"}}
+
+func TestRetryPolicyRetriesTransientErrors(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	policy := fastRetries().SetMaxAttempts(3).SetMetrics(NewRetryMetrics(registry))
+
+	calls := 0
+	err := policy.Do(context.Background(), "op", func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return WrapPgError(&pgconn.PgError{Code: SQLSTATE_SERIALIZATION_FAILURE})
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+	require.Equal(t, 2.0, testutil.ToFloat64(policy.metrics.retries.WithLabelValues("op", SQLSTATE_SERIALIZATION_FAILURE)))
+
+	calls = 0
+	err = policy.Do(context.Background(), "op", func(ctx context.Context) error {
+		calls++
+		return errConnect
+	})
+	require.ErrorIs(t, err, errConnect)
+	require.Equal(t, 3, calls)
+	require.Equal(t, 1.0, testutil.ToFloat64(policy.metrics.exhausted.WithLabelValues("op", retryReasonConnection)))
+
+	calls = 0
+	err = policy.Do(context.Background(), "op", func(ctx context.Context) error {
+		calls++
+		return WrapPgError(&pgconn.PgError{Code: SQLSTATE_UNIQUE_VIOLATION})
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	require.True(t, IsRetryableError(&pgconn.PgError{Code: SQLSTATE_CANNOT_CONNECT_NOW}))
+	require.True(t, IsRetryableError(&pgconn.PgError{Code: "08006"}))
+	require.True(t, IsRetryableError(timeoutError{}))
+	require.True(t, IsRetryableError(new(NotConnectedError)))
+	require.True(t, IsRetryableError(errors.New("closed pool")))
+	require.False(t, IsRetryableError(&pgconn.PgError{Code: SQLSTATE_CHECK_VIOLATION}))
+	require.False(t, IsRetryableError(context.Canceled))
+	require.False(t, IsRetryableError(pgx.ErrNoRows))
+}
+
+func TestExecRetriesOnlyUnsentStatements(t *testing.T) {
+	pool := &flakyPool{err: errConnect, failures: 2}
+	_, err := newRetryingConnection(pool, fastRetries()).Exec(context.Background(), "insert")
+	require.NoError(t, err)
+	require.Equal(t, 3, pool.calls)
+
+	// A timeout may hit after the server applied the write, running it again could
+	// apply it twice.
+	pool = &flakyPool{err: timeoutError{}, failures: 1}
+	_, err = newRetryingConnection(pool, fastRetries()).Exec(context.Background(), "insert")
+	require.ErrorIs(t, err, timeoutError{})
+	require.Equal(t, 1, pool.calls)
+}
+
+func TestQueryRowRetriesOnScan(t *testing.T) {
+	pool := &flakyPool{err: timeoutError{}, failures: 1}
+	pool.columns, pool.rows = []string{"n"}, [][]any{{int64(7)}}
+
+	var n int64
+	err := newRetryingConnection(pool, fastRetries()).QueryRow(ReadOnlyContext(context.Background()), "select").Scan(&n)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, 2, pool.calls)
+}
+
+func TestReturningWriteLostInFlightIsNotReplayed(t *testing.T) {
+	pool := &flakyPool{err: timeoutError{}, failures: 1}
+	pool.columns, pool.rows = []string{"id"}, [][]any{{int64(7)}}
+	pgc := newRetryingConnection(pool, fastRetries())
+
+	var id int64
+	err := pgc.QueryRow(context.Background(), "INSERT INTO accounts (email) VALUES ($1) RETURNING id", "a@b.c").Scan(&id)
+	require.ErrorIs(t, err, timeoutError{})
+	require.Equal(t, 1, pool.calls)
+
+	pool.calls = 0
+	_, err = pgc.Query(context.Background(), "UPDATE accounts SET email = $1 RETURNING id", "a@b.c")
+	require.ErrorIs(t, err, timeoutError{})
+	require.Equal(t, 1, pool.calls)
+
+	// Refused connections prove the statement was not sent.
+	pool.calls, pool.err = 0, errConnect
+	require.NoError(t, pgc.QueryRow(context.Background(), "INSERT INTO accounts (email) VALUES ($1) RETURNING id", "a@b.c").Scan(&id))
+	require.Equal(t, 2, pool.calls)
+}
+
+func TestSendBatchResendsUnsentBatch(t *testing.T) {
+	pool := &flakyPool{err: errConnect, failures: 2}
+	br := newRetryingConnection(pool, fastRetries()).SendBatch(context.Background(), &pgx.Batch{})
+
+	_, err := br.Exec()
+	require.NoError(t, err)
+	require.NoError(t, br.Close())
+	require.Equal(t, 3, pool.calls)
+}
+
+func TestStatementsInTxAreNotRetried(t *testing.T) {
+	pool := &flakyPool{err: errConnect, failures: 1}
+	pgc := newRetryingConnection(pool, fastRetries())
+
+	log := []string{}
+	ctx := WithTx(context.Background(), &fakeTx{log: &log})
+	_, err := pgc.Exec(ctx, "update")
+	require.NoError(t, err)
+	require.Equal(t, []string{"update"}, log)
+	require.Zero(t, pool.calls)
+}
+
+func TestReconnectReplacesStalePoolsOnce(t *testing.T) {
+	stale := &fakePool{}
+	pgc := &PgConnection{connString: "postgres://user@127.0.0.1:1/app?connect_timeout=1", maxConns: 1}
+	pgc.pools.Store(&pools{primary: stale})
+	old := pgc.current()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, pgc.reconnect(context.Background(), old))
+		}()
+	}
+	wg.Wait()
+
+	current := pgc.current()
+	require.NotSame(t, old, current)
+	require.NotNil(t, current.conn)
+	require.Eventually(t, stale.closed.Load, time.Second, time.Millisecond)
+
+	// A second wave seeing the same stale pools finds them already replaced.
+	require.NoError(t, pgc.reconnect(context.Background(), old))
+	require.Same(t, current, pgc.current())
+	pgc.Close()
+}
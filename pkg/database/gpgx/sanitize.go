@@ -2,16 +2,23 @@ package gpgx
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
+
+	"github.com/cockroachdb/apd/v3"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/decimal"
 )
 
-// Part is either a string or an int. A string is raw SQL. An int is a
-// argument placeholder.
+// Part is either a string, an int or a namedArg. A string is raw SQL. An int is a
+// argument placeholder. A namedArg is a :name or @name parameter.
 type Part any
 
 type Query struct {
@@ -33,29 +40,17 @@ func (q *Query) Sanitize(args ...any) (string, error) {
 		switch part := part.(type) {
 		case string:
 			str = part
+		case namedArg:
+			// Left as written, Compile binds the named parameters.
+			str = part.String()
 		case int:
 			argIdx := part - 1
 			if argIdx >= len(args) {
 				return "", fmt.Errorf("insufficient arguments")
 			}
-			arg := args[argIdx]
-			switch arg := arg.(type) {
-			case nil:
-				str = "null"
-			case int64:
-				str = strconv.FormatInt(arg, 10)
-			case float64:
-				str = strconv.FormatFloat(arg, 'f', -1, 64)
-			case bool:
-				str = strconv.FormatBool(arg)
-			case []byte:
-				str = QuoteBytes(arg)
-			case string:
-				str = QuoteString(arg)
-			case time.Time:
-				str = arg.Truncate(time.Microsecond).Format("'2006-01-02 15:04:05.999999999Z07:00:00'")
-			default:
-				return "", fmt.Errorf("invalid arg type: %T", arg)
+			var err error
+			if str, err = sanitizeArg(args[argIdx]); err != nil {
+				return "", err
 			}
 			argUse[argIdx] = true
 		default:
@@ -95,6 +90,188 @@ func QuoteBytes(buf []byte) string {
 	return `'\x` + hex.EncodeToString(buf) + "'"
 }
 
+// numeric is the text of a decimal number.
+type numeric string
+
+// sanitizeArg renders arg as a SQL literal. Besides nil, the integers, the floats, bool,
+// []byte, string and time.Time, it accepts decimal.Decimal, the driver.Valuer, like
+// uuid.UUID and the pgtype values, the pointers and the types based on those, and the
+// slices and arrays of them, rendered as an array literal.
+func sanitizeArg(arg any) (string, error) {
+	value, err := normalizeArg(arg)
+	if err != nil {
+		return "", err
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "null", nil
+	case []any:
+		str, err := arrayLiteral(value)
+		if err != nil {
+			return "", err
+		}
+		return QuoteString(str), nil
+	case string:
+		return QuoteString(value), nil
+	case []byte:
+		return QuoteBytes(value), nil
+	case time.Time:
+		return value.Truncate(time.Microsecond).Format("'2006-01-02 15:04:05.999999999Z07:00:00'"), nil
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return QuoteString(formatNumber(value)), nil
+		}
+	}
+
+	str := formatNumber(value)
+	if strings.HasPrefix(str, "-") {
+		// Parenthesized, so a minus before the placeholder does not start a comment.
+		return "(" + str + ")", nil
+	}
+	return str, nil
+}
+
+// formatNumber formats the numbers and the booleans normalized by normalizeArg.
+func formatNumber(value any) string {
+	switch value := value.(type) {
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float64:
+		switch {
+		case math.IsNaN(value):
+			return "NaN"
+		case math.IsInf(value, 1):
+			return "Infinity"
+		case math.IsInf(value, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case numeric:
+		return string(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// normalizeArg reduces arg to nil, int64, uint64, float64, bool, []byte, string,
+// time.Time, numeric or a []any of those.
+func normalizeArg(arg any) (any, error) {
+	switch arg := arg.(type) {
+	case nil, int64, uint64, float64, bool, []byte, string, time.Time:
+		return arg, nil
+	case decimal.Decimal:
+		return decimalText(&arg.Decimal), nil
+	case *decimal.Decimal:
+		if arg == nil {
+			return nil, nil
+		}
+		return decimalText(&arg.Decimal), nil
+	case driver.Valuer:
+		if rv := reflect.ValueOf(arg); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, nil
+		}
+		value, err := arg.Value()
+		if err != nil {
+			return nil, fmt.Errorf("invalid arg %T: %w", arg, err)
+		}
+		if _, ok := value.(driver.Valuer); ok {
+			return nil, fmt.Errorf("invalid arg type: %T", arg)
+		}
+		return normalizeArg(value)
+	}
+
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return normalizeArg(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b, nil
+		}
+
+		elems := make([]any, rv.Len())
+		for i := range elems {
+			elem, err := normalizeArg(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return elems, nil
+	}
+
+	return nil, fmt.Errorf("invalid arg type: %T", arg)
+}
+
+// decimalText returns the numeric of d, or the string of NaN and Infinity.
+func decimalText(d *apd.Decimal) any {
+	if d.Form != apd.Finite {
+		return d.String()
+	}
+	return numeric(d.Text('f'))
+}
+
+// arrayLiteral renders elems as the text of an array, {1,2} or {"a",NULL}.
+func arrayLiteral(elems []any) (string, error) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+
+	for i, elem := range elems {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+
+		switch elem := elem.(type) {
+		case nil:
+			sb.WriteString("NULL")
+		case []any:
+			str, err := arrayLiteral(elem)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(str)
+		case string:
+			sb.WriteString(quoteArrayElement(elem))
+		case []byte:
+			sb.WriteString(quoteArrayElement(`\x` + hex.EncodeToString(elem)))
+		case time.Time:
+			sb.WriteString(quoteArrayElement(elem.Truncate(time.Microsecond).Format("2006-01-02 15:04:05.999999999Z07:00:00")))
+		default:
+			sb.WriteString(quoteArrayElement(formatNumber(elem)))
+		}
+	}
+
+	sb.WriteByte('}')
+	return sb.String(), nil
+}
+
+func quoteArrayElement(str string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(str) + `"`
+}
+
 type sqlLexer struct {
 	stateFn stateFn
 	src     string
@@ -122,6 +299,20 @@ func rawState(slx *sqlLexer) stateFn {
 			return singleQuoteState
 		case '"':
 			return doubleQuoteState
+		case ':', '@':
+			nextRune, nextWidth := utf8.DecodeRuneInString(slx.src[slx.pos:])
+			if runer == ':' && nextRune == ':' {
+				// A cast, ::type.
+				slx.pos += nextWidth
+				continue
+			}
+			if isNameStart(nextRune) && !slx.followsName(slx.pos-width) {
+				if slx.pos-width-slx.start > 0 {
+					slx.parts = append(slx.parts, slx.src[slx.start:slx.pos-width])
+				}
+				slx.start = slx.pos
+				return namedState(byte(runer))
+			}
 		case '$':
 			nextRune, _ := utf8.DecodeRuneInString(slx.src[slx.pos:])
 			if '0' <= nextRune && nextRune <= '9' {
@@ -224,6 +415,35 @@ func placeholderState(slx *sqlLexer) stateFn {
 	}
 }
 
+// namedState consumes the name of a parameter introduced by prefix, already consumed.
+// The first rune must start a name.
+func namedState(prefix byte) stateFn {
+	return func(slx *sqlLexer) stateFn {
+		for {
+			runer, width := utf8.DecodeRuneInString(slx.src[slx.pos:])
+			if width > 0 && (isNameStart(runer) || '0' <= runer && runer <= '9') {
+				slx.pos += width
+				continue
+			}
+
+			slx.parts = append(slx.parts, namedArg{prefix: prefix, name: slx.src[slx.start:slx.pos]})
+			slx.start = slx.pos
+			return rawState
+		}
+	}
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+// followsName reports whether the rune before pos ends a name or a number, making the
+// : or @ at pos an operator or an array slice, as in a[lo:hi], instead of a parameter.
+func (slx *sqlLexer) followsName(pos int) bool {
+	prev, _ := utf8.DecodeLastRuneInString(slx.src[:pos])
+	return isNameStart(prev) || '0' <= prev && prev <= '9' || prev == '$'
+}
+
 func escapeStringState(slx *sqlLexer) stateFn {
 	for {
 		runer, width := utf8.DecodeRuneInString(slx.src[slx.pos:])
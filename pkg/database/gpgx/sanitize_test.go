@@ -0,0 +1,80 @@
+package gpgx
+
+import (
+	"database/sql/driver"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/decimal"
+)
+
+type status string
+
+type valuer struct{ v driver.Value }
+
+func (v valuer) Value() (driver.Value, error) { return v.v, nil }
+
+func TestSanitizeArgTypes(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	text := "o'k"
+	var nilText *string
+
+	tests := []struct {
+		arg  any
+		want string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{int8(-3), "(-3)"},
+		{uint16(7), "7"},
+		{float32(1.5), "1.5"},
+		{math.Inf(-1), "'-Infinity'"},
+		{true, "true"},
+		{"o'k", "'o''k'"},
+		{status("active"), "'active'"},
+		{&text, "'o''k'"},
+		{nilText, "null"},
+		{[]byte{1, 2}, `'\x0102'`},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "'2024-01-02 03:04:05Z'"},
+		{id, "'6ba7b810-9dad-11d1-80b4-00c04fd430c8'"},
+		{*decimal.NewFromString("-12.50"), "(-12.50)"},
+		{decimal.NewFromString("1E+3"), "1000"},
+		{decimal.NewFromString("NaN"), "'NaN'"},
+		{pgtype.Int8{Int64: 9, Valid: true}, "9"},
+		{pgtype.Text{}, "null"},
+		{pgtype.UUID{Bytes: id, Valid: true}, "'6ba7b810-9dad-11d1-80b4-00c04fd430c8'"},
+		{valuer{int64(5)}, "5"},
+		{[]int{1, -2}, "'{\"1\",\"-2\"}'"},
+		{[]string{`a"b`, `c\d`, "e'f"}, `'{"a\"b","c\\d","e''f"}'`},
+		{[]*string{&text, nil}, `'{"o''k",NULL}'`},
+		{[][]int{{1}, {2}}, `'{{"1"},{"2"}}'`},
+		{[]uuid.UUID{id}, `'{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}'`},
+		{[][]byte{{0xff}}, `'{"\\xff"}'`},
+	}
+
+	for _, tt := range tests {
+		got, err := sanitizeArg(tt.arg)
+		require.NoError(t, err, "%T", tt.arg)
+		require.Equal(t, tt.want, got, "%T", tt.arg)
+	}
+
+	_, err := sanitizeArg(struct{}{})
+	require.ErrorContains(t, err, "invalid arg type")
+}
+
+func TestSanitizeNegativeAfterMinus(t *testing.T) {
+	sql, err := SanitizeSQL("SELECT 1-$1", -1)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT 1-(-1)", sql)
+}
+
+func TestSanitizeKeepsNamedAndCasts(t *testing.T) {
+	sql, err := SanitizeSQL("SELECT $1::text, a[1:2], a[lo:hi], ':x', @y", "v")
+	require.NoError(t, err)
+	require.Equal(t, "SELECT 'v'::text, a[1:2], a[lo:hi], ':x', @y", sql)
+}
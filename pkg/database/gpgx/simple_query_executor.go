@@ -2,7 +2,6 @@ package gpgx
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -23,20 +22,9 @@ func (sqe *SimpleQueryExecutor) ExecQueryWithContext(ctx context.Context, dst an
 		ctx = context.TODO()
 	}
 
-	f := func() error {
-		return sqe.pgConn.queryFor(ctx, sqe.tx, dst, multiple, query, params...)
-	}
-
-	err := f()
-	if _, ok := err.(*NotConnectedError); ok {
-		fmt.Println("DB connection lost. Reconnecting ...")
-		err = sqe.pgConn.Reconnect(ctx)
-		if err != nil {
-			fmt.Printf("DB connection unable to reconnect - %s", err)
-			return err
-		}
-		return f()
-	}
+	// Out of a transaction, lost connections are retried and the pools rebuilt by the
+	// retry policy of the PgConnection.
+	err := sqe.pgConn.queryFor(ctx, sqe.tx, dst, multiple, query, params...)
 
 	if dst == nil {
 		if pgErr, ok := err.(*PgError); ok {
@@ -0,0 +1,247 @@
+package gpgx
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// TENANCY_RLS shares the tables between the tenants, isolated by row level security.
+	TENANCY_RLS = "rls"
+	// TENANCY_SCHEMA gives each tenant a schema, set as the search_path.
+	TENANCY_SCHEMA = "schema"
+	// TENANCY_POOL gives each tenant a database, reached through a pool of its own.
+	TENANCY_POOL = "pool"
+
+	DEFAULT_TENANT_SCHEMA_PREFIX = "tenant_"
+	DEFAULT_TENANT_POOL_LIMIT    = 20
+
+	// maxIdentifierLength is the length PostgreSQL truncates identifiers to.
+	maxIdentifierLength = 63
+)
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// SchemaResolver returns the schema of a tenant.
+type SchemaResolver func(tenantID string) (string, error)
+
+// SchemaPrefixResolver names the schemas prefix followed by the tenant id. Only the ids
+// made of lower case letters, digits and underscores are accepted, as remapping the
+// others could give two tenants the same schema.
+func SchemaPrefixResolver(prefix string) SchemaResolver {
+	return func(tenantID string) (string, error) {
+		if tenantID == "" || strings.IndexFunc(tenantID, func(r rune) bool {
+			return (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_'
+		}) >= 0 {
+			return "", fmt.Errorf("gpgx: %w: %q is not a valid schema name", ErrUnknownTenant, tenantID)
+		}
+
+		schema := prefix + tenantID
+		if len(schema) > maxIdentifierLength {
+			return "", fmt.Errorf("gpgx: %w: schema of %q longer than %d characters", ErrUnknownTenant, tenantID, maxIdentifierLength)
+		}
+		return schema, nil
+	}
+}
+
+// TenantRegistry returns the connection string of the database of a tenant, failing
+// with ErrUnknownTenant for the tenants it does not know.
+type TenantRegistry interface {
+	DSN(ctx context.Context, tenantID string) (string, error)
+}
+
+// TenantRegistryFunc adapts a function to a TenantRegistry.
+type TenantRegistryFunc func(ctx context.Context, tenantID string) (string, error)
+
+func (trf TenantRegistryFunc) DSN(ctx context.Context, tenantID string) (string, error) {
+	return trf(ctx, tenantID)
+}
+
+// StaticTenantRegistry is a TenantRegistry of fixed connection strings by tenant id.
+type StaticTenantRegistry map[string]string
+
+func (str StaticTenantRegistry) DSN(ctx context.Context, tenantID string) (string, error) {
+	dsn, ok := str[tenantID]
+	if !ok {
+		return "", fmt.Errorf("gpgx: %w %q", ErrUnknownTenant, tenantID)
+	}
+	return dsn, nil
+}
+
+// SetTenancyStrategy enables multi-tenancy with one of TENANCY_RLS, the default,
+// TENANCY_SCHEMA or TENANCY_POOL.
+func (pgc *PgConnection) SetTenancyStrategy(strategy string) *PgConnection {
+	pgc.tenancy = strategy
+	pgc.multiTenantEnabled = true
+	return pgc
+}
+
+// SetTenantSchemaResolver sets how TENANCY_SCHEMA resolves the schema of a tenant,
+// SchemaPrefixResolver(DEFAULT_TENANT_SCHEMA_PREFIX) by default.
+func (pgc *PgConnection) SetTenantSchemaResolver(resolver SchemaResolver) *PgConnection {
+	pgc.schemaResolver = resolver
+	return pgc
+}
+
+// SetTenantRegistry sets where TENANCY_POOL finds the database of a tenant.
+func (pgc *PgConnection) SetTenantRegistry(registry TenantRegistry) *PgConnection {
+	pgc.tenantRegistry = registry
+	return pgc
+}
+
+// SetTenantPoolLimit sets how many tenant pools TENANCY_POOL keeps open, closing the
+// least recently used beyond it.
+func (pgc *PgConnection) SetTenantPoolLimit(limit int) *PgConnection {
+	pgc.tenantPoolLimit = limit
+	return pgc
+}
+
+func (pgc *PgConnection) checkTenancy() error {
+	if !pgc.isMultiTenant() {
+		return nil
+	}
+
+	switch pgc.tenancy {
+	case TENANCY_RLS, TENANCY_SCHEMA:
+		return nil
+	case TENANCY_POOL:
+		if pgc.tenantRegistry == nil {
+			return errors.New("gpgx: pool tenancy requires a tenant registry")
+		}
+		return nil
+	default:
+		return fmt.Errorf("gpgx: unknown tenancy strategy %q", pgc.tenancy)
+	}
+}
+
+func (pgc *PgConnection) multiTenantConfig() *MultiTenantConfig {
+	mtc := &MultiTenantConfig{strategy: pgc.tenancy, resolveSchema: pgc.schemaResolver}
+	if mtc.resolveSchema == nil {
+		mtc.resolveSchema = SchemaPrefixResolver(DEFAULT_TENANT_SCHEMA_PREFIX)
+	}
+	return mtc
+}
+
+// tenantPools keeps the pools of the TENANCY_POOL tenants, opened on their first
+// statement and closed once the least recently used beyond the limit.
+type tenantPools struct {
+	registry TenantRegistry
+	open     func(ctx context.Context, dsn string) (*pools, error)
+	byTenant map[string]*list.Element
+	lru      *list.List
+	limit    int
+	mtx      sync.Mutex
+}
+
+type tenantPool struct {
+	pools    *pools
+	tenantID string
+}
+
+func newTenantPools(registry TenantRegistry, limit int, open func(ctx context.Context, dsn string) (*pools, error)) *tenantPools {
+	if limit <= 0 {
+		limit = DEFAULT_TENANT_POOL_LIMIT
+	}
+	return &tenantPools{
+		registry: registry,
+		open:     open,
+		byTenant: make(map[string]*list.Element),
+		lru:      list.New(),
+		limit:    limit,
+	}
+}
+
+// get returns the pools of tenantID, opening them on first use.
+func (tp *tenantPools) get(ctx context.Context, tenantID string) (*pools, error) {
+	if p := tp.lookup(tenantID); p != nil {
+		return p, nil
+	}
+
+	if tp.registry == nil {
+		return nil, fmt.Errorf("gpgx: %w %q: no tenant registry", ErrUnknownTenant, tenantID)
+	}
+	dsn, err := tp.registry.DSN(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opened out of the lock, so a slow database does not hold the other tenants.
+	opened, err := tp.open(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	if elem, ok := tp.byTenant[tenantID]; ok {
+		// Opened concurrently, keep the first.
+		go opened.close()
+		tp.lru.MoveToFront(elem)
+		return elem.Value.(*tenantPool).pools, nil
+	}
+
+	tp.byTenant[tenantID] = tp.lru.PushFront(&tenantPool{pools: opened, tenantID: tenantID})
+	for tp.lru.Len() > tp.limit {
+		tp.remove(tp.lru.Back())
+	}
+
+	return opened, nil
+}
+
+func (tp *tenantPools) lookup(tenantID string) *pools {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	elem, ok := tp.byTenant[tenantID]
+	if !ok {
+		return nil
+	}
+	tp.lru.MoveToFront(elem)
+	return elem.Value.(*tenantPool).pools
+}
+
+// evict closes the pools of tenantID when they are still stale, so the next statement
+// opens them again.
+func (tp *tenantPools) evict(tenantID string, stale *pools) {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	if elem, ok := tp.byTenant[tenantID]; ok && elem.Value.(*tenantPool).pools == stale {
+		tp.remove(elem)
+	}
+}
+
+// remove drops elem, closing its pools once their connections in use are released.
+func (tp *tenantPools) remove(elem *list.Element) {
+	t := tp.lru.Remove(elem).(*tenantPool)
+	delete(tp.byTenant, t.tenantID)
+	go t.pools.close()
+}
+
+// tenants returns the tenants with open pools, most recently used first.
+func (tp *tenantPools) tenants() []string {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	ids := make([]string, 0, tp.lru.Len())
+	for elem := tp.lru.Front(); elem != nil; elem = elem.Next() {
+		ids = append(ids, elem.Value.(*tenantPool).tenantID)
+	}
+	return ids
+}
+
+func (tp *tenantPools) close() {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	for tp.lru.Len() > 0 {
+		t := tp.lru.Remove(tp.lru.Front()).(*tenantPool)
+		delete(tp.byTenant, t.tenantID)
+		t.pools.close()
+	}
+}
@@ -0,0 +1,99 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
+)
+
+func TestSchemaPrefixResolver(t *testing.T) {
+	resolve := SchemaPrefixResolver(DEFAULT_TENANT_SCHEMA_PREFIX)
+
+	schema, err := resolve("acme_corp_01")
+	require.NoError(t, err)
+	require.Equal(t, "tenant_acme_corp_01", schema)
+
+	// Remapping would give both the schema of acme_corp_01.
+	for _, tenantID := range []string{"Acme-Corp.01", "acme-corp-01", ""} {
+		_, err = resolve(tenantID)
+		require.ErrorIs(t, err, ErrUnknownTenant)
+	}
+
+	_, err = resolve(strings.Repeat("a", maxIdentifierLength))
+	require.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestSchemaTenancyScope(t *testing.T) {
+	ctx := context.Background()
+	mtc := (&PgConnection{}).SetTenancyStrategy(TENANCY_SCHEMA).multiTenantConfig()
+	db := &fakeDB{}
+
+	require.NoError(t, mtc.scope(tenant.WithContext(ctx, "acme"), db, true))
+	require.NoError(t, mtc.scope(ctx, db, false))
+	require.NoError(t, mtc.scope(tenant.System(ctx), db, true))
+
+	require.Len(t, db.statements, 2)
+	require.Equal(t, []any{`"tenant_acme"`, true}, db.statements[0].args)
+	require.Equal(t, "SELECT set_config('search_path', '', $1)", db.statements[1].sql)
+}
+
+func TestBeginTxScopesSchema(t *testing.T) {
+	primary := &fakePool{}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary).SetTenancyStrategy(TENANCY_SCHEMA)
+
+	_, err := pgc.BeginTx(tenant.WithContext(context.Background(), "t1"), pgx.TxOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"begin", "SELECT set_config('search_path', $1, $2)"}, primary.beginner.log)
+}
+
+func TestPoolTenancy(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakePool{}
+	pgc := newRoutedConnection(REPLICA_ROUND_ROBIN, primary).SetTenancyStrategy(TENANCY_POOL)
+
+	var (
+		mtx    sync.Mutex
+		opened = make(map[string]*fakePool)
+	)
+	registry := StaticTenantRegistry{"t1": "dsn1", "t2": "dsn2", "t3": "dsn3"}
+	pgc.tenantPools = newTenantPools(registry, 2, func(ctx context.Context, dsn string) (*pools, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		fp := &fakePool{}
+		opened[dsn] = fp
+		return &pools{primary: fp}, nil
+	})
+
+	for _, id := range []string{"t1", "t2", "t1", "t3"} {
+		_, err := pgc.Exec(tenant.WithContext(ctx, id), "DELETE FROM rates")
+		require.NoError(t, err)
+	}
+	require.Len(t, opened, 3)
+	require.Len(t, opened["dsn1"].statements, 2)
+	require.Equal(t, []string{"t3", "t1"}, pgc.tenantPools.tenants())
+	require.Eventually(t, opened["dsn2"].closed.Load, time.Second, time.Millisecond)
+
+	_, err := pgc.Exec(tenant.WithContext(ctx, "t4"), "DELETE FROM rates")
+	require.ErrorIs(t, err, ErrUnknownTenant)
+
+	_, err = pgc.Exec(tenant.System(ctx), "DELETE FROM rates")
+	require.NoError(t, err)
+	require.Len(t, primary.statements, 1)
+
+	// A closed tenant pool is opened again by the next statement.
+	opened["dsn3"].err = errors.New("closed pool")
+	_, err = pgc.Exec(tenant.WithContext(ctx, "t3"), "DELETE FROM rates")
+	require.Error(t, err)
+	require.Equal(t, []string{"t1"}, pgc.tenantPools.tenants())
+	_, err = pgc.Exec(tenant.WithContext(ctx, "t3"), "DELETE FROM rates")
+	require.NoError(t, err)
+}
@@ -2,105 +2,357 @@ package gpgx
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"os"
-	"sync"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	jsoniter "github.com/json-iterator/go"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
 )
 
 const (
-	spanOperation  = "pgx.query"
-	queryTypeQuery = "Query"
+	spanQuery    = "pgx.query"
+	spanBatch    = "pgx.batch"
+	spanCopyFrom = "pgx.copy_from"
+	spanPrepare  = "pgx.prepare"
+	spanConnect  = "pgx.connect"
+
+	queryTypeQuery    = "Query"
+	queryTypeBatch    = "Batch"
+	queryTypeCopyFrom = "CopyFrom"
+	queryTypePrepare  = "Prepare"
+	queryTypeConnect  = "Connect"
 )
 
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
+var (
+	_ pgx.QueryTracer    = (*TracerConfig)(nil)
+	_ pgx.BatchTracer    = (*TracerConfig)(nil)
+	_ pgx.CopyFromTracer = (*TracerConfig)(nil)
+	_ pgx.PrepareTracer  = (*TracerConfig)(nil)
+	_ pgx.ConnectTracer  = (*TracerConfig)(nil)
+)
 
-// TracerConfig contains configs to tracing and would implement QueryTracer, BatchTracer,
-// CopyFromTracer, PrepareTracer and ConnectTracer from pgx.
+// TracerConfig traces the queries, batches, copies, prepares and connections of pgx
+// with Datadog spans, when DatadogEnabled, and logs them, when QueryTracerEnabled. The
+// SQL is obfuscated and the arguments are logged by their types only.
+//
+// Metrics, when set, observes the duration and the errors of the statements. The
+// statements lasting SlowQueryThreshold or more, when set, are logged as warnings,
+// with their plan when ExplainSlowQueries.
 type TracerConfig struct {
-	spanMap            map[string]*tracer.Span
+	queryTracer        atomic.Pointer[bool]
+	Metrics            *QueryMetrics
+	SlowQueryThreshold time.Duration
 	DatadogEnabled     bool
 	QueryTracerEnabled bool
+	// ExplainSlowQueries runs EXPLAIN for the slow queries in their connection, before
+	// it is released. Meant for development, it delays the caller by a round trip.
+	ExplainSlowQueries bool
 }
 
-type spanMapKeyType string
+// SetQueryTracerEnabled enables or disables the query output at runtime, overriding QueryTracerEnabled.
+func (cfg *TracerConfig) SetQueryTracerEnabled(enabled bool) {
+	cfg.queryTracer.Store(&enabled)
+}
 
-var (
-	spanMapKey spanMapKeyType = "spanMapKey"
-	mtx        sync.Mutex
-)
+func (cfg *TracerConfig) isQueryTracerEnabled() bool {
+	if enabled := cfg.queryTracer.Load(); enabled != nil {
+		return *enabled
+	}
+	return cfg.QueryTracerEnabled
+}
 
-type Option func(*TracerConfig)
+type traceKey struct{}
+
+// untracedKey marks the statements run by the tracer itself.
+type untracedKey struct{}
+
+// trace is an operation in progress, kept in the context pgx passes from its start to
+// its end.
+type trace struct {
+	start     time.Time
+	span      ddtrace.Span
+	queryType string
+	sql       string
+	args      []any
+	queries   int
+	failed    int
+}
 
 // TraceQueryStart is called at the beginning of Query, QueryRow, and Exec calls. The returned context is used for the
 // rest of the call and will be passed to TraceQueryEnd.
 func (cfg *TracerConfig) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
-	// if strings.Index(data.SQL, "set_config") > 0 {
-	// 	return ctx
-	// }
+	return cfg.start(ctx, spanQuery, &trace{queryType: queryTypeQuery, sql: data.SQL, args: data.Args})
+}
 
-	if cfg.QueryTracerEnabled {
-		dataArgs, err := json.Marshal(data.Args)
-		if err != nil {
-			fmt.Println("Error marshal query args")
-		}
-		fmt.Printf("\n\nQUERY: %s - ARGS: - %s\n\n", data.SQL, string(dataArgs))
+// TraceQueryEnd traces the end of the query, implementing pgx.QueryTracer.
+func (cfg *TracerConfig) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	cfg.end(ctx, conn, data.CommandTag, data.Err)
+}
+
+// TraceBatchStart is called at the beginning of SendBatch calls.
+func (cfg *TracerConfig) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	t := &trace{queryType: queryTypeBatch, sql: "BATCH"}
+	ctx = cfg.start(ctx, spanBatch, t)
+
+	if t.span != nil && data.Batch != nil {
+		t.span.SetTag("db.batch.size", data.Batch.Len())
+	}
+	return ctx
+}
+
+// TraceBatchQuery is called once per query of the batch, as its results are read.
+func (cfg *TracerConfig) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	t, ok := ctx.Value(traceKey{}).(*trace)
+	if !ok {
+		return
 	}
 
+	t.queries++
+	failed := isTraceError(data.Err)
+	if failed {
+		t.failed++
+		cfg.Metrics.incErrors(statementOperation(data.SQL), data.Err)
+	}
+
+	if !cfg.isQueryTracerEnabled() {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("query_type", queryTypeBatch),
+		zap.String("sql", ObfuscateSQL(data.SQL)),
+		zap.Strings("args", RedactArgs(data.Args)),
+		zap.String("command_tag", data.CommandTag.String()),
+	}
+	if failed {
+		logger.Error(ctx, "gpgx: batch query failed", append(fields, zap.Error(data.Err))...)
+		return
+	}
+	logger.Info(ctx, "gpgx: batch query", fields...)
+}
+
+// TraceBatchEnd is called at the end of SendBatch calls.
+func (cfg *TracerConfig) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	cfg.end(ctx, conn, pgconn.CommandTag{}, data.Err)
+}
+
+// TraceCopyFromStart is called at the beginning of CopyFrom calls.
+func (cfg *TracerConfig) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return cfg.start(ctx, spanCopyFrom, &trace{
+		queryType: queryTypeCopyFrom,
+		sql:       "COPY " + data.TableName.Sanitize() + " (" + quoteColumns(data.ColumnNames) + ") FROM STDIN",
+	})
+}
+
+// TraceCopyFromEnd is called at the end of CopyFrom calls.
+func (cfg *TracerConfig) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	cfg.end(ctx, conn, data.CommandTag, data.Err)
+}
+
+// TracePrepareStart is called at the beginning of Prepare calls.
+func (cfg *TracerConfig) TracePrepareStart(ctx context.Context, _ *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	return cfg.start(ctx, spanPrepare, &trace{queryType: queryTypePrepare, sql: data.SQL})
+}
+
+// TracePrepareEnd is called at the end of Prepare calls.
+func (cfg *TracerConfig) TracePrepareEnd(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareEndData) {
+	if t, ok := ctx.Value(traceKey{}).(*trace); ok && t.span != nil {
+		t.span.SetTag("db.prepare.already_prepared", data.AlreadyPrepared)
+	}
+	cfg.end(ctx, conn, pgconn.CommandTag{}, data.Err)
+}
+
+// TraceConnectStart is called at the beginning of Connect and ConnectConfig calls, the
+// connections of the pool included.
+func (cfg *TracerConfig) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	t := &trace{queryType: queryTypeConnect, sql: "CONNECT"}
+	ctx = cfg.start(ctx, spanConnect, t)
+
+	if t.span != nil && data.ConnConfig != nil {
+		t.span.SetTag(ext.TargetHost, data.ConnConfig.Host)
+		t.span.SetTag(ext.TargetPort, data.ConnConfig.Port)
+		t.span.SetTag(ext.DBName, data.ConnConfig.Database)
+		t.span.SetTag(ext.DBUser, data.ConnConfig.User)
+	}
+	return ctx
+}
+
+// TraceConnectEnd is called at the end of Connect and ConnectConfig calls.
+func (cfg *TracerConfig) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	cfg.end(ctx, nil, pgconn.CommandTag{}, data.Err)
+}
+
+func (cfg *TracerConfig) start(ctx context.Context, operation string, t *trace) context.Context {
+	if ctx.Value(untracedKey{}) != nil {
+		// Hides the trace of the statement the tracer runs from its own end.
+		return context.WithValue(ctx, traceKey{}, nil)
+	}
+	t.start = time.Now()
+
 	if cfg.DatadogEnabled {
-		opts := []ddtrace.StartSpanOption{
-			tracer.SpanType(ext.SpanTypeSQL),
-			tracer.Tag(ext.Component, "jackc/pgx"),
-			tracer.Tag(ext.ResourceName, data.SQL),
-			tracer.Tag("db.system", "postgresql"),
-			tracer.Tag("sql.query_type", queryTypeQuery),
-			tracer.Tag("dd.env", os.Getenv("DD_ENV")),
-			tracer.Tag("dd.version", os.Getenv("DD_VERSION")),
+		t.span, ctx = tracer.StartSpanFromContext(ctx, operation, cfg.spanOptions(t)...)
+	}
+
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+func (cfg *TracerConfig) end(ctx context.Context, conn *pgx.Conn, commandTag pgconn.CommandTag, err error) {
+	t, ok := ctx.Value(traceKey{}).(*trace)
+	if !ok {
+		return
+	}
+	duration := time.Since(t.start)
+	failed := isTraceError(err)
+
+	if t.isStatement() {
+		operation := t.operation()
+		cfg.Metrics.observe(Fingerprint(t.sql), operation, duration.Seconds())
+		if failed {
+			cfg.Metrics.incErrors(operation, err)
 		}
+		if cfg.SlowQueryThreshold > 0 && duration >= cfg.SlowQueryThreshold {
+			cfg.logSlow(ctx, conn, t, duration, failed)
+		}
+	}
 
-		sn := os.Getenv("DD_SERVICE_DB")
-		if sn == "" {
-			sn = os.Getenv("DD_SERVICE_DB")
+	if t.span != nil {
+		if commandTag.String() != "" {
+			t.span.SetTag("db.command_tag", commandTag.String())
+			t.span.SetTag("db.rows_affected", commandTag.RowsAffected())
 		}
-		if sn != "" {
-			opts = append(opts, tracer.ServiceName(sn))
-		} else {
-			opts = append(opts, tracer.ServiceName(os.Getenv("DD_SERVICE")+".db"))
+		if t.queryType == queryTypeBatch {
+			t.span.SetTag("db.batch.queries", t.queries)
+			t.span.SetTag("db.batch.failed", t.failed)
 		}
 
-		span, _ := tracer.StartSpanFromContext(ctx, spanOperation, opts...)
-		mtx.Lock()
-		if cfg.spanMap == nil {
-			cfg.spanMap = make(map[string]*ddtrace.Span)
+		var opts []ddtrace.FinishOption
+		if failed {
+			opts = append(opts, tracer.WithError(err))
 		}
+		t.span.Finish(opts...)
+	}
 
-		uuidKey := uuid.New().String()
-		cfg.spanMap[uuidKey] = &span
-		mtx.Unlock()
+	if !cfg.isQueryTracerEnabled() {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("query_type", t.queryType),
+		zap.String("sql", ObfuscateSQL(t.sql)),
+		zap.Duration("duration", duration),
+	}
+	if t.args != nil {
+		fields = append(fields, zap.Strings("args", RedactArgs(t.args)))
+	}
+	if commandTag.String() != "" {
+		fields = append(fields, zap.String("command_tag", commandTag.String()), zap.Int64("rows_affected", commandTag.RowsAffected()))
+	}
+	if failed {
+		logger.Error(ctx, "gpgx: "+t.queryType+" failed", append(fields, zap.Error(err))...)
+		return
+	}
+	logger.Info(ctx, "gpgx: "+t.queryType, fields...)
+}
 
-		return context.WithValue(ctx, spanMapKey, uuidKey)
+// logSlow warns about t, lasting duration, with its plan when ExplainSlowQueries.
+func (cfg *TracerConfig) logSlow(ctx context.Context, conn *pgx.Conn, t *trace, duration time.Duration, failed bool) {
+	fields := []zap.Field{
+		zap.String("query_type", t.queryType),
+		zap.String("fingerprint", Fingerprint(t.sql)),
+		zap.String("sql", ObfuscateSQL(t.sql)),
+		zap.Strings("args", RedactArgs(t.args)),
+		zap.Duration("duration", duration),
+		zap.Duration("threshold", cfg.SlowQueryThreshold),
 	}
 
-	return ctx
+	// A failed statement may have aborted its transaction, EXPLAIN would fail too.
+	if cfg.ExplainSlowQueries && conn != nil && !failed && t.explainable() {
+		plan, err := explain(ctx, conn, t)
+		if err != nil {
+			fields = append(fields, zap.String("explain_error", err.Error()))
+		} else {
+			fields = append(fields, zap.String("plan", plan))
+		}
+	}
+
+	logger.Warn(ctx, "gpgx: slow "+t.queryType, fields...)
 }
 
-// TraceQueryEnd traces the end of the query, implementing pgx.QueryTracer.
-func (cfg *TracerConfig) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
-	uuidKey := ctx.Value(spanMapKey)
-	if uuidKey != nil {
-		if k, ok := uuidKey.(string); ok {
-			mtx.Lock()
-			span := cfg.spanMap[k]
-			(*span).Finish()
-
-			delete(cfg.spanMap, k)
-			mtx.Unlock()
-		}
+// explain returns the plan of t, without running it again, in conn. The caller's
+// cancelation is ignored, as a canceled statement closes its connection.
+func explain(ctx context.Context, conn *pgx.Conn, t *trace) (string, error) {
+	ctx = context.WithValue(context.WithoutCancel(ctx), untracedKey{}, true)
+
+	rows, err := conn.Query(ctx, "EXPLAIN (ANALYZE false) "+t.sql, t.args...)
+	if err != nil {
+		return "", err
+	}
+	lines, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", err
 	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// isStatement reports whether t runs statements, measured by the metrics and the slow
+// query log, unlike the prepares and the connections.
+func (t *trace) isStatement() bool {
+	return t.queryType == queryTypeQuery || t.queryType == queryTypeBatch || t.queryType == queryTypeCopyFrom
+}
+
+// operation labels the metrics of t: the first keyword of a query, BATCH or COPY.
+func (t *trace) operation() string {
+	switch t.queryType {
+	case queryTypeBatch:
+		return "BATCH"
+	case queryTypeCopyFrom:
+		return "COPY"
+	default:
+		return statementOperation(t.sql)
+	}
+}
+
+// explainable reports whether EXPLAIN accepts t.
+func (t *trace) explainable() bool {
+	if t.queryType != queryTypeQuery {
+		return false
+	}
+	switch t.operation() {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "VALUES", "MERGE", "TABLE":
+		return true
+	default:
+		return false
+	}
+}
+
+func (cfg *TracerConfig) spanOptions(t *trace) []ddtrace.StartSpanOption {
+	opts := []ddtrace.StartSpanOption{
+		tracer.SpanType(ext.SpanTypeSQL),
+		tracer.Tag(ext.Component, "jackc/pgx"),
+		tracer.Tag(ext.ResourceName, ObfuscateSQL(t.sql)),
+		tracer.Tag("db.system", "postgresql"),
+		tracer.Tag("sql.query_type", t.queryType),
+		tracer.Tag("dd.env", os.Getenv("DD_ENV")),
+		tracer.Tag("dd.version", os.Getenv("DD_VERSION")),
+	}
+
+	if sn := os.Getenv("DD_SERVICE_DB"); sn != "" {
+		opts = append(opts, tracer.ServiceName(sn))
+	} else {
+		opts = append(opts, tracer.ServiceName(os.Getenv("DD_SERVICE")+".db"))
+	}
+
+	return opts
+}
+
+// isTraceError reports whether err fails the operation, pgx.ErrNoRows being a result.
+func isTraceError(err error) bool {
+	return err != nil && !errors.Is(err, pgx.ErrNoRows)
 }
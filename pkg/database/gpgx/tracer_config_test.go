@@ -0,0 +1,151 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestObfuscateSQL(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE id = $1":                       "SELECT * FROM users WHERE id = $1",
+		"SELECT * FROM users WHERE name = 'it''s' AND age > 42":   "SELECT * FROM users WHERE name = ? AND age > ?",
+		"UPDATE t SET price = 1.5e-3, v2 = -7 WHERE \"col1\" = 3": "UPDATE t SET price = ?, v2 = -? WHERE \"col1\" = ?",
+		"SELECT $$secret$$, $tag$ x $1 $tag$, $2":                 "SELECT ?, ?, $2",
+		"SELECT 1 -- 'kept' 2\nFROM t":                            "SELECT ? -- 'kept' 2\nFROM t",
+		"SELECT 'unterminated":                                    "SELECT ?",
+		"SELECT /* don't /* nested */ */ 'secret'":                "SELECT /* don't /* nested */ */ ?",
+		`SELECT E'it\'s secret', e'a\\' FROM t WHERE type = 'x'`:  "SELECT ?, ? FROM t WHERE type = ?",
+	}
+
+	for sql, want := range tests {
+		require.Equal(t, want, ObfuscateSQL(sql), sql)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	require.Equal(t, []string{"string", "int", "NULL", "[]uint8"}, RedactArgs([]any{"secret", 42, nil, []byte("x")}))
+}
+
+func TestTracerQuery(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cfg := &TracerConfig{DatadogEnabled: true}
+	cfg.SetQueryTracerEnabled(true)
+
+	ctx := cfg.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  "UPDATE accounts SET name = 'bob' WHERE id = $1",
+		Args: []any{7},
+	})
+	cfg.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("UPDATE 3")})
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, spanQuery, spans[0].OperationName())
+	require.Equal(t, "UPDATE accounts SET name = ? WHERE id = $1", spans[0].Tag(ext.ResourceName))
+	require.Equal(t, "UPDATE 3", spans[0].Tag("db.command_tag"))
+	require.EqualValues(t, 3, spans[0].Tag("db.rows_affected"))
+	require.Nil(t, spans[0].Tag(ext.Error))
+}
+
+func TestTracerErrors(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cfg := &TracerConfig{DatadogEnabled: true}
+	failure := errors.New("connection refused")
+
+	ctx := cfg.TraceConnectStart(context.Background(), pgx.TraceConnectStartData{ConnConfig: &pgx.ConnConfig{}})
+	cfg.TraceConnectEnd(ctx, pgx.TraceConnectEndData{Err: failure})
+
+	ctx = cfg.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	cfg.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: pgx.ErrNoRows})
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, spanConnect, spans[0].OperationName())
+	require.Equal(t, failure, spans[0].Tag(ext.Error))
+	require.Nil(t, spans[1].Tag(ext.Error))
+}
+
+func TestTracerBatchCopyPrepare(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cfg := &TracerConfig{DatadogEnabled: true}
+
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1")
+	batch.Queue("SELECT 2")
+	ctx := cfg.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: batch})
+	cfg.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+	cfg.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 2", Err: errors.New("boom")})
+	cfg.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+
+	ctx = cfg.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{
+		TableName:   pgx.Identifier{"accounts"},
+		ColumnNames: []string{"id", "name"},
+	})
+	cfg.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{CommandTag: pgconn.NewCommandTag("COPY 2")})
+
+	ctx = cfg.TracePrepareStart(context.Background(), nil, pgx.TracePrepareStartData{Name: "s", SQL: "SELECT $1"})
+	cfg.TracePrepareEnd(ctx, nil, pgx.TracePrepareEndData{AlreadyPrepared: true})
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 3)
+
+	require.Equal(t, spanBatch, spans[0].OperationName())
+	require.Equal(t, 2, spans[0].Tag("db.batch.size"))
+	require.Equal(t, 2, spans[0].Tag("db.batch.queries"))
+	require.Equal(t, 1, spans[0].Tag("db.batch.failed"))
+
+	require.Equal(t, spanCopyFrom, spans[1].OperationName())
+	require.Equal(t, `COPY "accounts" ("id", "name") FROM STDIN`, spans[1].Tag(ext.ResourceName))
+	require.EqualValues(t, 2, spans[1].Tag("db.rows_affected"))
+
+	require.Equal(t, spanPrepare, spans[2].OperationName())
+	require.Equal(t, true, spans[2].Tag("db.prepare.already_prepared"))
+}
+
+func TestTracerWithoutStart(t *testing.T) {
+	cfg := &TracerConfig{DatadogEnabled: true, QueryTracerEnabled: true}
+
+	require.NotPanics(t, func() {
+		cfg.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+		cfg.TraceBatchQuery(context.Background(), nil, pgx.TraceBatchQueryData{})
+	})
+}
+
+func TestSetQueryTracerEnabledDuringReconnect(t *testing.T) {
+	pgc := &PgConnection{maxConns: 1}
+	require.NoError(t, pgc.NewPool(context.Background(), "postgres://user@127.0.0.1:1/db"))
+	defer pgc.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			require.NoError(t, pgc.Reconnect(context.Background()))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			pgc.SetQueryTracerEnabled(i%2 == 0)
+		}
+	}()
+	wg.Wait()
+
+	pgc.SetQueryTracerEnabled(true)
+	require.NoError(t, pgc.Reconnect(context.Background()))
+	require.True(t, pgc.tracer.Load().isQueryTracerEnabled())
+}
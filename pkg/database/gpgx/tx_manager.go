@@ -0,0 +1,157 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DEFAULT_TX_MAX_RETRIES   = 3
+	DEFAULT_TX_RETRY_BACKOFF = 10 * time.Millisecond
+	DEFAULT_TX_MAX_BACKOFF   = time.Second
+
+	SQLSTATE_SERIALIZATION_FAILURE = "40001"
+	SQLSTATE_DEADLOCK_DETECTED     = "40P01"
+)
+
+type txKeyType struct{}
+
+var txKey txKeyType
+
+// TxBeginner starts transactions, like *pgxpool.Pool and *pgx.Conn.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// TxManager runs functions inside a transaction carried by the context, so every IDB
+// resolved through DB or a PgConnection joins it.
+type TxManager struct {
+	db           TxBeginner
+	maxRetries   int
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+}
+
+func NewTxManager(db TxBeginner) *TxManager {
+	return &TxManager{
+		db:           db,
+		maxRetries:   DEFAULT_TX_MAX_RETRIES,
+		retryBackoff: DEFAULT_TX_RETRY_BACKOFF,
+		maxBackoff:   DEFAULT_TX_MAX_BACKOFF,
+	}
+}
+
+// SetMaxRetries sets how many times a transaction failing with a serialization failure
+// or a deadlock is run again. Zero disables the retries.
+func (tm *TxManager) SetMaxRetries(retries int) *TxManager {
+	tm.maxRetries = retries
+	return tm
+}
+
+// SetRetryBackoff sets the initial and maximum wait between retries. The wait doubles
+// on every attempt and is jittered.
+func (tm *TxManager) SetRetryBackoff(initial, max time.Duration) *TxManager {
+	tm.retryBackoff = initial
+	tm.maxBackoff = max
+	return tm
+}
+
+// WithinTx runs fn inside a transaction and commits it when fn returns nil. The
+// transaction is rolled back when fn returns an error or panics, the panic being
+// propagated afterwards.
+//
+// When ctx already carries a transaction, fn runs in a savepoint of it and opts are
+// ignored; only a failure of fn is rolled back, to the savepoint. Top level transactions
+// failing with SQLSTATE 40001 or 40P01 are retried with backoff, so fn must be safe to
+// run more than once.
+func (tm *TxManager) WithinTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		return runTx(ctx, tx.Begin, fn)
+	}
+
+	begin := func(ctx context.Context) (pgx.Tx, error) {
+		return tm.db.BeginTx(ctx, opts.pgx())
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, begin, fn)
+		if err == nil || attempt >= tm.maxRetries || !IsRetryableTxError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(tm.backoff(attempt)):
+		}
+	}
+}
+
+func runTx(ctx context.Context, begin func(context.Context) (pgx.Tx, error), fn func(ctx context.Context) error) (err error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			panic(p)
+		}
+	}()
+
+	if err = fn(WithTx(ctx, tx)); err != nil {
+		if rbErr := tx.Rollback(context.WithoutCancel(ctx)); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+			return errors.Join(err, fmt.Errorf("rollback transaction: %w", rbErr))
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (tm *TxManager) backoff(attempt int) time.Duration {
+	return jitteredBackoff(tm.retryBackoff, tm.maxBackoff, attempt)
+}
+
+// IsRetryableTxError reports whether err is a serialization failure or a deadlock, after
+// which the whole transaction can be run again.
+func IsRetryableTxError(err error) bool {
+	pe, ok := AsPgError(err)
+	return ok && (pe.IsSerializationFailure() || pe.IsDeadlock())
+}
+
+// WithTx returns a copy of ctx carrying tx.
+func WithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx.
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	tx, ok := ctx.Value(txKey).(pgx.Tx)
+	return tx, ok
+}
+
+// DB returns the transaction carried by ctx or, without one, db.
+func DB(ctx context.Context, db IDB) IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+func (o TxOptions) pgx() pgx.TxOptions {
+	return pgx.TxOptions{
+		IsoLevel:       o.IsoLevel,
+		AccessMode:     o.AccessMode,
+		DeferrableMode: o.DeferrableMode,
+	}
+}
@@ -0,0 +1,159 @@
+package gpgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTx records the transaction statements in log. Nested transactions are savepoints.
+type fakeTx struct {
+	pgx.Tx
+	log   *[]string
+	level int
+}
+
+func (ft *fakeTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	*ft.log = append(*ft.log, "savepoint")
+	return &fakeTx{log: ft.log, level: ft.level + 1}, nil
+}
+
+func (ft *fakeTx) Commit(ctx context.Context) error {
+	if ft.level > 0 {
+		*ft.log = append(*ft.log, "release")
+	} else {
+		*ft.log = append(*ft.log, "commit")
+	}
+	return nil
+}
+
+func (ft *fakeTx) Rollback(ctx context.Context) error {
+	if ft.level > 0 {
+		*ft.log = append(*ft.log, "rollback to savepoint")
+	} else {
+		*ft.log = append(*ft.log, "rollback")
+	}
+	return nil
+}
+
+func (ft *fakeTx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	*ft.log = append(*ft.log, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (ft *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	*ft.log = append(*ft.log, sql)
+	return &fakeRows{pos: -1}, nil
+}
+
+type fakeBeginner struct {
+	log  []string
+	opts []pgx.TxOptions
+}
+
+func (fb *fakeBeginner) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	fb.log = append(fb.log, "begin")
+	fb.opts = append(fb.opts, txOptions)
+	return &fakeTx{log: &fb.log}, nil
+}
+
+func exec(ctx context.Context, sql string) error {
+	_, err := DB(ctx, nil).Exec(ctx, sql)
+	return err
+}
+
+func TestWithinTxCommits(t *testing.T) {
+	db := &fakeBeginner{}
+	tm := NewTxManager(db)
+
+	err := tm.WithinTx(context.Background(), TxOptions{IsoLevel: pgx.Serializable}, func(ctx context.Context) error {
+		return exec(ctx, "insert")
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"begin", "insert", "commit"}, db.log)
+	require.Equal(t, pgx.Serializable, db.opts[0].IsoLevel)
+}
+
+func TestWithinTxRollsBackOnErrorAndPanic(t *testing.T) {
+	db := &fakeBeginner{}
+	tm := NewTxManager(db)
+	errFailed := errors.New("failed")
+
+	err := tm.WithinTx(context.Background(), TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, exec(ctx, "insert"))
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	require.Equal(t, []string{"begin", "insert", "rollback"}, db.log)
+
+	db.log = nil
+	require.PanicsWithValue(t, "boom", func() {
+		_ = tm.WithinTx(context.Background(), TxOptions{}, func(ctx context.Context) error {
+			panic("boom")
+		})
+	})
+	require.Equal(t, []string{"begin", "rollback"}, db.log)
+}
+
+func TestWithinTxNestsSavepoints(t *testing.T) {
+	db := &fakeBeginner{}
+	tm := NewTxManager(db)
+
+	err := tm.WithinTx(context.Background(), TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, exec(ctx, "insert a"))
+
+		err := tm.WithinTx(ctx, TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, exec(ctx, "insert b"))
+			return errors.New("b failed")
+		})
+		require.Error(t, err)
+
+		return tm.WithinTx(ctx, TxOptions{}, func(ctx context.Context) error {
+			return exec(ctx, "insert c")
+		})
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"begin", "insert a",
+		"savepoint", "insert b", "rollback to savepoint",
+		"savepoint", "insert c", "release",
+		"commit",
+	}, db.log)
+}
+
+func TestWithinTxRetriesSerializationFailures(t *testing.T) {
+	db := &fakeBeginner{}
+	tm := NewTxManager(db).SetMaxRetries(2).SetRetryBackoff(time.Millisecond, time.Millisecond)
+
+	attempts := 0
+	err := tm.WithinTx(context.Background(), TxOptions{}, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return &pgconn.PgError{Code: SQLSTATE_SERIALIZATION_FAILURE}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = tm.WithinTx(context.Background(), TxOptions{}, func(ctx context.Context) error {
+		attempts++
+		return &pgconn.PgError{Code: SQLSTATE_DEADLOCK_DETECTED}
+	})
+	require.True(t, IsRetryableTxError(err))
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = tm.WithinTx(context.Background(), TxOptions{}, func(ctx context.Context) error {
+		attempts++
+		return &pgconn.PgError{Code: "23505"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+}
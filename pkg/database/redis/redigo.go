@@ -246,3 +246,15 @@ func (rdbg *Redigo) prepareOptions(ctx context.Context, opt *RedigoPoolOptions)
 	// retOpts.RouteByLatency = true
 	return retOpts
 }
+
+// Ping sends a PING through a connection borrowed from the pool, honoring ctx.
+func (rdbg *Redigo) Ping(ctx context.Context) error {
+	conn, err := rdbg.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = rgo.DoContext(conn, ctx, "PING")
+	return err
+}
@@ -0,0 +1,39 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPChecker checks that a GET on url answers with a 2xx status.
+func HTTPChecker(client *http.Client, url string, headers map[string]string) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+
+		return nil
+	})
+}
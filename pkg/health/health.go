@@ -0,0 +1,333 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Criticality tells how a failing check affects the overall status.
+type Criticality string
+
+const (
+	// CRITICAL checks take the service down when they fail.
+	CRITICAL Criticality = "critical"
+	// DEGRADED checks only degrade the service when they fail.
+	DEGRADED Criticality = "degraded"
+)
+
+const (
+	STATUS_UP       = "UP"
+	STATUS_DEGRADED = "DEGRADED"
+	STATUS_DOWN     = "DOWN"
+
+	DEFAULT_TIMEOUT = 2 * time.Second
+)
+
+var (
+	ErrInvalidCheck   = errors.New("health: invalid check")
+	ErrDuplicateCheck = errors.New("health: check already registered")
+)
+
+// Checker verifies a single dependency. It must honor ctx cancellation.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function, like (*pgxpool.Pool).Ping, to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (cf CheckerFunc) Check(ctx context.Context) error {
+	return cf(ctx)
+}
+
+// Check is a named Checker registered in a Registry.
+type Check struct {
+	Checker     Checker
+	Metadata    map[string]string
+	Name        string
+	Criticality Criticality
+	Timeout     time.Duration
+}
+
+// Result is the outcome of a Check.
+type Result struct {
+	CheckedAt   time.Time         `json:"checked_at"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Criticality Criticality       `json:"criticality"`
+	LatencyMs   float64           `json:"latency_ms"`
+}
+
+// Report aggregates the results of every registered check.
+type Report struct {
+	Components map[string]Result `json:"components"`
+	Status     string            `json:"status"`
+}
+
+// Registry holds the checks of the application, in registration order, and the last
+// result of each one.
+type Registry struct {
+	cache     map[string]Result
+	inflight  map[string]chan struct{}
+	histories map[string]*history
+	metrics   *Metrics
+	checks    []Check
+	cacheTTL  time.Duration
+	mtx       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		cache:     make(map[string]Result),
+		inflight:  make(map[string]chan struct{}),
+		histories: make(map[string]*history),
+	}
+}
+
+// SetMetrics exports the result of every check execution to metrics.
+func (r *Registry) SetMetrics(metrics *Metrics) *Registry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.metrics = metrics
+	return r
+}
+
+// SetCacheTTL makes Run reuse the result of a check younger than ttl instead of hitting
+// the dependency again.
+func (r *Registry) SetCacheTTL(ttl time.Duration) *Registry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.cacheTTL = ttl
+	return r
+}
+
+// DefaultRegistry is the registry used by the package level functions.
+var DefaultRegistry = NewRegistry()
+
+// Register adds check to the DefaultRegistry.
+func Register(check Check) error {
+	return DefaultRegistry.Register(check)
+}
+
+// Register adds check to the registry. Checks without a timeout use DEFAULT_TIMEOUT and
+// checks without criticality are CRITICAL.
+func (r *Registry) Register(check Check) error {
+	if check.Name == "" || check.Checker == nil {
+		return fmt.Errorf("%w: name and checker are required", ErrInvalidCheck)
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = DEFAULT_TIMEOUT
+	}
+	if check.Criticality == "" {
+		check.Criticality = CRITICAL
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, c := range r.checks {
+		if c.Name == check.Name {
+			return fmt.Errorf("%w: %s", ErrDuplicateCheck, check.Name)
+		}
+	}
+
+	r.checks = append(r.checks, check)
+
+	return nil
+}
+
+// Checks returns a copy of the registered checks.
+func (r *Registry) Checks() []Check {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return append([]Check(nil), r.checks...)
+}
+
+// Run executes the checks concurrently, each one under its own timeout, and returns
+// when all of them finished or ctx is done. Cached results are reused while fresh and
+// concurrent callers share a single execution of each check, so probe storms do not
+// reach the dependencies. When criticalities are given only the checks with one of
+// them are executed.
+func (r *Registry) Run(ctx context.Context, criticalities ...Criticality) Report {
+	return NewReport(r.collect(ctx, false, criticalities))
+}
+
+// Refresh executes every check ignoring the cache and stores the results.
+func (r *Registry) Refresh(ctx context.Context) Report {
+	return NewReport(r.collect(ctx, true, nil))
+}
+
+// Watch refreshes the checks every interval until ctx is done, so the probes read a
+// snapshot. The cache TTL should be longer than interval.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Registry) collect(ctx context.Context, force bool, criticalities []Criticality) map[string]Result {
+	checks := r.Checks()
+	results := make(map[string]Result, len(checks))
+
+	var (
+		mtx sync.Mutex
+		wg  sync.WaitGroup
+	)
+
+	for _, check := range checks {
+		if !matches(check, criticalities) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			res := r.result(ctx, check, force)
+
+			mtx.Lock()
+			results[check.Name] = res
+			mtx.Unlock()
+		}(check)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// result returns the cached result of check while fresh, otherwise waits for an
+// execution of it. The execution is detached from ctx so a caller giving up does not
+// fail the callers sharing it.
+func (r *Registry) result(ctx context.Context, check Check, force bool) Result {
+	r.mtx.Lock()
+	if res, ok := r.cache[check.Name]; ok && !force && time.Since(res.CheckedAt) < r.cacheTTL {
+		r.mtx.Unlock()
+		return res
+	}
+
+	done, running := r.inflight[check.Name]
+	if !running {
+		done = make(chan struct{})
+		r.inflight[check.Name] = done
+		go r.execute(context.WithoutCancel(ctx), check, done)
+	}
+	r.mtx.Unlock()
+
+	select {
+	case <-done:
+		r.mtx.RLock()
+		defer r.mtx.RUnlock()
+		return r.cache[check.Name]
+	case <-ctx.Done():
+		return failed(check, time.Now(), ctx.Err())
+	}
+}
+
+func (r *Registry) execute(ctx context.Context, check Check, done chan struct{}) {
+	res := run(ctx, check)
+
+	r.mtx.Lock()
+	r.cache[check.Name] = res
+	delete(r.inflight, check.Name)
+
+	h, ok := r.histories[check.Name]
+	if !ok {
+		h = &history{}
+		r.histories[check.Name] = h
+	}
+	h.record(res)
+
+	if r.metrics != nil {
+		r.metrics.observe(check.Name, res)
+	}
+	r.mtx.Unlock()
+
+	close(done)
+}
+
+// NewReport computes the overall status of results: DOWN when a critical check failed,
+// DEGRADED when any other check failed, UP otherwise.
+func NewReport(results map[string]Result) Report {
+	report := Report{Status: STATUS_UP, Components: results}
+
+	for _, res := range results {
+		if res.Status == STATUS_UP {
+			continue
+		}
+		if res.Criticality == CRITICAL {
+			report.Status = STATUS_DOWN
+			break
+		}
+		report.Status = STATUS_DEGRADED
+	}
+
+	return report
+}
+
+func matches(check Check, criticalities []Criticality) bool {
+	if len(criticalities) == 0 {
+		return true
+	}
+	for _, c := range criticalities {
+		if check.Criticality == c {
+			return true
+		}
+	}
+	return false
+}
+
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Checker.Check(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return failed(check, start, err)
+	}
+
+	return Result{
+		CheckedAt:   start,
+		Metadata:    check.Metadata,
+		Status:      STATUS_UP,
+		Criticality: check.Criticality,
+		LatencyMs:   float64(time.Since(start).Microseconds()) / 1e3,
+	}
+}
+
+func failed(check Check, start time.Time, err error) Result {
+	status := STATUS_DOWN
+	if check.Criticality == DEGRADED {
+		status = STATUS_DEGRADED
+	}
+
+	return Result{
+		CheckedAt:   start,
+		Metadata:    check.Metadata,
+		Status:      status,
+		Error:       err.Error(),
+		Criticality: check.Criticality,
+		LatencyMs:   float64(time.Since(start).Microseconds()) / 1e3,
+	}
+}
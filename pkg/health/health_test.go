@@ -0,0 +1,222 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func checker(err error) Checker {
+	return CheckerFunc(func(context.Context) error { return err })
+}
+
+func TestRegistryRunAggregatesStatus(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: checker(nil), Metadata: map[string]string{"type": "database"}}))
+	require.NoError(t, registry.Register(Check{Name: "api", Checker: checker(errors.New("boom")), Criticality: DEGRADED}))
+
+	report := registry.Run(context.Background())
+	require.Equal(t, STATUS_DEGRADED, report.Status)
+	require.Equal(t, STATUS_UP, report.Components["db"].Status)
+	require.Equal(t, CRITICAL, report.Components["db"].Criticality)
+	require.Equal(t, "database", report.Components["db"].Metadata["type"])
+	require.Equal(t, STATUS_DEGRADED, report.Components["api"].Status)
+	require.Equal(t, "boom", report.Components["api"].Error)
+
+	require.NoError(t, registry.Register(Check{Name: "cache", Checker: checker(errors.New("down"))}))
+	require.Equal(t, STATUS_DOWN, registry.Run(context.Background()).Status)
+}
+
+func TestRegistryRegisterValidates(t *testing.T) {
+	registry := NewRegistry()
+	require.ErrorIs(t, registry.Register(Check{Name: "db"}), ErrInvalidCheck)
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: checker(nil)}))
+	require.ErrorIs(t, registry.Register(Check{Name: "db", Checker: checker(nil)}), ErrDuplicateCheck)
+	require.Equal(t, DEFAULT_TIMEOUT, registry.Checks()[0].Timeout)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Check{
+		Name:    "slow",
+		Timeout: 10 * time.Millisecond,
+		Checker: CheckerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	}))
+
+	report := registry.Run(context.Background())
+	require.Equal(t, STATUS_DOWN, report.Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Components["slow"].Error)
+}
+
+func TestHTTPChecker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Id") != "id" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	require.NoError(t, HTTPChecker(nil, srv.URL, map[string]string{"X-Api-Id": "id"}).Check(context.Background()))
+	require.EqualError(t, HTTPChecker(nil, srv.URL, nil).Check(context.Background()), "unexpected status 403")
+}
+
+func TestStartupLatchesOnceWarm(t *testing.T) {
+	var warm bool
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Check{Name: "pool", Checker: CheckerFunc(func(context.Context) error {
+		if !warm {
+			return errors.New("cold")
+		}
+		return nil
+	})}))
+	require.NoError(t, registry.Register(Check{Name: "optional", Checker: checker(errors.New("down")), Criticality: DEGRADED}))
+
+	startup := NewStartup(registry)
+	require.Equal(t, STATUS_DOWN, startup.Run(context.Background()).Status)
+	require.False(t, startup.Started())
+
+	warm = true
+	require.Equal(t, STATUS_DEGRADED, startup.Run(context.Background()).Status)
+	require.True(t, startup.Started())
+
+	warm = false
+	require.Equal(t, STATUS_UP, startup.Run(context.Background()).Status)
+}
+
+func TestRunFiltersByCriticality(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: checker(nil)}))
+	require.NoError(t, registry.Register(Check{Name: "api", Checker: checker(errors.New("boom")), Criticality: DEGRADED}))
+
+	report := registry.Run(context.Background(), CRITICAL)
+	require.Equal(t, STATUS_UP, report.Status)
+	require.Len(t, report.Components, 1)
+}
+
+func slow(calls *atomic.Int32, d time.Duration) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		calls.Add(1)
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func TestRunIsConcurrentAndCached(t *testing.T) {
+	var calls atomic.Int32
+	registry := NewRegistry().SetCacheTTL(time.Minute)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, registry.Register(Check{Name: name, Checker: slow(&calls, 50*time.Millisecond)}))
+	}
+
+	start := time.Now()
+	require.Equal(t, STATUS_UP, registry.Run(context.Background()).Status)
+	require.Less(t, time.Since(start), 140*time.Millisecond)
+	require.Equal(t, int32(3), calls.Load())
+
+	registry.Run(context.Background())
+	require.Equal(t, int32(3), calls.Load())
+
+	registry.Refresh(context.Background())
+	require.Equal(t, int32(6), calls.Load())
+}
+
+func TestRunSharesInflightChecks(t *testing.T) {
+	var calls atomic.Int32
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: slow(&calls, 50*time.Millisecond)}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.Run(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestRunHonorsRequestContext(t *testing.T) {
+	var calls atomic.Int32
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: slow(&calls, 300*time.Millisecond)}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	report := registry.Run(ctx)
+	require.Less(t, time.Since(start), 200*time.Millisecond)
+	require.Equal(t, STATUS_DOWN, report.Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Components["db"].Error)
+}
+
+func TestWatchRefreshesInBackground(t *testing.T) {
+	var calls atomic.Int32
+	registry := NewRegistry().SetCacheTTL(time.Minute)
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: slow(&calls, 0)}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go registry.Watch(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, time.Second, 5*time.Millisecond)
+}
+
+func TestDetailsKeepHistoryAndExportMetrics(t *testing.T) {
+	var fail atomic.Bool
+	promRegistry := prometheus.NewRegistry()
+	registry := NewRegistry().SetMetrics(NewMetrics(promRegistry))
+	require.NoError(t, registry.Register(Check{Name: "db", Checker: CheckerFunc(func(context.Context) error {
+		if fail.Load() {
+			return errors.New("boom")
+		}
+		return nil
+	})}))
+
+	registry.Run(context.Background())
+	fail.Store(true)
+	registry.Run(context.Background())
+	registry.Run(context.Background())
+
+	details := registry.Details(context.Background())
+	require.Equal(t, STATUS_DOWN, details.Status)
+
+	h := details.Components["db"].History
+	require.Equal(t, int64(4), h.Checks)
+	require.Equal(t, int64(3), h.Failures)
+	require.Equal(t, int64(3), h.ConsecutiveFailures)
+	require.Equal(t, "boom", h.LastError)
+	require.False(t, h.LastSuccess.IsZero())
+	require.True(t, h.LastFailure.After(h.LastSuccess))
+	require.LessOrEqual(t, h.LatencyP50Ms, h.LatencyP99Ms)
+
+	require.Equal(t, 0.0, testutil.ToFloat64(registry.metrics.up.WithLabelValues("db", string(CRITICAL))))
+	require.Equal(t, 2, testutil.CollectAndCount(promRegistry))
+}
+
+func TestPercentile(t *testing.T) {
+	samples := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	require.Equal(t, 5.0, percentile(samples, 50))
+	require.Equal(t, 9.0, percentile(samples, 90))
+	require.Equal(t, 10.0, percentile(samples, 99))
+	require.Equal(t, 0.0, percentile(nil, 50))
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// HISTORY_SIZE is the number of latencies kept per check to compute the percentiles.
+const HISTORY_SIZE = 128
+
+// History summarizes the past executions of a check.
+type History struct {
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	Checks              int64     `json:"checks"`
+	Failures            int64     `json:"failures"`
+	ConsecutiveFailures int64     `json:"consecutive_failures"`
+	LatencyP50Ms        float64   `json:"latency_p50_ms"`
+	LatencyP90Ms        float64   `json:"latency_p90_ms"`
+	LatencyP99Ms        float64   `json:"latency_p99_ms"`
+}
+
+// Details is the last result of a check along with its history.
+type Details struct {
+	Result
+	History History `json:"history"`
+}
+
+// DetailedReport is a Report carrying the history of every component.
+type DetailedReport struct {
+	Components map[string]Details `json:"components"`
+	Status     string             `json:"status"`
+}
+
+// history is the rolling record of a check, guarded by the registry mutex.
+type history struct {
+	summary   History
+	latencies [HISTORY_SIZE]float64
+	next      int
+	count     int
+}
+
+func (h *history) record(res Result) {
+	h.summary.Checks++
+	if res.Status == STATUS_UP {
+		h.summary.LastSuccess = res.CheckedAt
+		h.summary.ConsecutiveFailures = 0
+	} else {
+		h.summary.LastFailure = res.CheckedAt
+		h.summary.LastError = res.Error
+		h.summary.Failures++
+		h.summary.ConsecutiveFailures++
+	}
+
+	h.latencies[h.next] = res.LatencyMs
+	h.next = (h.next + 1) % HISTORY_SIZE
+	if h.count < HISTORY_SIZE {
+		h.count++
+	}
+}
+
+func (h *history) snapshot() History {
+	summary := h.summary
+
+	samples := append([]float64(nil), h.latencies[:h.count]...)
+	sort.Float64s(samples)
+
+	summary.LatencyP50Ms = percentile(samples, 50)
+	summary.LatencyP90Ms = percentile(samples, 90)
+	summary.LatencyP99Ms = percentile(samples, 99)
+
+	return summary
+}
+
+// percentile returns the nearest-rank percentile p of the sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// Details runs the checks like Run and adds the history of each component.
+func (r *Registry) Details(ctx context.Context) DetailedReport {
+	report := r.Run(ctx)
+	details := DetailedReport{Status: report.Status, Components: make(map[string]Details, len(report.Components))}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for name, res := range report.Components {
+		d := Details{Result: res}
+		if h, ok := r.histories[name]; ok {
+			d.History = h.snapshot()
+		}
+		details.Components[name] = d
+	}
+
+	return details
+}
@@ -0,0 +1,38 @@
+package health
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics exports the state of the checks to Prometheus.
+type Metrics struct {
+	up       *prometheus.GaugeVec
+	duration *prometheus.GaugeVec
+}
+
+// NewMetrics registers the dependency_up and dependency_check_duration_seconds gauges
+// with registry, usually prometheus.DefaultRegisterer, the one served by
+// middleware.FiberPrometheus.
+func NewMetrics(registry prometheus.Registerer) *Metrics {
+	return &Metrics{
+		up: promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dependency_up",
+			Help: "Whether the last check of the dependency succeeded (1) or failed (0).",
+		}, []string{"name", "criticality"}),
+		duration: promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dependency_check_duration_seconds",
+			Help: "Duration of the last check of the dependency.",
+		}, []string{"name", "criticality"}),
+	}
+}
+
+func (m *Metrics) observe(name string, res Result) {
+	up := 0.0
+	if res.Status == STATUS_UP {
+		up = 1
+	}
+
+	m.up.WithLabelValues(name, string(res.Criticality)).Set(up)
+	m.duration.WithLabelValues(name, string(res.Criticality)).Set(res.LatencyMs / 1e3)
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Startup gates the startup probe on the warm-up of the application, like pools reaching
+// their minimum connections or caches being primed. Once every check passed it stays
+// started, so later dependency failures are left to the readiness probe.
+type Startup struct {
+	registry *Registry
+	started  atomic.Bool
+}
+
+// NewStartup creates a startup gate over the warm-up checks of registry.
+func NewStartup(registry *Registry) *Startup {
+	return &Startup{registry: registry}
+}
+
+// Registry returns the registry where warm-up checks are registered.
+func (s *Startup) Registry() *Registry {
+	return s.registry
+}
+
+// Started reports whether the warm-up already completed.
+func (s *Startup) Started() bool {
+	return s.started.Load()
+}
+
+// Run executes the warm-up checks until they all pass. Failed degraded checks do not hold
+// the startup.
+func (s *Startup) Run(ctx context.Context) Report {
+	if s.Started() {
+		return Report{Status: STATUS_UP, Components: map[string]Result{}}
+	}
+
+	report := s.registry.Run(ctx)
+	if report.Status != STATUS_DOWN {
+		s.started.Store(true)
+	}
+
+	return report
+}
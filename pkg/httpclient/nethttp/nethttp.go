@@ -16,6 +16,8 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/httpclient"
 )
 
 type Requester struct {
@@ -237,11 +239,7 @@ func (r *Requester) Execute(ctx context.Context, method, url string, body io.Rea
 
 	defer resp.Body.Close()
 
-	defaultRecTraceEnable := REQ_TRACE_ENABLE
-	if os.Getenv("REQ_TRACE_ENABLE") != "" {
-		defaultRecTraceEnable = (os.Getenv("REQ_TRACE_ENABLE") == "true")
-	}
-	if defaultRecTraceEnable {
+	if httpclient.TraceEnabled(REQ_TRACE_ENABLE) {
 		ti := r.TraceInfo()
 
 		jsonTracer := `{"DNSLookup":"%v","URI":"%s","RemoteAddr":"%v","LocalAddr":"%v","ConnTime":"%v", "TCPConnTime":"%v",` +
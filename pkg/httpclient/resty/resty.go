@@ -9,6 +9,8 @@ import (
 	"github.com/go-resty/resty/v2"
 	jsoniter "github.com/json-iterator/go"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/httpclient"
 )
 
 var ctx context.Context
@@ -55,11 +57,7 @@ func NewClient() *resty.Client {
 	client.JSONMarshal = json.Marshal
 	client.JSONUnmarshal = json.Unmarshal
 
-	defaultRecTraceEnable := REQ_TRACE_ENABLE
-	if os.Getenv("REQ_TRACE_ENABLE") != "" {
-		defaultRecTraceEnable = (os.Getenv("REQ_TRACE_ENABLE") == "true")
-	}
-	if defaultRecTraceEnable {
+	if httpclient.TraceEnabled(REQ_TRACE_ENABLE) {
 		client.EnableTrace()
 	} else {
 		client.DisableTrace()
@@ -140,6 +138,10 @@ func (req *Requester) Execute(ctx context.Context, method, endpoint string, body
 	defer span.Finish()
 
 	rreq := req.restyReq
+	if httpclient.TraceEnabled(REQ_TRACE_ENABLE) {
+		// Clients built while tracing was disabled still trace once it is enabled at runtime.
+		rreq.EnableTrace()
+	}
 
 	if body != nil {
 		rreq.SetBody(body)
@@ -161,11 +163,7 @@ func (req *Requester) Execute(ctx context.Context, method, endpoint string, body
 		return nil, err
 	}
 
-	defaultRecTraceEnable := REQ_TRACE_ENABLE
-	if os.Getenv("REQ_TRACE_ENABLE") != "" {
-		defaultRecTraceEnable = (os.Getenv("REQ_TRACE_ENABLE") == "true")
-	}
-	if defaultRecTraceEnable {
+	if httpclient.TraceEnabled(REQ_TRACE_ENABLE) {
 		ti := rres.Request.TraceInfo()
 
 		defaultRecTracePrintEnable := REQ_TRACE_ENABLE_PRINT
@@ -0,0 +1,27 @@
+package httpclient
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// traceOverride holds the value set by SetTraceEnabled, taking precedence over REQ_TRACE_ENABLE.
+var traceOverride atomic.Pointer[bool]
+
+// SetTraceEnabled enables or disables the request tracing of every client at runtime.
+func SetTraceEnabled(enabled bool) {
+	traceOverride.Store(&enabled)
+}
+
+// TraceEnabled reports whether the clients trace their requests: the value set by
+// SetTraceEnabled, else REQ_TRACE_ENABLE, else fallback, the default of the client.
+func TraceEnabled(fallback bool) bool {
+	if enabled := traceOverride.Load(); enabled != nil {
+		return *enabled
+	}
+
+	if env := os.Getenv("REQ_TRACE_ENABLE"); env != "" {
+		return env == "true"
+	}
+	return fallback
+}
@@ -87,6 +87,9 @@ func processHTTPError(ctx context.Context, responseWriter *fiber.Ctx, res Contro
 	json.Unmarshal(responseWriter.Body(), &requestPayload)
 
 	err = res.Error
+	if dbErr := domainerrors.NewDatabaseError(err); dbErr != nil {
+		err = dbErr
+	}
 	traceId := responseWriter.Get("Trace-Id")
 	status := 0
 	var payload *apierrors.DockApiError
@@ -145,6 +148,33 @@ func processHTTPError(ctx context.Context, responseWriter *fiber.Ctx, res Contro
 			Data:       requestPayload,
 			Error:      *apierrors.NewDockApiError(status, statusCodeString(status), err.Error()),
 		}
+	case *domainerrors.DatabaseError:
+		status = err.StatusCode
+		payload = apierrors.NewDockApiError(status, err.ApiCode, err.Error())
+		if err.Retryable {
+			responseWriter.Set(fiber.HeaderRetryAfter, "1")
+		}
+		attr := err.Column
+		if attr == "" {
+			attr = err.Constraint
+		}
+		if attr != "" {
+			payload.AddErrorDetail(attr, err.Error())
+		}
+		message = err.InternalError.Error()
+		logMessage = logs.ErrorLogMessage{
+			TraceID:    traceId,
+			HTTPStatus: status,
+			Data: map[string]any{
+				"sqlstate":   err.Code,
+				"retryable":  err.Retryable,
+				"table":      err.Table,
+				"column":     err.Column,
+				"constraint": err.Constraint,
+				"detail":     err.Detail,
+			},
+			Error: *payload,
+		}
 	case *domainerrors.ServerError:
 		status = http.StatusInternalServerError
 		payload = apierrors.NewDockApiError(status, statusCodeString(status), err.Error())
@@ -1,12 +1,13 @@
 package fiber
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
 	"github.com/gofiber/fiber/v2/middleware/pprof"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -23,21 +24,40 @@ type FiberEngine struct {
 	port string
 }
 
-var healthcheckPath = func(c *fiber.Ctx) bool { return c.Path() == "/health" }
+var healthcheckPath = func(c *fiber.Ctx) bool { return strings.HasPrefix(c.Path(), "/health") }
+
+// WebserverOptions are the settings of the webserver, the rate limit being disabled while
+// RateLimiter is nil.
+type WebserverOptions struct {
+	RateLimiter     *middleware.RateLimiter
+	Port            string
+	AppName         string
+	DisableStartMsg bool
+	Prefork         bool
+	Pprof           bool
+	Prometheus      bool
+}
 
-func (engine *FiberEngine) NewWebserver(serverPort string) {
+func (engine *FiberEngine) NewWebserver(options WebserverOptions) {
 	api := fiber.New(fiber.Config{
 		ErrorHandler: middleware.ApplicationErrorHandler,
 		// ReadBufferSize:        40960,
-		DisableStartupMessage: os.Getenv("HTTP_DISABLE_START_MSG") == "true",
-		Prefork:               os.Getenv("HTTP_PREFORK") == "true",
+		DisableStartupMessage: options.DisableStartMsg,
+		Prefork:               options.Prefork,
 	})
 
-	if os.Getenv("PPROF_ENABLED") == "true" {
+	if options.Pprof {
 		api.Use(pprof.New())
 		api.Get("/metrics", monitor.New())
 	}
 
+	// Serves the default Prometheus registry, where the http and dependency metrics live.
+	if options.Prometheus {
+		prom := middleware.NewPrometheus(options.AppName)
+		prom.RegisterAt(api, "/prometheus")
+		api.Use(prom.Middleware)
+	}
+
 	api.Use(skip.New(fibertrace.Middleware(), healthcheckPath))
 
 	api.Use(recover.New(recover.Config{
@@ -49,12 +69,12 @@ func (engine *FiberEngine) NewWebserver(serverPort string) {
 	api.Use(skip.New(middleware.TenantIdMiddleware, healthcheckPath))
 	api.Use(middleware.ContentTypeMiddleware("POST", fiber.MIMEApplicationJSON))
 
-	if os.Getenv("HTTP_RATE_LIMIT_ENABLE") == "true" {
-		api.Use(limiter.New(middleware.DefaultRateLimiterConfig))
+	if options.RateLimiter != nil {
+		api.Use(options.RateLimiter.Handler)
 	}
 
 	engine.app = api
-	engine.port = serverPort
+	engine.port = options.Port
 }
 
 func (engine *FiberEngine) GetApp() *fiber.App {
@@ -65,13 +85,16 @@ func (engine *FiberEngine) GetPort() string {
 	return engine.port
 }
 
-func (engine *FiberEngine) Run() {
-	closed := make(chan bool, 1)
-
+// Run blocks serving requests until Shutdown is called or the listener fails.
+func (engine *FiberEngine) Run() error {
 	log.Debugln(fmt.Sprintf("Listening on port %s", engine.port))
 
-	engine.app.Listen(("0.0.0.0:" + engine.port))
-	<-closed
+	return engine.app.Listen(("0.0.0.0:" + engine.port))
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx is done.
+func (engine *FiberEngine) Shutdown(ctx context.Context) error {
+	return engine.app.ShutdownWithContext(ctx)
 }
 
 func (engine *FiberEngine) Router(app *fiber.App) {
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const bearerPrefix = "Bearer "
+
+// AdminAuth requires the request to carry "Authorization: Bearer <token>". The token is
+// read on every request so it can be rotated at runtime; while it is empty the admin
+// routes are disabled and answer 404.
+func AdminAuth(token func() string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		expected := token()
+		if expected == "" {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		auth := ctx.Get(fiber.HeaderAuthorization)
+		if !strings.HasPrefix(auth, bearerPrefix) {
+			return ctx.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		given := strings.TrimPrefix(auth, bearerPrefix)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+			return ctx.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		return ctx.Next()
+	}
+}
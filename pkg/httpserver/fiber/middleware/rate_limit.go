@@ -3,9 +3,8 @@ package middleware
 import (
 	"context"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -18,54 +17,36 @@ import (
 	"github.com/fsvxavier/default-vertical-slice/pkg/database/redis"
 )
 
-func rateLimiterStorage(ctx context.Context) fiber.Storage {
-	redisHost := os.Getenv("REDIS_HOST")
-	redisUsername := os.Getenv("REDIS_USERNAME")
-	redisPassword := os.Getenv("REDIS_PASSWORD")
+const (
+	DEFAULT_RATE_LIMIT_RPM  = 100
+	DEFAULT_RATE_LIMIT_LOCK = time.Minute
+)
 
-	if redisHost != "" && redisUsername != "" && redisPassword != "" {
-		addrs := strings.Split(redisHost, ",")
+// NewRateLimiterStorage keeps the limiter counters in Redis, shared by every instance,
+// when the addresses and the credentials are set, and in memory otherwise.
+func NewRateLimiterStorage(ctx context.Context, addresses []string, username, password string) fiber.Storage {
+	if len(addresses) > 0 && username != "" && password != "" {
 		return redis.NewCache(&redis.RedigoPoolOptions{
 			Context:   ctx,
 			Database:  1,
-			Addresses: addrs,
-			Password:  redisPassword,
+			Addresses: addresses,
+			Password:  password,
 		})
 	}
 
 	return nil
 }
 
-func rateLimitRPM() int {
-	var requestsPerMinute int = 100
-
-	env := os.Getenv("RATE_LIMIT_REQUESTS_PER_MINUTE")
-	if value, err := strconv.Atoi(env); err == nil {
-		requestsPerMinute = value
-	}
-
-	return requestsPerMinute
-}
-
-func rateLimitLockDuration() time.Duration {
-	var lockDuration time.Duration = 1 * time.Minute
-
-	env := os.Getenv("RATE_LIMIT_LOCK_DURATION_IN_MINUTES")
-	if value, err := strconv.Atoi(env); err == nil {
-		lockDuration = time.Duration(value) * time.Minute
-	}
-
-	return lockDuration
-}
-
-func rateLimiterConfig(storage fiber.Storage, requestsPerMinute int, lockDuration time.Duration) limiter.Config {
+// NewRateLimiterConfig limits each client, by its Client-Id header or its IP, to
+// requestsPerMinute, the health probes excepted.
+func NewRateLimiterConfig(storage fiber.Storage, requestsPerMinute int, lockDuration time.Duration) limiter.Config {
 	return limiter.Config{
 		SkipFailedRequests:     false,
 		SkipSuccessfulRequests: false,
 		Storage:                storage,
 		Max:                    requestsPerMinute,
 		Expiration:             lockDuration,
-		Next:                   func(c *fiber.Ctx) bool { return c.Path() == "/health" },
+		Next:                   func(c *fiber.Ctx) bool { return strings.HasPrefix(c.Path(), "/health") },
 		KeyGenerator: func(c *fiber.Ctx) string {
 			key := c.Get("Client-Id")
 
@@ -95,8 +76,32 @@ func rateLimiterConfig(storage fiber.Storage, requestsPerMinute int, lockDuratio
 	}
 }
 
-var DefaultRateLimiterConfig = rateLimiterConfig(
-	rateLimiterStorage(context.TODO()),
-	rateLimitRPM(),
-	rateLimitLockDuration(),
-)
+var DefaultRateLimiterConfig = NewRateLimiterConfig(nil, DEFAULT_RATE_LIMIT_RPM, DEFAULT_RATE_LIMIT_LOCK)
+
+// RateLimiter is a limiter middleware whose limits can be changed at runtime.
+type RateLimiter struct {
+	handler atomic.Pointer[fiber.Handler]
+	config  limiter.Config
+}
+
+func NewRateLimiter(config limiter.Config) *RateLimiter {
+	rl := &RateLimiter{config: config}
+	handler := limiter.New(config)
+	rl.handler.Store(&handler)
+	return rl
+}
+
+// Update swaps the limiter for one using the new limits. The counters kept in memory
+// restart, the ones kept in the Redis storage are preserved.
+func (rl *RateLimiter) Update(requestsPerMinute int, lockDuration time.Duration) {
+	config := rl.config
+	config.Max = requestsPerMinute
+	config.Expiration = lockDuration
+
+	handler := limiter.New(config)
+	rl.handler.Store(&handler)
+}
+
+func (rl *RateLimiter) Handler(c *fiber.Ctx) error {
+	return (*rl.handler.Load())(c)
+}
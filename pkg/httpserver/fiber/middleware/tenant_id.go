@@ -1,18 +1,27 @@
 package middleware
 
 import (
-	"context"
-
 	"github.com/gofiber/fiber/v2"
+
+	"github.com/fsvxavier/default-vertical-slice/pkg/tenant"
 )
 
+const HEADER_TENANT_ID = "Client-Id"
+
+// TenantIdMiddleware carries the tenant of the Client-Id header in the user context,
+// read with tenant.FromContext. Requests without the header carry no tenant, so the
+// multi-tenant statements fail, and malformed ids are answered 400.
 func TenantIdMiddleware(ctx *fiber.Ctx) error {
-	tenantID := ctx.Get("Client-Id")
+	tenantID := ctx.Get(HEADER_TENANT_ID)
+	if tenantID == "" {
+		return ctx.Next()
+	}
+
+	if err := tenant.Validate(tenantID); err != nil {
+		return ctx.SendStatus(fiber.StatusBadRequest)
+	}
 
-	c := ctx.UserContext()
-	//lint:ignore SA1029 ignore this!
-	c = context.WithValue(c, "tenant_id", tenantID)
-	ctx.SetUserContext(c)
+	ctx.SetUserContext(tenant.WithContext(ctx.UserContext(), tenantID))
 
 	return ctx.Next()
 }
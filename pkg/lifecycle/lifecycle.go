@@ -0,0 +1,201 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	logger "github.com/fsvxavier/default-vertical-slice/pkg/logger/zap"
+)
+
+const (
+	DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+	DEFAULT_DRAIN_DELAY      = 0 * time.Second
+)
+
+// Hook is a named pair of callbacks run by the Manager.
+// OnStart hooks run in the order they were appended, OnStop hooks run in reverse order.
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	Name    string
+}
+
+type Manager struct {
+	fail            chan error
+	signalCh        chan os.Signal
+	hooks           []Hook
+	started         []Hook
+	signals         []os.Signal
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	mtx             sync.Mutex
+	ready           atomic.Bool
+	stopped         atomic.Bool
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		fail:            make(chan error, 1),
+		signalCh:        make(chan os.Signal, 1),
+		signals:         []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		shutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
+		drainDelay:      DEFAULT_DRAIN_DELAY,
+	}
+}
+
+// SetShutdownTimeout defines the deadline shared by every OnStop hook.
+func (m *Manager) SetShutdownTimeout(timeout time.Duration) *Manager {
+	if timeout > 0 {
+		m.shutdownTimeout = timeout
+	}
+	return m
+}
+
+// SetDrainDelay defines how long the manager keeps serving after readiness flips to failing,
+// giving load balancers time to stop routing new requests before the hooks are stopped.
+func (m *Manager) SetDrainDelay(delay time.Duration) *Manager {
+	if delay >= 0 {
+		m.drainDelay = delay
+	}
+	return m
+}
+
+// SetSignals overrides the signals that trigger a shutdown (SIGINT and SIGTERM by default).
+func (m *Manager) SetSignals(signals ...os.Signal) *Manager {
+	if len(signals) > 0 {
+		m.signals = signals
+	}
+	return m
+}
+
+// Append registers a hook. Hooks must be appended before Start is called.
+func (m *Manager) Append(hook Hook) *Manager {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.hooks = append(m.hooks, hook)
+	return m
+}
+
+// Ready reports whether the application is started and not shutting down.
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// Stopping reports whether the shutdown began, telling a draining application from one
+// still starting when it is not ready.
+func (m *Manager) Stopping() bool {
+	return m.stopped.Load()
+}
+
+// Fail asks the manager to shut down because a background component stopped unexpectedly.
+func (m *Manager) Fail(err error) {
+	if err == nil {
+		err = errors.New("lifecycle: component stopped without error")
+	}
+
+	select {
+	case m.fail <- err:
+	default:
+	}
+}
+
+// Start runs every OnStart hook in order. If one fails, the hooks already started are stopped.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mtx.Lock()
+	hooks := append([]Hook(nil), m.hooks...)
+	m.mtx.Unlock()
+
+	for _, hook := range hooks {
+		if hook.OnStart != nil {
+			logger.Debug(ctx, fmt.Sprintf("lifecycle: starting %s", hook.Name))
+
+			if err := hook.OnStart(ctx); err != nil {
+				startErr := fmt.Errorf("lifecycle: start %s: %w", hook.Name, err)
+				if stopErr := m.Stop(ctx); stopErr != nil {
+					return errors.Join(startErr, stopErr)
+				}
+				return startErr
+			}
+		}
+
+		m.mtx.Lock()
+		m.started = append(m.started, hook)
+		m.mtx.Unlock()
+	}
+
+	m.ready.Store(true)
+
+	return nil
+}
+
+// Stop flips readiness to failing, waits for the drain delay and then runs the OnStop hooks
+// of every started hook in reverse order, sharing the shutdown timeout. All errors are joined.
+func (m *Manager) Stop(ctx context.Context) error {
+	if !m.stopped.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	m.ready.Store(false)
+
+	if m.drainDelay > 0 {
+		select {
+		case <-time.After(m.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.shutdownTimeout)
+	defer cancel()
+
+	m.mtx.Lock()
+	started := m.started
+	m.started = nil
+	m.mtx.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.OnStop == nil {
+			continue
+		}
+
+		logger.Debug(stopCtx, fmt.Sprintf("lifecycle: stopping %s", hook.Name))
+
+		if err := hook.OnStop(stopCtx); err != nil {
+			errs = append(errs, fmt.Errorf("lifecycle: stop %s: %w", hook.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run starts the hooks and blocks until a shutdown signal is received, the context is
+// canceled or a component calls Fail. The hooks are then stopped.
+func (m *Manager) Run(ctx context.Context) error {
+	signal.Notify(m.signalCh, m.signals...)
+	defer signal.Stop(m.signalCh)
+
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case sig := <-m.signalCh:
+		logger.Info(ctx, fmt.Sprintf("lifecycle: received %s, shutting down", sig))
+	case <-ctx.Done():
+		logger.Info(ctx, "lifecycle: context done, shutting down")
+	case runErr = <-m.fail:
+		logger.Error(ctx, "lifecycle: component failed, shutting down - "+runErr.Error())
+	}
+
+	return errors.Join(runErr, m.Stop(ctx))
+}
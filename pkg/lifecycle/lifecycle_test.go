@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func waitReady(t *testing.T, m *Manager) {
+	t.Helper()
+
+	require.Eventually(t, m.Ready, time.Second, time.Millisecond)
+}
+
+func TestRunStopsHooksInReverseOrderOnSignal(t *testing.T) {
+	var order []string
+	var readyDuringStop bool
+
+	m := NewManager()
+	for _, name := range []string{"tracing", "database", "http"} {
+		name := name
+		m.Append(Hook{
+			Name: name,
+			OnStart: func(ctx context.Context) error {
+				order = append(order, "start:"+name)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				readyDuringStop = readyDuringStop || m.Ready()
+				order = append(order, "stop:"+name)
+				return nil
+			},
+		})
+	}
+
+	done := make(chan error, 1)
+	require.False(t, m.Stopping())
+	go func() { done <- m.Run(context.Background()) }()
+
+	waitReady(t, m)
+	require.False(t, m.Stopping())
+	m.signalCh <- syscall.SIGTERM
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("manager did not stop after signal")
+	}
+
+	require.False(t, m.Ready())
+	require.True(t, m.Stopping())
+	require.False(t, readyDuringStop)
+	require.Equal(t, []string{
+		"start:tracing", "start:database", "start:http",
+		"stop:http", "stop:database", "stop:tracing",
+	}, order)
+}
+
+func TestRunHandlesProcessSignal(t *testing.T) {
+	stopped := make(chan struct{})
+
+	m := NewManager().SetSignals(syscall.SIGUSR1)
+	m.Append(Hook{
+		Name: "http",
+		OnStop: func(ctx context.Context) error {
+			close(stopped)
+			return nil
+		},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run(context.Background()) }()
+
+	waitReady(t, m)
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("manager did not stop after process signal")
+	}
+
+	<-stopped
+}
+
+func TestStopHonorsShutdownTimeout(t *testing.T) {
+	m := NewManager().SetShutdownTimeout(20 * time.Millisecond)
+	m.Append(Hook{
+		Name: "http",
+		OnStop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	require.NoError(t, m.Start(context.Background()))
+
+	err := m.Stop(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, m.Stop(context.Background()), "second stop must be a no-op")
+}
+
+func TestStartFailureStopsStartedHooks(t *testing.T) {
+	var stopped []string
+	errBoom := errors.New("boom")
+
+	m := NewManager()
+	m.Append(Hook{
+		Name:   "database",
+		OnStop: func(ctx context.Context) error { stopped = append(stopped, "database"); return nil },
+	})
+	m.Append(Hook{
+		Name:    "redis",
+		OnStart: func(ctx context.Context) error { return errBoom },
+		OnStop:  func(ctx context.Context) error { stopped = append(stopped, "redis"); return nil },
+	})
+
+	err := m.Start(context.Background())
+	require.ErrorIs(t, err, errBoom)
+	require.Equal(t, []string{"database"}, stopped)
+	require.False(t, m.Ready())
+}
+
+func TestFailTriggersShutdown(t *testing.T) {
+	errListen := errors.New("listen failed")
+
+	m := NewManager()
+	m.Append(Hook{
+		Name: "http",
+		OnStart: func(ctx context.Context) error {
+			go m.Fail(errListen)
+			return nil
+		},
+	})
+
+	err := m.Run(context.Background())
+	require.ErrorIs(t, err, errListen)
+}
@@ -43,8 +43,7 @@ func Formatter(ctx context.Context, code, message string) (ctxs context.Context,
 		Line:    line,
 	})
 	if err != nil {
-		fmt.Errorf("marshal Log error: %s", err.Error())
-		return
+		return ctx, fmt.Sprintf("marshal Log error: %s", err.Error())
 	}
 
 	return ctx, string(logMessage)
@@ -30,6 +30,32 @@ type Logger struct {
 
 var Reflect = zap.Reflect
 
+// level is shared by every Logger, so a level change is applied live to the loggers
+// already built and to the package functions.
+var level = newLevel()
+
+func newLevel() zap.AtomicLevel {
+	lvl := zap.NewAtomicLevel()
+	levelLog := zap.InfoLevel
+	if os.Getenv("LOG_LEVEL") != "" {
+		envLevel := os.Getenv("LOG_LEVEL")
+		lvlParsed, _ := zap.ParseAtomicLevel(envLevel)
+		levelLog = lvlParsed.Level()
+	}
+	lvl.SetLevel(levelLog)
+	return lvl
+}
+
+// SetLevel changes the level of every Logger at runtime.
+func SetLevel(lvl string) error {
+	parsed, err := zap.ParseAtomicLevel(lvl)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(parsed.Level())
+	return nil
+}
+
 func NewLogger() *Logger {
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = "timestamp"
@@ -45,14 +71,7 @@ func NewLogger() *Logger {
 	encoderCfg.EncodeDuration = zapcore.SecondsDurationEncoder
 	encoderCfg.EncodeCaller = zapcore.ShortCallerEncoder
 
-	lvl := zap.NewAtomicLevel()
-	levelLog := zap.InfoLevel
-	if os.Getenv("LOG_LEVEL") != "" {
-		envLevel := os.Getenv("LOG_LEVEL")
-		lvlParsed, _ := zap.ParseAtomicLevel(envLevel)
-		levelLog = lvlParsed.Level()
-	}
-	lvl.SetLevel(levelLog)
+	lvl := level
 
 	var options []zap.Option
 	// if TraceEnabled() {
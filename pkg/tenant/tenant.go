@@ -0,0 +1,90 @@
+// Package tenant carries the tenant of a request in its context.
+//
+// The tenant is stored under an unexported key, so it can only be set through
+// WithContext and never collides with other context values. Jobs working across tenants
+// mark their context with System instead of impersonating a tenant.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+// MAX_ID_LENGTH bounds the tenant ids accepted by Validate.
+const MAX_ID_LENGTH = 128
+
+var (
+	ErrRequired = errors.New("tenant id required in context")
+	ErrInvalid  = errors.New("invalid tenant id")
+)
+
+type contextKey struct{}
+
+type scope struct {
+	id     string
+	system bool
+}
+
+// WithContext returns a copy of ctx carrying the tenant id.
+func WithContext(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	return context.WithValue(ctx, contextKey{}, scope{id: id})
+}
+
+// FromContext returns the tenant id carried by ctx, false without one or in a System
+// context.
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	s, _ := ctx.Value(contextKey{}).(scope)
+	return s.id, s.id != ""
+}
+
+// Require returns the tenant id carried by ctx, failing with ErrRequired without one.
+func Require(ctx context.Context) (string, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return "", ErrRequired
+	}
+	return id, nil
+}
+
+// System returns a copy of ctx allowed to reach every tenant, for jobs like the outbox
+// relay or the nightly imports. It drops the tenant carried by ctx.
+func System(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	return context.WithValue(ctx, contextKey{}, scope{system: true})
+}
+
+// IsSystem reports whether ctx was marked by System.
+func IsSystem(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	s, _ := ctx.Value(contextKey{}).(scope)
+	return s.system
+}
+
+// Validate fails with ErrInvalid when id is empty, longer than MAX_ID_LENGTH or holds
+// spaces or control characters.
+func Validate(id string) error {
+	if id == "" || len(id) > MAX_ID_LENGTH {
+		return fmt.Errorf("%w: length must be between 1 and %d", ErrInvalid, MAX_ID_LENGTH)
+	}
+
+	for _, r := range id {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("%w: %q", ErrInvalid, id)
+		}
+	}
+	return nil
+}
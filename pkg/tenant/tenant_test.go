@@ -0,0 +1,42 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := FromContext(ctx)
+	require.False(t, ok)
+	_, err := Require(ctx)
+	require.ErrorIs(t, err, ErrRequired)
+
+	// The raw string key used before is not read.
+	//lint:ignore SA1029 asserts the former key is ignored
+	_, ok = FromContext(context.WithValue(ctx, "tenant_id", "t1"))
+	require.False(t, ok)
+
+	ctx = WithContext(ctx, "t1")
+	id, err := Require(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "t1", id)
+	require.False(t, IsSystem(ctx))
+
+	ctx = System(ctx)
+	require.True(t, IsSystem(ctx))
+	_, ok = FromContext(ctx)
+	require.False(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate("0b4c9a3e-acme"))
+	require.ErrorIs(t, Validate(""), ErrInvalid)
+	require.ErrorIs(t, Validate("acme corp"), ErrInvalid)
+	require.ErrorIs(t, Validate("acme\x00"), ErrInvalid)
+	require.ErrorIs(t, Validate(strings.Repeat("a", MAX_ID_LENGTH+1)), ErrInvalid)
+}